@@ -0,0 +1,82 @@
+// Package admin provides the authenticated http endpoints used to operate the service, such as pausing consumption
+// during incidents and requesting extractions.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+const bearerPrefix = "Bearer "
+
+// Pauser dependency that stops and restarts the consumption of events
+type Pauser interface {
+	Pause()
+	Resume()
+	IsPaused() bool
+}
+
+// consumptionState is the response body of the pause and resume endpoints
+type consumptionState struct {
+	Paused bool `json:"paused"`
+}
+
+// RequireToken wraps the handler so that it is only called for requests that have the token as a bearer token in
+// their Authorization header. Every request is refused if the token is empty, so that the admin endpoints are
+// disabled unless a token has been configured.
+func RequireToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		authorization := req.Header.Get("Authorization")
+		given := strings.TrimPrefix(authorization, bearerPrefix)
+		if token == "" || given == authorization || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			log.Warn(req.Context(), "unauthorised admin request", log.Data{"path": req.URL.Path})
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// PauseHandler returns a handler that stops the pauser consuming any more events. Events already being handled
+// carry on until they finish.
+func PauseHandler(pauser Pauser) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		pauser.Pause()
+		log.Info(req.Context(), "event consumption paused")
+		writeState(w, req, pauser)
+	}
+}
+
+// ResumeHandler returns a handler that starts the pauser consuming events again.
+func ResumeHandler(pauser Pauser) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		pauser.Resume()
+		log.Info(req.Context(), "event consumption resumed")
+		writeState(w, req, pauser)
+	}
+}
+
+// writeState responds with whether the pauser is paused.
+func writeState(w http.ResponseWriter, req *http.Request, pauser Pauser) {
+	writeJSON(w, req, http.StatusOK, consumptionState{Paused: pauser.IsPaused()})
+}
+
+// writeJSON writes the body as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, req *http.Request, status int, body interface{}) {
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		log.Error(req.Context(), "failed to marshal admin response", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(bytes); err != nil {
+		log.Error(req.Context(), "failed to write admin response", err)
+	}
+}
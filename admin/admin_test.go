@@ -0,0 +1,108 @@
+package admin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/admin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const token = "admin-token"
+
+func TestRequireToken(t *testing.T) {
+	Convey("Given a handler that requires a token", t, func() {
+		called := false
+		handler := admin.RequireToken(token, func(w http.ResponseWriter, req *http.Request) {
+			called = true
+		})
+
+		Convey("When a request has the token as a bearer token", func() {
+			recorder := post(handler, "Bearer "+token)
+
+			Convey("Then the handler is called", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(called, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a request has a different token", func() {
+			recorder := post(handler, "Bearer not-the-token")
+
+			Convey("Then the request is unauthorised", func() {
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(called, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a request has the token without the bearer prefix", func() {
+			recorder := post(handler, token)
+
+			Convey("Then the request is unauthorised", func() {
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(called, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a handler that requires an empty token", t, func() {
+		called := false
+		handler := admin.RequireToken("", func(w http.ResponseWriter, req *http.Request) {
+			called = true
+		})
+
+		Convey("When a request has an empty bearer token", func() {
+			recorder := post(handler, "Bearer ")
+
+			Convey("Then the request is unauthorised", func() {
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(called, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestPauseAndResume(t *testing.T) {
+	Convey("Given a pauser that is consuming", t, func() {
+		pauser := &fakePauser{}
+
+		Convey("When the pause handler is called", func() {
+			recorder := post(admin.PauseHandler(pauser), "")
+
+			Convey("Then the pauser is paused and the paused state is returned", func() {
+				So(pauser.paused, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(recorder.Body.String(), ShouldEqual, `{"paused":true}`)
+			})
+
+			Convey("And when the resume handler is called", func() {
+				recorder := post(admin.ResumeHandler(pauser), "")
+
+				Convey("Then the pauser is resumed and the consuming state is returned", func() {
+					So(pauser.paused, ShouldBeFalse)
+					So(recorder.Body.String(), ShouldEqual, `{"paused":false}`)
+				})
+			})
+		})
+	})
+}
+
+func post(handler http.HandlerFunc, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/pause", http.NoBody)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	return recorder
+}
+
+// fakePauser records whether it has been paused
+type fakePauser struct {
+	paused bool
+}
+
+func (pauser *fakePauser) Pause()         { pauser.paused = true }
+func (pauser *fakePauser) Resume()        { pauser.paused = false }
+func (pauser *fakePauser) IsPaused() bool { return pauser.paused }
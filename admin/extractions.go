@@ -0,0 +1,185 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/ONSdigital/dp-observation-extractor/event"
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// maxExtractionRequestBytes is the largest extraction request body that is read
+const maxExtractionRequestBytes = 64 * 1024
+
+// errClosed is returned when an extraction is requested after the extractor has been closed
+var errClosed = errors.New("service is shutting down")
+
+// EventHandler dependency that extracts the observations for an event
+type EventHandler interface {
+	Handle(ctx context.Context, event *event.DimensionsInserted) error
+}
+
+// JobQueue dependency that records the jobs requested through the admin api
+type JobQueue interface {
+	Queue(instanceID, fileURL string) (jobs.Job, error)
+	GetByID(id string) (jobs.Job, bool)
+}
+
+// extractionRequest is the request body of the extractions endpoint. If Sync is true, the response is only sent once
+// the extraction has finished.
+type extractionRequest struct {
+	InstanceID string                `json:"instance_id"`
+	FileURL    string                `json:"file_url"`
+	Selection  observation.Selection `json:"selection"`
+	Sync       bool                  `json:"sync"`
+}
+
+// Extractor runs extractions requested over http, without a dimensions inserted event having to be sent to kafka.
+type Extractor struct {
+	handler EventHandler
+	jobs    JobQueue
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mutex   sync.Mutex
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewExtractor returns a new Extractor that queues a job for each requested extraction, and then handles it with the
+// given event handler.
+func NewExtractor(handler EventHandler, jobs JobQueue) *Extractor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Extractor{
+		handler: handler,
+		jobs:    jobs,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Handler queues the extraction of the instance and file url in the request body, optionally of a selection of its
+// rows. By default it responds with the queued job without waiting for the extraction to finish, and its progress can
+// then be got using the job's ID. If the request is synchronous, the extraction runs before responding with the
+// finished job, and is cancelled if the request is.
+func (extractor *Extractor) Handler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var request extractionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxExtractionRequestBytes)).Decode(&request); err != nil {
+		log.Warn(ctx, "invalid extraction request body", log.FormatErrors([]error{err}))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.InstanceID == "" || request.FileURL == "" {
+		http.Error(w, "instance_id and file_url are required", http.StatusBadRequest)
+		return
+	}
+	if err := request.Selection.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := extractor.queue(request)
+	switch {
+	case errors.Is(err, errClosed):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, jobs.ErrInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Error(ctx, "failed to queue extraction job", err, log.Data{"instanceID": request.InstanceID})
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer extractor.wg.Done()
+
+	logData := log.Data{"jobID": job.ID, "instanceID": job.InstanceID, "url": job.FileURL, "sync": request.Sync}
+	log.Info(ctx, "extraction requested", logData)
+
+	dimensionsInserted := &event.DimensionsInserted{
+		InstanceID:      request.InstanceID,
+		FileURL:         request.FileURL,
+		Selection:       request.Selection,
+		ExtractionJobID: job.ID,
+	}
+	w.Header().Set("Location", "/extractions/"+job.ID)
+
+	if !request.Sync {
+		extractor.wg.Add(1)
+		go func() {
+			defer extractor.wg.Done()
+			extractor.extract(extractor.ctx, dimensionsInserted, logData)
+		}()
+		writeJSON(w, req, http.StatusAccepted, job)
+		return
+	}
+
+	// the extraction is cancelled if either the request is or the extractor is closed
+	extractCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(extractor.ctx, cancel)
+	defer stop()
+
+	extractor.extract(extractCtx, dimensionsInserted, logData)
+	if finished, ok := extractor.jobs.GetByID(job.ID); ok {
+		job = finished
+	}
+	writeJSON(w, req, http.StatusOK, job)
+}
+
+// queue records a job for the requested extraction. Once queued, the extraction is counted as running until the
+// caller calls extractor.wg.Done, so that Close waits for it. errClosed is returned if the extractor has been closed.
+func (extractor *Extractor) queue(request extractionRequest) (jobs.Job, error) {
+	extractor.mutex.Lock()
+	defer extractor.mutex.Unlock()
+
+	if extractor.closed {
+		return jobs.Job{}, errClosed
+	}
+
+	job, err := extractor.jobs.Queue(request.InstanceID, request.FileURL)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	extractor.wg.Add(1)
+	return job, nil
+}
+
+// extract handles the event for a requested extraction, logging its outcome.
+func (extractor *Extractor) extract(ctx context.Context, dimensionsInserted *event.DimensionsInserted, logData log.Data) {
+	if err := extractor.handler.Handle(ctx, dimensionsInserted); err != nil {
+		log.Error(ctx, "requested extraction failed", err, logData)
+		return
+	}
+	log.Info(ctx, "requested extraction completed", logData)
+}
+
+// Close stops any more extractions being requested, and cancels the extractions in progress between rows. It
+// returns once they have stopped, or with an error if the context is done first.
+func (extractor *Extractor) Close(ctx context.Context) error {
+	extractor.mutex.Lock()
+	extractor.closed = true
+	extractor.mutex.Unlock()
+
+	extractor.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		extractor.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,198 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/admin"
+	"github.com/ONSdigital/dp-observation-extractor/event"
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const extractionBody = `{"instance_id":"1234","file_url":"s3://some-bucket/some-file"}`
+
+func TestExtractor(t *testing.T) {
+	Convey("Given an extractor", t, func() {
+		handler := newBlockingHandler()
+		registry := jobs.NewRegistry(10)
+		extractor := admin.NewExtractor(handler, registry)
+
+		Convey("When an extraction is requested", func() {
+			recorder := postBody(extractor.Handler, extractionBody)
+
+			Convey("Then the queued job is returned with its location", func() {
+				So(recorder.Code, ShouldEqual, http.StatusAccepted)
+				So(recorder.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+				var job jobs.Job
+				So(json.Unmarshal(recorder.Body.Bytes(), &job), ShouldBeNil)
+				So(job.ID, ShouldNotBeEmpty)
+				So(job.InstanceID, ShouldEqual, "1234")
+				So(job.FileURL, ShouldEqual, "s3://some-bucket/some-file")
+				So(job.Status, ShouldEqual, jobs.StatusQueued)
+				So(recorder.Header().Get("Location"), ShouldEqual, "/extractions/"+job.ID)
+			})
+
+			Convey("And the event is handled in the background with the job's ID", func() {
+				var job jobs.Job
+				So(json.Unmarshal(recorder.Body.Bytes(), &job), ShouldBeNil)
+				dimensionsInserted := <-handler.started
+				So(dimensionsInserted.InstanceID, ShouldEqual, "1234")
+				So(dimensionsInserted.FileURL, ShouldEqual, "s3://some-bucket/some-file")
+				So(dimensionsInserted.ExtractionJobID, ShouldEqual, job.ID)
+				So(dimensionsInserted.JobID, ShouldBeEmpty)
+			})
+
+			Convey("And another extraction of the instance is refused until it finishes", func() {
+				<-handler.started
+				So(postBody(extractor.Handler, extractionBody).Code, ShouldEqual, http.StatusConflict)
+			})
+
+			Convey("And when the extractor is closed", func() {
+				<-handler.started
+				err := extractor.Close(context.Background())
+
+				Convey("Then the extraction in progress is cancelled", func() {
+					So(err, ShouldBeNil)
+					So(<-handler.finished, ShouldEqual, context.Canceled)
+				})
+
+				Convey("And no more extractions can be requested", func() {
+					recorder := postBody(extractor.Handler, `{"instance_id":"5678","file_url":"s3://some-bucket/some-file"}`)
+					So(recorder.Code, ShouldEqual, http.StatusServiceUnavailable)
+				})
+			})
+		})
+
+		Convey("When an extraction is requested without a file url", func() {
+			recorder := postBody(extractor.Handler, `{"instance_id":"1234"}`)
+
+			Convey("Then the request is refused without queueing a job", func() {
+				So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+				So(registry.List(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When an extraction of a selection of rows is requested", func() {
+			recorder := postBody(extractor.Handler, `{"instance_id":"1234","file_url":"s3://some-bucket/some-file","selection":{"first_row":10,"limit":5}}`)
+
+			Convey("Then the selection is included in the event handled", func() {
+				So(recorder.Code, ShouldEqual, http.StatusAccepted)
+				dimensionsInserted := <-handler.started
+				So(dimensionsInserted.Selection, ShouldResemble, observation.Selection{FirstRow: 10, Limit: 5})
+			})
+		})
+
+		Convey("When an extraction of an invalid selection of rows is requested", func() {
+			recorder := postBody(extractor.Handler, `{"instance_id":"1234","file_url":"s3://some-bucket/some-file","selection":{"first_row":10,"last_row":5}}`)
+
+			Convey("Then the request is refused without queueing a job", func() {
+				So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+				So(registry.List(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When an extraction is requested with a body that is not JSON", func() {
+			recorder := postBody(extractor.Handler, "instance_id=1234")
+
+			Convey("Then the request is refused", func() {
+				So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			So(extractor.Close(context.Background()), ShouldBeNil)
+		})
+	})
+}
+
+func TestExtractor_Sync(t *testing.T) {
+	Convey("Given an extractor whose handler records the job it extracts", t, func() {
+		registry := jobs.NewRegistry(10)
+		handler := &jobHandler{jobs: registry}
+		extractor := admin.NewExtractor(handler, registry)
+
+		Convey("When a synchronous extraction is requested", func() {
+			recorder := postBody(extractor.Handler, `{"instance_id":"1234","file_url":"s3://some-bucket/some-file","sync":true}`)
+
+			Convey("Then the finished job is returned with its location", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+
+				var job jobs.Job
+				So(json.Unmarshal(recorder.Body.Bytes(), &job), ShouldBeNil)
+				So(job.ID, ShouldNotBeEmpty)
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+				So(job.RowsEmitted, ShouldEqual, 2)
+				So(job.EndTime, ShouldNotBeNil)
+				So(recorder.Header().Get("Location"), ShouldEqual, "/extractions/"+job.ID)
+			})
+		})
+
+		Convey("When a synchronous extraction that fails is requested", func() {
+			handler.err = errors.New("file not found")
+			recorder := postBody(extractor.Handler, `{"instance_id":"1234","file_url":"s3://some-bucket/some-file","sync":true}`)
+
+			Convey("Then the failed job is returned", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+
+				var job jobs.Job
+				So(json.Unmarshal(recorder.Body.Bytes(), &job), ShouldBeNil)
+				So(job.Status, ShouldEqual, jobs.StatusFailed)
+				So(job.Error, ShouldEqual, "file not found")
+			})
+		})
+
+		Reset(func() {
+			So(extractor.Close(context.Background()), ShouldBeNil)
+		})
+	})
+}
+
+func postBody(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/extractions", strings.NewReader(body)))
+	return recorder
+}
+
+// blockingHandler signals when it starts handling an event, and then handles it until its context is done.
+type blockingHandler struct {
+	started  chan *event.DimensionsInserted
+	finished chan error
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started:  make(chan *event.DimensionsInserted, 1),
+		finished: make(chan error, 1),
+	}
+}
+
+func (handler *blockingHandler) Handle(ctx context.Context, dimensionsInserted *event.DimensionsInserted) error {
+	handler.started <- dimensionsInserted
+	<-ctx.Done()
+	handler.finished <- ctx.Err()
+	return ctx.Err()
+}
+
+// jobHandler records the progress of each event against its job, in the same way as event.CSVHandler.
+type jobHandler struct {
+	jobs *jobs.Registry
+	err  error
+}
+
+func (handler *jobHandler) Handle(ctx context.Context, dimensionsInserted *event.DimensionsInserted) error {
+	id, err := handler.jobs.Start(dimensionsInserted.ExtractionJobID, dimensionsInserted.InstanceID, dimensionsInserted.FileURL, dimensionsInserted.JobID, !dimensionsInserted.Selection.IsZero())
+	if err != nil {
+		return err
+	}
+	handler.jobs.SetRowsEmitted(id, 2)
+	handler.jobs.Finish(id, handler.err)
+	return handler.err
+}
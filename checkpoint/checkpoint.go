@@ -0,0 +1,118 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidInstanceID is returned when an instance ID cannot be used as a checkpoint file name.
+var ErrInvalidInstanceID = errors.New("invalid instance id for checkpoint")
+
+// Checkpoint records the progress of extraction for a single instance, from the file at FileURL.
+type Checkpoint struct {
+	FileURL      string `json:"file_url,omitempty"`
+	RowIndex     int64  `json:"row_index"`
+	RowsWritten  int64  `json:"rows_written"`
+	BytesWritten int64  `json:"bytes_written"`
+}
+
+// Store persists checkpoints for each instance, so that extraction can be resumed after a restart.
+type Store interface {
+	Get(ctx context.Context, instanceID string) (*Checkpoint, error)
+	Set(ctx context.Context, instanceID string, checkpoint Checkpoint) error
+	Delete(ctx context.Context, instanceID string) error
+}
+
+var _ Store = (*FileStore)(nil)
+
+// FileStore is a Store that keeps a JSON file for each instance in a local directory.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a new FileStore using the given directory, which is created if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Get returns the checkpoint for the given instance, or nil if there is no checkpoint.
+func (store *FileStore) Get(ctx context.Context, instanceID string) (*Checkpoint, error) {
+	path, err := store.path(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	b, err := os.ReadFile(path) // #nosec G304 -- path is validated to be within the store directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{}
+	if err = json.Unmarshal(b, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %s: %w", path, err)
+	}
+	return checkpoint, nil
+}
+
+// Set stores the checkpoint for the given instance. The file is replaced atomically, so that a checkpoint
+// is never partially written if the service is stopped.
+func (store *FileStore) Set(ctx context.Context, instanceID string, checkpoint Checkpoint) error {
+	path, err := store.path(instanceID)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Delete removes the checkpoint for the given instance, if there is one.
+func (store *FileStore) Delete(ctx context.Context, instanceID string) error {
+	path, err := store.path(instanceID)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the checkpoint file path for the given instance.
+func (store *FileStore) path(instanceID string) (string, error) {
+	if instanceID == "" || instanceID == "." || instanceID == ".." || strings.ContainsAny(instanceID, `/\`) {
+		return "", ErrInvalidInstanceID
+	}
+	return filepath.Join(store.dir, instanceID+".json"), nil
+}
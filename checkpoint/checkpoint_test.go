@@ -0,0 +1,74 @@
+package checkpoint_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/checkpoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+const instanceID = "7a8d2ebe-2b7a-4bf5-a4f0-3c1c7c0d1b7e"
+
+func TestFileStore(t *testing.T) {
+	Convey("Given a file store in an empty directory", t, func() {
+		dir := filepath.Join(t.TempDir(), "checkpoints")
+		store, err := checkpoint.NewFileStore(dir)
+		So(err, ShouldBeNil)
+
+		Convey("When Get is called for an instance without a checkpoint", func() {
+			cp, err := store.Get(ctx, instanceID)
+
+			Convey("Then no checkpoint or error is returned", func() {
+				So(err, ShouldBeNil)
+				So(cp, ShouldBeNil)
+			})
+		})
+
+		Convey("When a checkpoint is set", func() {
+			expected := checkpoint.Checkpoint{FileURL: "s3://bucket/file.csv", RowIndex: 20000, RowsWritten: 19999, BytesWritten: 1234567}
+			So(store.Set(ctx, instanceID, expected), ShouldBeNil)
+
+			Convey("Then the checkpoint is returned by a new store using the same directory", func() {
+				reopened, err := checkpoint.NewFileStore(dir)
+				So(err, ShouldBeNil)
+				cp, err := reopened.Get(ctx, instanceID)
+				So(err, ShouldBeNil)
+				So(*cp, ShouldResemble, expected)
+			})
+
+			Convey("Then no temporary files are left behind", func() {
+				entries, err := os.ReadDir(dir)
+				So(err, ShouldBeNil)
+				So(len(entries), ShouldEqual, 1)
+				So(entries[0].Name(), ShouldEqual, instanceID+".json")
+			})
+
+			Convey("And the checkpoint is deleted", func() {
+				So(store.Delete(ctx, instanceID), ShouldBeNil)
+
+				Convey("Then Get returns no checkpoint", func() {
+					cp, err := store.Get(ctx, instanceID)
+					So(err, ShouldBeNil)
+					So(cp, ShouldBeNil)
+				})
+
+				Convey("Then deleting it again does not return an error", func() {
+					So(store.Delete(ctx, instanceID), ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When an instance ID containing a path separator is used", func() {
+			err := store.Set(ctx, "../other", checkpoint.Checkpoint{RowIndex: 1})
+
+			Convey("Then an invalid instance ID error is returned", func() {
+				So(err, ShouldEqual, checkpoint.ErrInvalidInstanceID)
+			})
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package checkpointtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ONSdigital/dp-observation-extractor/checkpoint"
+)
+
+var _ checkpoint.Store = (*Store)(nil)
+
+// Store is an in-memory checkpoint store, which keeps every checkpoint set for later assertions.
+type Store struct {
+	mu          sync.Mutex
+	checkpoints map[string]checkpoint.Checkpoint
+	History     []checkpoint.Checkpoint
+	Deleted     []string
+}
+
+// NewStore returns a new in-memory checkpoint store.
+func NewStore() *Store {
+	return &Store{
+		checkpoints: make(map[string]checkpoint.Checkpoint),
+	}
+}
+
+// Get returns the checkpoint for the given instance, or nil if there is no checkpoint.
+func (store *Store) Get(ctx context.Context, instanceID string) (*checkpoint.Checkpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	cp, ok := store.checkpoints[instanceID]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+// Set stores the checkpoint for the given instance.
+func (store *Store) Set(ctx context.Context, instanceID string, cp checkpoint.Checkpoint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.checkpoints[instanceID] = cp
+	store.History = append(store.History, cp)
+	return nil
+}
+
+// Delete removes the checkpoint for the given instance.
+func (store *Store) Delete(ctx context.Context, instanceID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.checkpoints, instanceID)
+	store.Deleted = append(store.Deleted, instanceID)
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"syscall"
 
 	"github.com/ONSdigital/dp-observation-extractor/config"
+	"github.com/ONSdigital/dp-observation-extractor/extract"
 	"github.com/ONSdigital/dp-observation-extractor/initialise"
 	"github.com/ONSdigital/dp-observation-extractor/service"
 	"github.com/ONSdigital/log.go/v2/log"
@@ -25,6 +26,21 @@ func main() {
 	log.Namespace = "dp-observation-extractor"
 	ctx := context.Background()
 
+	if len(os.Args) > 1 && os.Args[1] == "extract" {
+		// logs are written to stderr, so that observations can be written to stdout
+		log.SetDestination(os.Stderr, os.Stderr)
+		opts, err := extract.ParseArgs(os.Args[2:], os.Stderr)
+		if err != nil {
+			log.Error(ctx, "invalid extract arguments", err)
+			os.Exit(2)
+		}
+		if err = extract.Run(ctx, *opts); err != nil {
+			log.Error(ctx, "error extracting observations", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	config, err := config.Get()
 	if err != nil {
 		log.Error(ctx, "error getting config", err)
@@ -44,7 +60,11 @@ func main() {
 	// serviceList keeps track of what dependency services have been initialised
 	serviceList := initialise.ExternalServiceList{}
 
-	err = service.Run(ctx, config, serviceList, signals, errorChannel, BuildTime, GitCommit, Version)
+	if len(os.Args) > 1 && os.Args[1] == "replay-dead-letters" {
+		err = service.ReplayDeadLetters(ctx, config, serviceList, signals)
+	} else {
+		err = service.Run(ctx, config, serviceList, signals, errorChannel, BuildTime, GitCommit, Version)
+	}
 	if err != nil {
 		log.Error(ctx, "error running service", err)
 		os.Exit(1)
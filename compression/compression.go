@@ -0,0 +1,104 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format represents the compression format of a file.
+type Format string
+
+// Supported compression formats
+const (
+	None  Format = "none"
+	Gzip  Format = "gzip"
+	Zstd  Format = "zstd"
+	Bzip2 Format = "bzip2"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+var contentEncodings = map[string]Format{
+	"gzip":    Gzip,
+	"x-gzip":  Gzip,
+	"zstd":    Zstd,
+	"bzip2":   Bzip2,
+	"x-bzip2": Bzip2,
+}
+
+var extensions = map[string]Format{
+	".gz":   Gzip,
+	".gzip": Gzip,
+	".zst":  Zstd,
+	".zstd": Zstd,
+	".bz2":  Bzip2,
+}
+
+// Detect returns the compression format of a file, using its Content-Encoding if set, otherwise the extension of
+// its key. If neither identify a format then the first bytes of the given reader are checked for a known magic number.
+// The returned reader must be used in place of the given one, as it includes any bytes peeked at during detection.
+func Detect(reader io.Reader, key, contentEncoding string) (Format, io.Reader, error) {
+	if format, ok := contentEncodings[strings.ToLower(strings.TrimSpace(contentEncoding))]; ok {
+		return format, reader, nil
+	}
+
+	if format, ok := extensions[strings.ToLower(path.Ext(key))]; ok {
+		return format, reader, nil
+	}
+
+	buffered := bufio.NewReader(reader)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return None, buffered, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return Gzip, buffered, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return Zstd, buffered, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return Bzip2, buffered, nil
+	default:
+		return None, buffered, nil
+	}
+}
+
+// NewReader returns a reader that decompresses the given reader according to its detected format, along with the
+// format itself. Closing the returned reader releases the decompressor but does not close the given reader.
+func NewReader(reader io.Reader, key, contentEncoding string) (io.ReadCloser, Format, error) {
+	format, reader, err := Detect(reader, key, contentEncoding)
+	if err != nil {
+		return nil, format, err
+	}
+
+	switch format {
+	case Gzip:
+		gzipReader, gzipErr := gzip.NewReader(reader)
+		if gzipErr != nil {
+			return nil, format, gzipErr
+		}
+		return gzipReader, format, nil
+	case Zstd:
+		zstdReader, zstdErr := zstd.NewReader(reader)
+		if zstdErr != nil {
+			return nil, format, zstdErr
+		}
+		return zstdReader.IOReadCloser(), format, nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(reader)), format, nil
+	default:
+		return io.NopCloser(reader), format, nil
+	}
+}
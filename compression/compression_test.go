@@ -0,0 +1,133 @@
+package compression_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/compression"
+	"github.com/klauspost/compress/zstd"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const content = "hello, world\n"
+
+// bzip2 compressed content, as there is no bzip2 writer in the standard library.
+const bzip2Hex = "425a683931415926535954a49784000002d180001040040644908020003100302068620049d4b21f3f17724538509054a49784"
+
+func gzipContent(c C) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(content))
+	c.So(err, ShouldBeNil)
+	c.So(writer.Close(), ShouldBeNil)
+	return buf.Bytes()
+}
+
+func zstdContent(c C) []byte {
+	var buf bytes.Buffer
+	writer, err := zstd.NewWriter(&buf)
+	c.So(err, ShouldBeNil)
+	_, err = writer.Write([]byte(content))
+	c.So(err, ShouldBeNil)
+	c.So(writer.Close(), ShouldBeNil)
+	return buf.Bytes()
+}
+
+func bzip2Content(c C) []byte {
+	b, err := hex.DecodeString(bzip2Hex)
+	c.So(err, ShouldBeNil)
+	return b
+}
+
+func TestDetect(t *testing.T) {
+	Convey("Given an uncompressed reader", t, func() {
+		Convey("When the Content-Encoding is set", func() {
+			format, _, err := compression.Detect(strings.NewReader(content), "file.csv", "x-gzip")
+
+			Convey("Then the format is taken from the Content-Encoding", func() {
+				So(err, ShouldBeNil)
+				So(format, ShouldEqual, compression.Gzip)
+			})
+		})
+
+		Convey("When the key has a known extension", func() {
+			format, _, err := compression.Detect(strings.NewReader(content), "dir/file.csv.BZ2", "identity")
+
+			Convey("Then the format is taken from the extension", func() {
+				So(err, ShouldBeNil)
+				So(format, ShouldEqual, compression.Bzip2)
+			})
+		})
+
+		Convey("When there is no Content-Encoding or known extension", func() {
+			format, reader, err := compression.Detect(strings.NewReader(content), "file.csv", "")
+
+			Convey("Then no compression is detected and the returned reader has the full content", func() {
+				So(err, ShouldBeNil)
+				So(format, ShouldEqual, compression.None)
+				b, err := io.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, content)
+			})
+		})
+	})
+
+	Convey("Given readers with compressed content and no other hints", t, func(c C) {
+		testCases := map[compression.Format][]byte{
+			compression.Gzip:  gzipContent(c),
+			compression.Zstd:  zstdContent(c),
+			compression.Bzip2: bzip2Content(c),
+		}
+
+		for expected, compressed := range testCases {
+			Convey("When Detect is called for "+string(expected), func() {
+				format, _, err := compression.Detect(bytes.NewReader(compressed), "file", "")
+
+				Convey("Then the format is detected from the magic bytes", func() {
+					So(err, ShouldBeNil)
+					So(format, ShouldEqual, expected)
+				})
+			})
+		}
+	})
+}
+
+func TestNewReader(t *testing.T) {
+	Convey("Given compressed and uncompressed content", t, func(c C) {
+		testCases := map[compression.Format][]byte{
+			compression.None:  []byte(content),
+			compression.Gzip:  gzipContent(c),
+			compression.Zstd:  zstdContent(c),
+			compression.Bzip2: bzip2Content(c),
+		}
+
+		for expected, compressed := range testCases {
+			Convey("When NewReader is called for "+string(expected), func() {
+				reader, format, err := compression.NewReader(bytes.NewReader(compressed), "file", "")
+				So(err, ShouldBeNil)
+				defer reader.Close()
+
+				Convey("Then the decompressed content is returned", func() {
+					So(format, ShouldEqual, expected)
+					b, err := io.ReadAll(reader)
+					So(err, ShouldBeNil)
+					So(string(b), ShouldEqual, content)
+				})
+			})
+		}
+	})
+
+	Convey("Given uncompressed content with a gzip extension", t, func() {
+		Convey("When NewReader is called", func() {
+			_, _, err := compression.NewReader(strings.NewReader(content), "file.csv.gz", "")
+
+			Convey("Then a gzip header error is returned", func() {
+				So(err, ShouldEqual, gzip.ErrHeader)
+			})
+		})
+	})
+}
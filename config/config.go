@@ -12,20 +12,79 @@ import (
 // KafkaTLSProtocolFlag informs service to use TLS protocol for kafka
 const KafkaTLSProtocolFlag = "TLS"
 
+// Possible values for the bad row policy
+const (
+	BadRowPolicyFail = "fail"
+	BadRowPolicySkip = "skip"
+	BadRowPolicyPass = "pass"
+)
+
+// Possible values for the bucket policy
+const (
+	BucketPolicyAllowList = "allow-list"
+	BucketPolicyDenyList  = "deny-list"
+)
+
+// Possible values for the file sources, which are the schemes of the file urls that can be read from
+const (
+	FileSourceS3    = "s3"
+	FileSourceFile  = "file"
+	FileSourceHTTP  = "http"
+	FileSourceHTTPS = "https"
+)
+
+// Possible values for the output sink, which observation extracted events are written to
+const (
+	OutputSinkKafka  = "kafka"
+	OutputSinkFile   = "file"
+	OutputSinkStdout = "stdout"
+)
+
+// Possible values for the output format, used when the output sink is not kafka
+const (
+	OutputFormatNDJSON = "ndjson"
+	OutputFormatAvro   = "avro"
+	OutputFormatRaw    = "raw"
+)
+
 // Config values for the application.
 type Config struct {
-	BindAddr                string        `envconfig:"BIND_ADDR"`
-	AWSRegion               string        `envconfig:"AWS_REGION"`
-	BucketNames             []string      `envconfig:"BUCKET_NAMES"                   json:"-"`
-	LocalstackHost          string        `envconfig:"LOCALSTACK_HOST"`
-	EncryptionDisabled      bool          `envconfig:"ENCRYPTION_DISABLED"`
-	GracefulShutdownTimeout time.Duration `envconfig:"GRACEFUL_SHUTDOWN_TIMEOUT"`
-	HealthCheckInterval     time.Duration `envconfig:"HEALTHCHECK_INTERVAL"`
-	HealthCriticalTimeout   time.Duration `envconfig:"HEALTHCHECK_CRITICAL_TIMEOUT"`
-	KafkaConfig             KafkaConfig
-	VaultAddr               string `envconfig:"VAULT_ADDR"`
-	VaultToken              string `envconfig:"VAULT_TOKEN"                           json:"-"`
-	VaultPath               string `envconfig:"VAULT_PATH"`
+	BindAddr                 string        `envconfig:"BIND_ADDR"`
+	AdminAuthToken           string        `envconfig:"ADMIN_AUTH_TOKEN"               json:"-"`
+	AWSRegion                string        `envconfig:"AWS_REGION"`
+	BadRowPolicy             string        `envconfig:"BAD_ROW_POLICY"`
+	BucketNames              []string      `envconfig:"BUCKET_NAMES"                   json:"-"`
+	BucketPolicy             string        `envconfig:"BUCKET_POLICY"`
+	BucketPolicyList         []string      `envconfig:"BUCKET_POLICY_LIST"             json:"-"`
+	CheckpointDir            string        `envconfig:"CHECKPOINT_DIR"`
+	CheckpointInterval       int64         `envconfig:"CHECKPOINT_INTERVAL"`
+	LocalstackHost           string        `envconfig:"LOCALSTACK_HOST"`
+	MaxObjectSize            int64         `envconfig:"MAX_OBJECT_SIZE"`
+	EncryptionDisabled       bool          `envconfig:"ENCRYPTION_DISABLED"`
+	EventMaxAttempts         int           `envconfig:"EVENT_MAX_ATTEMPTS"`
+	FileSources              []string      `envconfig:"FILE_SOURCES"`
+	GracefulShutdownTimeout  time.Duration `envconfig:"GRACEFUL_SHUTDOWN_TIMEOUT"`
+	HealthCheckInterval      time.Duration `envconfig:"HEALTHCHECK_INTERVAL"`
+	HealthCriticalTimeout    time.Duration `envconfig:"HEALTHCHECK_CRITICAL_TIMEOUT"`
+	KafkaConfig              KafkaConfig
+	ObservationBatchSize     int           `envconfig:"OBSERVATION_BATCH_SIZE"`
+	ObservationBatchMaxBytes int64         `envconfig:"OBSERVATION_BATCH_MAX_BYTES"`
+	ObservationMaxInFlight   int           `envconfig:"OBSERVATION_MAX_IN_FLIGHT"`
+	OutputSink               string        `envconfig:"OUTPUT_SINK"`
+	OutputFormat             string        `envconfig:"OUTPUT_FORMAT"`
+	OutputDir                string        `envconfig:"OUTPUT_DIR"`
+	OutputFileMaxBytes       int64         `envconfig:"OUTPUT_FILE_MAX_BYTES"`
+	JobHistorySize           int           `envconfig:"JOB_HISTORY_SIZE"`
+	RetryMaxAttempts         int           `envconfig:"RETRY_MAX_ATTEMPTS"`
+	RetryBaseDelay           time.Duration `envconfig:"RETRY_BASE_DELAY"`
+	RetryMaxDelay            time.Duration `envconfig:"RETRY_MAX_DELAY"`
+	RetryJitter              float64       `envconfig:"RETRY_JITTER"`
+	SchemaRegistryURL        string        `envconfig:"SCHEMA_REGISTRY_URL"`
+	URLAllowRules            []string      `envconfig:"URL_ALLOW_RULES"                json:"-"`
+	URLDenyRules             []string      `envconfig:"URL_DENY_RULES"                 json:"-"`
+	VaultAddr                string        `envconfig:"VAULT_ADDR"`
+	VaultToken               string        `envconfig:"VAULT_TOKEN"                           json:"-"`
+	VaultPath                string        `envconfig:"VAULT_PATH"`
 }
 
 // KafkaConfig contains the config required to connect to Kafka
@@ -33,12 +92,16 @@ type KafkaConfig struct {
 	Brokers                  []string `envconfig:"KAFKA_ADDR"                         json:"-"`
 	Version                  string   `envconfig:"KAFKA_VERSION"`
 	OffsetOldest             bool     `envconfig:"KAFKA_OFFSET_OLDEST"`
+	NumWorkers               int      `envconfig:"KAFKA_NUM_WORKERS"`
 	SecProtocol              string   `envconfig:"KAFKA_SEC_PROTO"`
 	SecCACerts               string   `envconfig:"KAFKA_SEC_CA_CERTS"`
 	SecClientKey             string   `envconfig:"KAFKA_SEC_CLIENT_KEY"               json:"-"`
 	SecClientCert            string   `envconfig:"KAFKA_SEC_CLIENT_CERT"`
 	SecSkipVerify            bool     `envconfig:"KAFKA_SEC_SKIP_VERIFY"`
+	DeadLetterConsumerGroup  string   `envconfig:"DEAD_LETTER_CONSUMER_GROUP"`
+	DeadLetterProducerTopic  string   `envconfig:"DEAD_LETTER_PRODUCER_TOPIC"`
 	ErrorProducerTopic       string   `envconfig:"ERROR_PRODUCER_TOPIC"`
+	ExtractionCompleteTopic  string   `envconfig:"EXTRACTION_COMPLETE_PRODUCER_TOPIC"`
 	FileConsumerGroup        string   `envconfig:"FILE_CONSUMER_GROUP"`
 	FileConsumerTopic        string   `envconfig:"FILE_CONSUMER_TOPIC"`
 	ObservationProducerTopic string   `envconfig:"OBSERVATION_PRODUCER_TOPIC"`
@@ -47,29 +110,57 @@ type KafkaConfig struct {
 func getDefaultConfig() *Config {
 	return &Config{
 		BindAddr:                ":21600",
+		AdminAuthToken:          "",
 		AWSRegion:               "eu-west-1",
+		BadRowPolicy:            BadRowPolicyFail,
 		BucketNames:             []string{"dp-frontend-florence-file-uploads"},
+		BucketPolicy:            BucketPolicyAllowList,
+		BucketPolicyList:        []string{},
+		CheckpointDir:           "",
+		CheckpointInterval:      10000,
 		EncryptionDisabled:      false,
+		EventMaxAttempts:        1,
+		FileSources:             []string{FileSourceS3},
 		GracefulShutdownTimeout: time.Second * 5,
 		HealthCheckInterval:     30 * time.Second,
 		HealthCriticalTimeout:   90 * time.Second,
+		MaxObjectSize:           0,
 		KafkaConfig: KafkaConfig{
 			Brokers:                  []string{"localhost:9092", "localhost:9093", "localhost:9094"},
 			Version:                  "1.0.2",
 			OffsetOldest:             true,
+			NumWorkers:               1,
 			SecProtocol:              "",
 			SecCACerts:               "",
 			SecClientCert:            "",
 			SecClientKey:             "",
 			SecSkipVerify:            false,
+			DeadLetterConsumerGroup:  "dimensions-inserted-dead-letter-replay",
+			DeadLetterProducerTopic:  "dimensions-inserted-dead-letter",
 			ErrorProducerTopic:       "report-events",
+			ExtractionCompleteTopic:  "observations-extraction-complete",
 			FileConsumerGroup:        "dimensions-inserted",
 			FileConsumerTopic:        "dimensions-inserted",
 			ObservationProducerTopic: "observation-extracted",
 		},
-		VaultAddr:  "http://localhost:8200",
-		VaultToken: "",
-		VaultPath:  "secret/shared/psk",
+		ObservationBatchSize:     1,
+		ObservationBatchMaxBytes: 900 * 1024,
+		ObservationMaxInFlight:   10000,
+		OutputSink:               OutputSinkKafka,
+		OutputFormat:             OutputFormatNDJSON,
+		OutputDir:                "",
+		OutputFileMaxBytes:       100 * 1024 * 1024,
+		JobHistorySize:           100,
+		RetryMaxAttempts:         3,
+		RetryBaseDelay:           200 * time.Millisecond,
+		RetryMaxDelay:            10 * time.Second,
+		RetryJitter:              0.2,
+		SchemaRegistryURL:        "",
+		URLAllowRules:            []string{},
+		URLDenyRules:             []string{},
+		VaultAddr:                "http://localhost:8200",
+		VaultToken:               "",
+		VaultPath:                "secret/shared/psk",
 	}
 }
 
@@ -85,6 +176,10 @@ func Get() (*Config, error) {
 		return nil, fmt.Errorf("kafka config validation errors: %v", strings.Join(errs, ", "))
 	}
 
+	if errs := cfg.validate(); len(errs) != 0 {
+		return nil, fmt.Errorf("config validation errors: %v", strings.Join(errs, ", "))
+	}
+
 	return cfg, nil
 }
 
@@ -23,29 +23,57 @@ func TestSpec(t *testing.T) {
 			Convey("The values should be set to the expected defaults", func() {
 				So(*cfg, ShouldResemble, config.Config{
 					BindAddr:                ":21600",
+					AdminAuthToken:          "",
 					AWSRegion:               "eu-west-1",
+					BadRowPolicy:            "fail",
 					BucketNames:             []string{"dp-frontend-florence-file-uploads"},
+					BucketPolicy:            "allow-list",
+					BucketPolicyList:        []string{},
+					CheckpointDir:           "",
+					CheckpointInterval:      10000,
 					EncryptionDisabled:      false,
+					EventMaxAttempts:        1,
+					FileSources:             []string{"s3"},
 					GracefulShutdownTimeout: time.Second * 5,
 					HealthCheckInterval:     30 * time.Second,
 					HealthCriticalTimeout:   90 * time.Second,
+					MaxObjectSize:           0,
 					KafkaConfig: config.KafkaConfig{
 						Brokers:                  []string{"localhost:9092", "localhost:9093", "localhost:9094"},
 						Version:                  "1.0.2",
 						OffsetOldest:             true,
+						NumWorkers:               1,
 						SecProtocol:              "",
 						SecCACerts:               "",
 						SecClientCert:            "",
 						SecClientKey:             "",
 						SecSkipVerify:            false,
+						DeadLetterConsumerGroup:  "dimensions-inserted-dead-letter-replay",
+						DeadLetterProducerTopic:  "dimensions-inserted-dead-letter",
 						ErrorProducerTopic:       "report-events",
+						ExtractionCompleteTopic:  "observations-extraction-complete",
 						FileConsumerGroup:        "dimensions-inserted",
 						FileConsumerTopic:        "dimensions-inserted",
 						ObservationProducerTopic: "observation-extracted",
 					},
-					VaultAddr:  "http://localhost:8200",
-					VaultToken: "",
-					VaultPath:  "secret/shared/psk",
+					ObservationBatchSize:     1,
+					ObservationBatchMaxBytes: 921600,
+					ObservationMaxInFlight:   10000,
+					OutputSink:               "kafka",
+					OutputFormat:             "ndjson",
+					OutputDir:                "",
+					OutputFileMaxBytes:       104857600,
+					JobHistorySize:           100,
+					RetryMaxAttempts:         3,
+					RetryBaseDelay:           200 * time.Millisecond,
+					RetryMaxDelay:            10 * time.Second,
+					RetryJitter:              0.2,
+					SchemaRegistryURL:        "",
+					URLAllowRules:            []string{},
+					URLDenyRules:             []string{},
+					VaultAddr:                "http://localhost:8200",
+					VaultToken:               "",
+					VaultPath:                "secret/shared/psk",
 				})
 			})
 		})
@@ -61,6 +89,17 @@ func TestSpec(t *testing.T) {
 				So(err, ShouldResemble, errors.New("kafka config validation errors: KAFKA_SEC_PROTO has invalid value"))
 			})
 		})
+
+		Convey("When configuration is called with an invalid bad row policy", func() {
+			defer os.Clearenv()
+			os.Setenv("BAD_ROW_POLICY", "ignore")
+			cfg, err := config.Get()
+
+			Convey("Then an error should be returned", func() {
+				So(cfg, ShouldBeNil)
+				So(err, ShouldResemble, errors.New("config validation errors: BAD_ROW_POLICY has invalid value"))
+			})
+		})
 	})
 }
 
@@ -76,28 +115,56 @@ func TestString(t *testing.T) {
 				So(cfgStr, ShouldNotContainSubstring, "Brokers")
 				So(cfgStr, ShouldNotContainSubstring, "SecClientKey")
 				So(cfgStr, ShouldNotContainSubstring, "VaultToken")
+				So(cfgStr, ShouldNotContainSubstring, "AdminAuthToken")
 				So(cfgStr, ShouldNotContainSubstring, "ServiceAuthToken")
 				So(cfgStr, ShouldNotContainSubstring, "BucketNames")
+				So(cfgStr, ShouldNotContainSubstring, "BucketPolicyList")
 
 				Convey("And should contain all non-sensitive configurations", func() {
 					So(cfgStr, ShouldContainSubstring, "BindAddr")
 					So(cfgStr, ShouldContainSubstring, "AWSRegion")
+					So(cfgStr, ShouldContainSubstring, "BadRowPolicy")
+					So(cfgStr, ShouldContainSubstring, "BucketPolicy")
+					So(cfgStr, ShouldContainSubstring, "CheckpointDir")
+					So(cfgStr, ShouldContainSubstring, "CheckpointInterval")
 					So(cfgStr, ShouldContainSubstring, "EncryptionDisabled")
+					So(cfgStr, ShouldContainSubstring, "EventMaxAttempts")
+					So(cfgStr, ShouldContainSubstring, "FileSources")
 					So(cfgStr, ShouldContainSubstring, "GracefulShutdownTimeout")
 					So(cfgStr, ShouldContainSubstring, "HealthCheckInterval")
 					So(cfgStr, ShouldContainSubstring, "HealthCriticalTimeout")
+					So(cfgStr, ShouldContainSubstring, "MaxObjectSize")
 
 					So(cfgStr, ShouldContainSubstring, "KafkaConfig")
 					So(cfgStr, ShouldContainSubstring, "Version")
+					So(cfgStr, ShouldContainSubstring, "NumWorkers")
 					So(cfgStr, ShouldContainSubstring, "SecProtocol")
 					So(cfgStr, ShouldContainSubstring, "SecCACerts")
 					So(cfgStr, ShouldContainSubstring, "SecClientCert")
 					So(cfgStr, ShouldContainSubstring, "SecSkipVerify")
+					So(cfgStr, ShouldContainSubstring, "DeadLetterConsumerGroup")
+					So(cfgStr, ShouldContainSubstring, "DeadLetterProducerTopic")
 					So(cfgStr, ShouldContainSubstring, "ErrorProducerTopic")
+					So(cfgStr, ShouldContainSubstring, "ExtractionCompleteTopic")
 					So(cfgStr, ShouldContainSubstring, "FileConsumerGroup")
 					So(cfgStr, ShouldContainSubstring, "FileConsumerTopic")
 					So(cfgStr, ShouldContainSubstring, "ObservationProducerTopic")
 
+					So(cfgStr, ShouldContainSubstring, "ObservationBatchSize")
+					So(cfgStr, ShouldContainSubstring, "ObservationBatchMaxBytes")
+					So(cfgStr, ShouldContainSubstring, "ObservationMaxInFlight")
+					So(cfgStr, ShouldContainSubstring, "OutputSink")
+					So(cfgStr, ShouldContainSubstring, "OutputFormat")
+					So(cfgStr, ShouldContainSubstring, "OutputDir")
+					So(cfgStr, ShouldContainSubstring, "OutputFileMaxBytes")
+					So(cfgStr, ShouldContainSubstring, "JobHistorySize")
+
+					So(cfgStr, ShouldContainSubstring, "RetryMaxAttempts")
+					So(cfgStr, ShouldContainSubstring, "RetryBaseDelay")
+					So(cfgStr, ShouldContainSubstring, "RetryMaxDelay")
+					So(cfgStr, ShouldContainSubstring, "RetryJitter")
+					So(cfgStr, ShouldContainSubstring, "SchemaRegistryURL")
+
 					So(cfgStr, ShouldContainSubstring, "VaultAddr")
 					So(cfgStr, ShouldContainSubstring, "VaultPath")
 				})
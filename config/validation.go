@@ -1,5 +1,111 @@
 package config
 
+import (
+	"net/url"
+
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+)
+
+func (config Config) validate() []string {
+	errs := []string{}
+
+	switch config.BadRowPolicy {
+	case BadRowPolicyFail, BadRowPolicySkip, BadRowPolicyPass:
+	default:
+		errs = append(errs, "BAD_ROW_POLICY has invalid value")
+	}
+
+	switch config.BucketPolicy {
+	case BucketPolicyAllowList, BucketPolicyDenyList:
+	default:
+		errs = append(errs, "BUCKET_POLICY has invalid value")
+	}
+
+	if config.EventMaxAttempts < 1 {
+		errs = append(errs, "EVENT_MAX_ATTEMPTS must be greater than zero")
+	}
+
+	if config.CheckpointDir != "" && config.CheckpointInterval <= 0 {
+		errs = append(errs, "CHECKPOINT_INTERVAL must be greater than zero when CHECKPOINT_DIR is set")
+	}
+
+	for _, source := range config.FileSources {
+		switch source {
+		case FileSourceS3, FileSourceFile, FileSourceHTTP, FileSourceHTTPS:
+		default:
+			errs = append(errs, "FILE_SOURCES has invalid value: "+source)
+		}
+	}
+
+	if _, err := urlpolicy.ParseRules(config.URLAllowRules); err != nil {
+		errs = append(errs, "URL_ALLOW_RULES has invalid value: "+err.Error())
+	}
+
+	if _, err := urlpolicy.ParseRules(config.URLDenyRules); err != nil {
+		errs = append(errs, "URL_DENY_RULES has invalid value: "+err.Error())
+	}
+
+	if config.MaxObjectSize < 0 {
+		errs = append(errs, "MAX_OBJECT_SIZE must not be negative")
+	}
+
+	if config.ObservationBatchSize < 1 {
+		errs = append(errs, "OBSERVATION_BATCH_SIZE must be greater than zero")
+	}
+
+	if config.ObservationBatchMaxBytes < 1 {
+		errs = append(errs, "OBSERVATION_BATCH_MAX_BYTES must be greater than zero")
+	}
+
+	if config.ObservationMaxInFlight < 1 {
+		errs = append(errs, "OBSERVATION_MAX_IN_FLIGHT must be greater than zero")
+	}
+
+	switch config.OutputSink {
+	case OutputSinkKafka, OutputSinkFile, OutputSinkStdout:
+	default:
+		errs = append(errs, "OUTPUT_SINK has invalid value")
+	}
+
+	switch config.OutputFormat {
+	case OutputFormatNDJSON, OutputFormatAvro, OutputFormatRaw:
+	default:
+		errs = append(errs, "OUTPUT_FORMAT has invalid value")
+	}
+
+	if config.OutputSink == OutputSinkFile && config.OutputDir == "" {
+		errs = append(errs, "OUTPUT_DIR must be set when OUTPUT_SINK is file")
+	}
+
+	if config.OutputFileMaxBytes < 0 {
+		errs = append(errs, "OUTPUT_FILE_MAX_BYTES must not be negative")
+	}
+
+	if config.JobHistorySize < 0 {
+		errs = append(errs, "JOB_HISTORY_SIZE must not be negative")
+	}
+
+	if config.RetryMaxAttempts < 1 {
+		errs = append(errs, "RETRY_MAX_ATTEMPTS must be greater than zero")
+	}
+
+	if config.RetryBaseDelay < 0 || config.RetryMaxDelay < config.RetryBaseDelay {
+		errs = append(errs, "RETRY_BASE_DELAY must not be negative or greater than RETRY_MAX_DELAY")
+	}
+
+	if config.RetryJitter < 0 || config.RetryJitter > 1 {
+		errs = append(errs, "RETRY_JITTER must be between 0 and 1")
+	}
+
+	if config.SchemaRegistryURL != "" {
+		if u, err := url.Parse(config.SchemaRegistryURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "SCHEMA_REGISTRY_URL must be an http or https url")
+		}
+	}
+
+	return errs
+}
+
 func (kafkaConfig KafkaConfig) validate() []string {
 	errs := []string{}
 
@@ -11,6 +117,10 @@ func (kafkaConfig KafkaConfig) validate() []string {
 		errs = append(errs, "no KAFKA_VERSION given")
 	}
 
+	if kafkaConfig.NumWorkers < 1 {
+		errs = append(errs, "KAFKA_NUM_WORKERS must be greater than zero")
+	}
+
 	if kafkaConfig.SecProtocol != "" && kafkaConfig.SecProtocol != KafkaTLSProtocolFlag {
 		errs = append(errs, "KAFKA_SEC_PROTO has invalid value")
 	}
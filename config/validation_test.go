@@ -2,10 +2,324 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+func TestValidateConfigValues(t *testing.T) {
+	Convey("Given valid configurations", t, func() {
+		cfg := getDefaultConfig()
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given an invalid BAD_ROW_POLICY", t, func() {
+		cfg := getDefaultConfig()
+		cfg.BadRowPolicy = "invalid"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"BAD_ROW_POLICY has invalid value"})
+			})
+		})
+	})
+}
+
+func TestValidateBucketPolicy(t *testing.T) {
+	Convey("Given a deny-list BUCKET_POLICY", t, func() {
+		cfg := getDefaultConfig()
+		cfg.BucketPolicy = "deny-list"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given an invalid BUCKET_POLICY", t, func() {
+		cfg := getDefaultConfig()
+		cfg.BucketPolicy = "allow-all"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"BUCKET_POLICY has invalid value"})
+			})
+		})
+	})
+}
+
+func TestValidateFileSources(t *testing.T) {
+	Convey("Given all FILE_SOURCES", t, func() {
+		cfg := getDefaultConfig()
+		cfg.FileSources = []string{"s3", "file", "http", "https"}
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given an invalid FILE_SOURCES value", t, func() {
+		cfg := getDefaultConfig()
+		cfg.FileSources = []string{"s3", "ftp"}
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"FILE_SOURCES has invalid value: ftp"})
+			})
+		})
+	})
+}
+
+func TestValidateURLPolicy(t *testing.T) {
+	Convey("Given valid URL_ALLOW_RULES and URL_DENY_RULES", t, func() {
+		cfg := getDefaultConfig()
+		cfg.URLAllowRules = []string{"uploads/datasets/**.csv"}
+		cfg.URLDenyRules = []string{"*/private/**"}
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given invalid url policy values", t, func() {
+		cfg := getDefaultConfig()
+		cfg.URLAllowRules = []string{"uploads"}
+		cfg.URLDenyRules = []string{"/key"}
+		cfg.MaxObjectSize = -1
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned for each value", func() {
+				So(errs, ShouldResemble, []string{
+					`URL_ALLOW_RULES has invalid value: invalid url policy rule "uploads": must be of the form bucket/key-glob`,
+					`URL_DENY_RULES has invalid value: invalid url policy rule "/key": must be of the form bucket/key-glob`,
+					"MAX_OBJECT_SIZE must not be negative",
+				})
+			})
+		})
+	})
+}
+
+func TestValidateEventMaxAttempts(t *testing.T) {
+	Convey("Given an invalid EVENT_MAX_ATTEMPTS", t, func() {
+		cfg := getDefaultConfig()
+		cfg.EventMaxAttempts = 0
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"EVENT_MAX_ATTEMPTS must be greater than zero"})
+			})
+		})
+	})
+}
+
+func TestValidateCheckpointValues(t *testing.T) {
+	Convey("Given a CHECKPOINT_DIR and an invalid CHECKPOINT_INTERVAL", t, func() {
+		cfg := getDefaultConfig()
+		cfg.CheckpointDir = "/tmp/checkpoints"
+		cfg.CheckpointInterval = 0
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"CHECKPOINT_INTERVAL must be greater than zero when CHECKPOINT_DIR is set"})
+			})
+		})
+	})
+
+	Convey("Given no CHECKPOINT_DIR and an invalid CHECKPOINT_INTERVAL", t, func() {
+		cfg := getDefaultConfig()
+		cfg.CheckpointInterval = 0
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned as checkpointing is disabled", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestValidateObservationValues(t *testing.T) {
+	Convey("Given invalid OBSERVATION_BATCH_SIZE, OBSERVATION_BATCH_MAX_BYTES and OBSERVATION_MAX_IN_FLIGHT", t, func() {
+		cfg := getDefaultConfig()
+		cfg.ObservationBatchSize = 0
+		cfg.ObservationBatchMaxBytes = 0
+		cfg.ObservationMaxInFlight = 0
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned for each value", func() {
+				So(errs, ShouldResemble, []string{
+					"OBSERVATION_BATCH_SIZE must be greater than zero",
+					"OBSERVATION_BATCH_MAX_BYTES must be greater than zero",
+					"OBSERVATION_MAX_IN_FLIGHT must be greater than zero",
+				})
+			})
+		})
+	})
+}
+
+func TestValidateJobHistorySize(t *testing.T) {
+	Convey("Given a negative JOB_HISTORY_SIZE", t, func() {
+		cfg := getDefaultConfig()
+		cfg.JobHistorySize = -1
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"JOB_HISTORY_SIZE must not be negative"})
+			})
+		})
+	})
+}
+
+func TestValidateOutputValues(t *testing.T) {
+	Convey("Given a file OUTPUT_SINK with an OUTPUT_DIR", t, func() {
+		cfg := getDefaultConfig()
+		cfg.OutputSink = "file"
+		cfg.OutputFormat = "avro"
+		cfg.OutputDir = "/tmp/observations"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a file OUTPUT_SINK without an OUTPUT_DIR", t, func() {
+		cfg := getDefaultConfig()
+		cfg.OutputSink = "file"
+		cfg.OutputFileMaxBytes = -1
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned for each value", func() {
+				So(errs, ShouldResemble, []string{
+					"OUTPUT_DIR must be set when OUTPUT_SINK is file",
+					"OUTPUT_FILE_MAX_BYTES must not be negative",
+				})
+			})
+		})
+	})
+
+	Convey("Given an invalid OUTPUT_SINK and OUTPUT_FORMAT", t, func() {
+		cfg := getDefaultConfig()
+		cfg.OutputSink = "s3"
+		cfg.OutputFormat = "csv"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned for each value", func() {
+				So(errs, ShouldResemble, []string{"OUTPUT_SINK has invalid value", "OUTPUT_FORMAT has invalid value"})
+			})
+		})
+	})
+}
+
+func TestValidateRetryValues(t *testing.T) {
+	Convey("Given an invalid RETRY_MAX_ATTEMPTS", t, func() {
+		cfg := getDefaultConfig()
+		cfg.RetryMaxAttempts = 0
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"RETRY_MAX_ATTEMPTS must be greater than zero"})
+			})
+		})
+	})
+
+	Convey("Given a RETRY_BASE_DELAY greater than RETRY_MAX_DELAY", t, func() {
+		cfg := getDefaultConfig()
+		cfg.RetryBaseDelay = cfg.RetryMaxDelay + time.Second
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"RETRY_BASE_DELAY must not be negative or greater than RETRY_MAX_DELAY"})
+			})
+		})
+	})
+
+	Convey("Given an invalid RETRY_JITTER", t, func() {
+		cfg := getDefaultConfig()
+		cfg.RetryJitter = 1.5
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"RETRY_JITTER must be between 0 and 1"})
+			})
+		})
+	})
+
+	Convey("Given a SCHEMA_REGISTRY_URL", t, func() {
+		cfg := getDefaultConfig()
+		cfg.SchemaRegistryURL = "http://localhost:8081"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then no error messages should be returned", func() {
+				So(errs, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a SCHEMA_REGISTRY_URL that is not an http url", t, func() {
+		cfg := getDefaultConfig()
+		cfg.SchemaRegistryURL = "localhost:8081"
+
+		Convey("When validate is called", func() {
+			errs := cfg.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"SCHEMA_REGISTRY_URL must be an http or https url"})
+			})
+		})
+	})
+}
+
 func TestValidateKafkaValues(t *testing.T) {
 	Convey("Given valid kafka configurations", t, func() {
 		cfg := getDefaultConfig()
@@ -47,6 +361,19 @@ func TestValidateKafkaValues(t *testing.T) {
 		})
 	})
 
+	Convey("Given an invalid KAFKA_NUM_WORKERS", t, func() {
+		cfg := getDefaultConfig()
+		cfg.KafkaConfig.NumWorkers = 0
+
+		Convey("When validateKafkaValues is called", func() {
+			errs := cfg.KafkaConfig.validate()
+
+			Convey("Then an error message should be returned", func() {
+				So(errs, ShouldResemble, []string{"KAFKA_NUM_WORKERS must be greater than zero"})
+			})
+		})
+	})
+
 	Convey("Given an invalid KAFKA_SEC_PROTO", t, func() {
 		cfg := getDefaultConfig()
 		cfg.KafkaConfig.SecProtocol = "invalid"
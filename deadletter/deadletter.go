@@ -0,0 +1,61 @@
+package deadletter
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// The headers set on each dead letter message, which is otherwise the original message unchanged.
+const (
+	HeaderTopic     = "dead-letter-topic"
+	HeaderError     = "dead-letter-error"
+	HeaderAttempts  = "dead-letter-attempts"
+	HeaderTimestamp = "dead-letter-timestamp"
+)
+
+// MessageSender dependency that sends messages and waits for them to be acknowledged
+type MessageSender interface {
+	Send(ctx context.Context, message *sarama.ProducerMessage) error
+}
+
+// Writer sends messages that could not be processed to the dead letter topic.
+type Writer struct {
+	sender      MessageSender
+	topic       string
+	sourceTopic string
+}
+
+// NewWriter returns a new Writer that sends messages consumed from sourceTopic to the dead letter topic.
+func NewWriter(sender MessageSender, topic, sourceTopic string) *Writer {
+	return &Writer{
+		sender:      sender,
+		topic:       topic,
+		sourceTopic: sourceTopic,
+	}
+}
+
+// Write sends the original message unchanged to the dead letter topic, with headers giving the topic it was consumed
+// from, the error that caused it to fail, the number of attempts made to process it and when it failed. It returns
+// once the message has been acknowledged, or with the context's error if it is done first.
+func (writer *Writer) Write(ctx context.Context, message []byte, cause error, attempts int) error {
+	producerMessage := &sarama.ProducerMessage{
+		Topic: writer.topic,
+		Value: sarama.ByteEncoder(message),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(HeaderTopic), Value: []byte(writer.sourceTopic)},
+			{Key: []byte(HeaderError), Value: []byte(cause.Error())},
+			{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+			{Key: []byte(HeaderTimestamp), Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+		},
+	}
+
+	if err := writer.sender.Send(ctx, producerMessage); err != nil {
+		return err
+	}
+	log.Info(ctx, "message sent to dead letter topic", log.Data{"topic": writer.topic, "error": cause.Error(), "attempts": attempts})
+	return nil
+}
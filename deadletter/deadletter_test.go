@@ -0,0 +1,162 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-kafka/v2/kafkatest"
+	"github.com/ONSdigital/dp-observation-extractor/deadletter"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/Shopify/sarama"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestWriter_Write(t *testing.T) {
+	Convey("Given a dead letter writer", t, func() {
+		sender := &fakeSender{}
+		writer := deadletter.NewWriter(sender, "dimensions-inserted-dead-letter", "dimensions-inserted")
+		original := []byte{0x00, 0x01, 0xff, 'a'}
+
+		Convey("When a message is written", func() {
+			err := writer.Write(ctx, original, errors.New("handler error"), 3)
+			So(err, ShouldBeNil)
+
+			Convey("Then the original message is sent to the dead letter topic unchanged", func() {
+				So(sender.sent, ShouldHaveLength, 1)
+				So(sender.sent[0].Topic, ShouldEqual, "dimensions-inserted-dead-letter")
+				value, err := sender.sent[0].Value.Encode()
+				So(err, ShouldBeNil)
+				So(value, ShouldResemble, original)
+			})
+
+			Convey("And the details of the failure are given in its headers", func() {
+				headers := getHeaders(sender.sent[0])
+				So(headers[deadletter.HeaderTopic], ShouldEqual, "dimensions-inserted")
+				So(headers[deadletter.HeaderError], ShouldEqual, "handler error")
+				So(headers[deadletter.HeaderAttempts], ShouldEqual, "3")
+				_, err := time.Parse(time.RFC3339Nano, headers[deadletter.HeaderTimestamp])
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the message cannot be sent", func() {
+			sendErr := errors.New("not enough replicas")
+			sender.errs = []error{sendErr}
+			err := writer.Write(ctx, original, errors.New("handler error"), 3)
+
+			Convey("Then the send error is returned", func() {
+				So(err, ShouldEqual, sendErr)
+			})
+		})
+	})
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	Convey("Given a message in the dead letter topic", t, func() {
+		original := []byte("original message")
+		message := kafkatest.NewMessage(original, 0, kafkatest.TestHeader{
+			deadletter.HeaderTopic: "dimensions-inserted",
+			deadletter.HeaderError: "handler error",
+		})
+
+		Convey("When the message is replayed", func() {
+			sender := &fakeSender{}
+			replayer := deadletter.NewReplayer(sender, "dimensions-inserted", retry.Policy{})
+			err := replayer.Replay(ctx, message)
+
+			Convey("Then the original message is sent to the topic without the dead letter headers", func() {
+				So(err, ShouldBeNil)
+				So(sender.sent, ShouldHaveLength, 1)
+				So(sender.sent[0].Topic, ShouldEqual, "dimensions-inserted")
+				So(sender.sent[0].Headers, ShouldBeEmpty)
+				value, err := sender.sent[0].Value.Encode()
+				So(err, ShouldBeNil)
+				So(value, ShouldResemble, original)
+			})
+		})
+	})
+}
+
+func TestReplayer_Consume(t *testing.T) {
+	Convey("Given a replayer whose first attempt to send a message fails", t, func() {
+		sender := &fakeSender{errs: []error{errors.New("not enough replicas")}}
+		replayer := deadletter.NewReplayer(sender, "dimensions-inserted", retry.Policy{BaseDelay: time.Millisecond})
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		message := kafkatest.NewMessage([]byte("original message"), 0)
+
+		Convey("When the message is consumed", func() {
+			replayer.Consume(ctx, messageConsumer)
+			messageConsumer.Channels().Upstream <- message
+			<-message.UpstreamDone()
+			So(replayer.Close(ctx), ShouldBeNil)
+
+			Convey("Then the message is sent again and committed once it has been sent", func() {
+				So(sender.sent, ShouldHaveLength, 2)
+				So(message.CommitAndReleaseCalls(), ShouldHaveLength, 1)
+				So(message.ReleaseCalls(), ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a replayer that cannot send messages", t, func() {
+		sender := &fakeSender{err: errors.New("not enough replicas"), sending: make(chan struct{}, 1)}
+		replayer := deadletter.NewReplayer(sender, "dimensions-inserted", retry.Policy{BaseDelay: time.Hour})
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		message := kafkatest.NewMessage([]byte("original message"), 0)
+
+		Convey("When it is closed while a message is waiting to be sent again", func() {
+			replayer.Consume(ctx, messageConsumer)
+			messageConsumer.Channels().Upstream <- message
+			<-sender.sending
+			So(replayer.Close(ctx), ShouldBeNil)
+
+			Convey("Then the message is released without being committed", func() {
+				<-message.UpstreamDone()
+				So(message.ReleaseCalls(), ShouldHaveLength, 1)
+				So(message.CommitAndReleaseCalls(), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+// fakeSender records the messages sent to it, failing with each of errs in turn and then with err. If sending is not
+// nil, it is signalled when a message is sent.
+type fakeSender struct {
+	mutex   sync.Mutex
+	sent    []*sarama.ProducerMessage
+	errs    []error
+	err     error
+	sending chan struct{}
+}
+
+func (sender *fakeSender) Send(ctx context.Context, message *sarama.ProducerMessage) error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+
+	sender.sent = append(sender.sent, message)
+	if sender.sending != nil {
+		select {
+		case sender.sending <- struct{}{}:
+		default:
+		}
+	}
+	if len(sender.errs) > 0 {
+		err := sender.errs[0]
+		sender.errs = sender.errs[1:]
+		return err
+	}
+	return sender.err
+}
+
+func getHeaders(message *sarama.ProducerMessage) map[string]string {
+	headers := make(map[string]string)
+	for _, header := range message.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	return headers
+}
@@ -0,0 +1,94 @@
+package deadletter
+
+import (
+	"context"
+
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// Producer sends messages to kafka and waits for each one to be acknowledged, so that a message is only treated as
+// sent once kafka has it. dp-kafka producers neither return successes nor set headers per message, so it uses a
+// sarama producer directly.
+type Producer struct {
+	producer sarama.AsyncProducer
+	topic    string
+	done     chan struct{}
+}
+
+// NewProducer returns a Producer that sends messages through the given producer, which must be configured to return
+// both successes and errors. The topic is only used to report errors.
+func NewProducer(producer sarama.AsyncProducer, topic string) *Producer {
+	p := &Producer{
+		producer: producer,
+		topic:    topic,
+		done:     make(chan struct{}),
+	}
+	go p.acknowledge()
+	return p
+}
+
+// Send sends the message and waits for it to be acknowledged, returning the error if kafka fails to take it. The
+// context's error is returned if it is done first, in which case the message may still be delivered.
+func (p *Producer) Send(ctx context.Context, message *sarama.ProducerMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	message.Metadata = result
+
+	select {
+	case p.producer.Input() <- message:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends any buffered messages, waits for them to be acknowledged and then closes the producer.
+func (p *Producer) Close() error {
+	p.producer.AsyncClose()
+	<-p.done
+	return nil
+}
+
+// acknowledge passes the outcome of each message acknowledged or failed by the producer to its sender, until the
+// producer has been closed.
+func (p *Producer) acknowledge() {
+	defer close(p.done)
+
+	successes, errors := p.producer.Successes(), p.producer.Errors()
+	for successes != nil || errors != nil {
+		select {
+		case message, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			resolve(message, nil)
+		case producerErr, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			metrics.ProducerErrors.WithLabelValues(p.topic).Inc()
+			log.Error(context.Background(), "kafka producer error", producerErr.Err, log.Data{"topic": p.topic})
+			resolve(producerErr.Msg, producerErr.Err)
+		}
+	}
+}
+
+// resolve passes the outcome of the message to the Send waiting for it.
+func resolve(message *sarama.ProducerMessage, err error) {
+	if result, ok := message.Metadata.(chan error); ok {
+		result <- err
+	}
+}
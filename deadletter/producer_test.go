@@ -0,0 +1,55 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/deadletter"
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProducer_Send(t *testing.T) {
+	Convey("Given a producer whose sarama producer acknowledges a message and fails the next", t, func() {
+		produceErr := errors.New("not enough replicas")
+		saramaProducer := mocks.NewAsyncProducer(t, newSaramaConfig())
+		saramaProducer.ExpectInputAndSucceed()
+		saramaProducer.ExpectInputAndFail(produceErr)
+		producer := deadletter.NewProducer(saramaProducer, "dimensions-inserted")
+
+		Convey("When the messages are sent", func() {
+			acknowledgedErr := producer.Send(ctx, &sarama.ProducerMessage{Topic: "dimensions-inserted", Value: sarama.StringEncoder("one")})
+			failedErr := producer.Send(ctx, &sarama.ProducerMessage{Topic: "dimensions-inserted", Value: sarama.StringEncoder("two")})
+
+			Convey("Then each send returns once the outcome of its message is known", func() {
+				So(acknowledgedErr, ShouldBeNil)
+				So(failedErr, ShouldEqual, produceErr)
+				So(producer.Close(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a producer", t, func() {
+		saramaProducer := mocks.NewAsyncProducer(t, newSaramaConfig())
+		producer := deadletter.NewProducer(saramaProducer, "dimensions-inserted")
+
+		Convey("When a message is sent with a context that is already done", func() {
+			cancelledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			err := producer.Send(cancelledCtx, &sarama.ProducerMessage{Topic: "dimensions-inserted", Value: sarama.StringEncoder("one")})
+
+			Convey("Then the context's error is returned", func() {
+				So(err, ShouldEqual, context.Canceled)
+				So(producer.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func newSaramaConfig() *sarama.Config {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	return config
+}
@@ -0,0 +1,98 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	kafka "github.com/ONSdigital/dp-kafka/v2"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// Replayer consumes messages from the dead letter topic and sends the original messages back to the topic they
+// were consumed from, once the cause of the failure has been fixed.
+type Replayer struct {
+	sender      MessageSender
+	topic       string
+	retryPolicy retry.Policy
+	Closing     chan bool
+	Closed      chan bool
+}
+
+// NewReplayer returns a new Replayer that sends original messages to the given topic. A message that cannot be sent
+// is sent again, waiting between attempts as retryPolicy describes, until it is sent or the replayer is closed.
+func NewReplayer(sender MessageSender, topic string, retryPolicy retry.Policy) *Replayer {
+	retryPolicy.MaxAttempts = math.MaxInt
+	return &Replayer{
+		sender:      sender,
+		topic:       topic,
+		retryPolicy: retryPolicy,
+		Closing:     make(chan bool),
+		Closed:      make(chan bool),
+	}
+}
+
+// Consume replays each message received from the dead letter consumer until the replayer is closed. Each message is
+// only committed once its original has been acknowledged. If the replayer is closed first, the message is released
+// without being committed and no more messages are taken, so that it is replayed when the replay is next run.
+func (replayer *Replayer) Consume(ctx context.Context, messageConsumer kafka.IConsumerGroup) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-replayer.Closing
+		cancel()
+	}()
+
+	go func() {
+		defer close(replayer.Closed)
+
+		for {
+			select {
+			case message := <-messageConsumer.Channels().Upstream:
+				err := retry.Do(ctx, replayer.retryPolicy, func(error) bool { return ctx.Err() == nil }, func() error {
+					return replayer.Replay(ctx, message)
+				})
+				if err != nil {
+					log.Info(ctx, "dead letter replay stopped before the message was sent - releasing message without committing")
+					message.Release()
+					return
+				}
+				message.CommitAndRelease()
+			case <-replayer.Closing:
+				log.Info(ctx, "closing dead letter replay loop")
+				return
+			}
+		}
+	}()
+}
+
+// Replay sends the original message from the given dead letter message back to its topic, without the dead letter
+// headers, and waits for it to be acknowledged.
+func (replayer *Replayer) Replay(ctx context.Context, message kafka.Message) error {
+	producerMessage := &sarama.ProducerMessage{Topic: replayer.topic, Value: sarama.ByteEncoder(message.GetData())}
+	if err := replayer.sender.Send(ctx, producerMessage); err != nil {
+		return err
+	}
+
+	log.Info(ctx, "dead letter message replayed", log.Data{
+		"topic":     replayer.topic,
+		"error":     message.GetHeader(HeaderError),
+		"attempts":  message.GetHeader(HeaderAttempts),
+		"timestamp": message.GetHeader(HeaderTimestamp),
+	})
+	return nil
+}
+
+// Close stops the replayer, waiting for the message being replayed to finish.
+func (replayer *Replayer) Close(ctx context.Context) error {
+	close(replayer.Closing)
+
+	select {
+	case <-replayer.Closed:
+		log.Info(ctx, "successfully closed dead letter replayer")
+		return nil
+	case <-ctx.Done():
+		return errors.New("shutdown context timed out")
+	}
+}
@@ -3,79 +3,337 @@ package event
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
 	kafka "github.com/ONSdigital/dp-kafka/v2"
-	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
 	"github.com/ONSdigital/dp-reporter-client/reporter"
+	"github.com/ONSdigital/go-ns/avro"
 	"github.com/ONSdigital/log.go/v2/log"
 )
 
+// The reasons that events fail, reported in metrics
+const (
+	reasonUnmarshal         = "unmarshal"
+	reasonSchemaLookup      = "schema_lookup"
+	reasonURLPolicy         = "url_policy"
+	reasonUnsupportedScheme = "unsupported_scheme"
+	reasonInvalidHeader     = "invalid_header"
+	reasonRead              = "read"
+	reasonMarshal           = "marshal"
+	reasonWrite             = "write"
+	reasonDelivery          = "delivery"
+	reasonOther             = "other"
+)
+
 // Handler represents a handler for processing a single event.
 type Handler interface {
 	Handle(ctx context.Context, event *DimensionsInserted) error
 }
 
+// DeadLetterWriter sends messages that could not be processed to a dead letter topic.
+type DeadLetterWriter interface {
+	Write(ctx context.Context, message []byte, cause error, attempts int) error
+}
+
+// SchemaRegistry looks up the schemas that messages in the schema registry wire format were written with.
+type SchemaRegistry interface {
+	GetSchema(ctx context.Context, id int) (string, error)
+}
+
+// SchemaLookupError is returned when the schema that a message was written with could not be got from the schema
+// registry.
+type SchemaLookupError struct {
+	SchemaID int
+	Err      error
+}
+
+// Error returns a description of the lookup failure.
+func (err *SchemaLookupError) Error() string {
+	return fmt.Sprintf("failed to get schema %d from schema registry: %v", err.SchemaID, err.Err)
+}
+
+// Unwrap returns the error from the schema registry.
+func (err *SchemaLookupError) Unwrap() error {
+	return err.Err
+}
+
+// Permanent returns true if the lookup will fail however many times it is made, such as for a schema that is not in
+// the registry. Lookups that fail because the registry cannot be reached may succeed later.
+func (err *SchemaLookupError) Permanent() bool {
+	return !retry.IsRetryable(err.Err)
+}
+
+// permanentError is implemented by errors that will occur however many times an event is handled.
+type permanentError interface {
+	Permanent() bool
+}
+
 // Consumer consumes event messages.
 type Consumer struct {
-	Closing chan bool
-	Closed  chan bool
+	Closing      chan bool
+	Closed       chan bool
+	numWorkers   int
+	retryPolicy  retry.Policy
+	deadLetters  DeadLetterWriter
+	schemas      SchemaRegistry
+	mutex        sync.Mutex
+	paused       bool
+	stateChanged chan struct{}
 }
 
-// NewConsumer returns a new consumer instance.
-func NewConsumer() *Consumer {
+// NewConsumer returns a new consumer instance, which handles up to numWorkers events concurrently. Each event is
+// handled up to retryPolicy.MaxAttempts times, waiting between attempts as the policy describes, or only once if it
+// fails with a permanent error. Messages that cannot be unmarshalled, or whose events fail on every attempt, are sent
+// to deadLetters unless it is nil.
+//
+// If schemas is not nil, messages in the schema registry wire format are read with the schema they were written with,
+// as looked up by its ID. Lookups that fail because of a transient registry failure are tried again, waiting between
+// attempts as retryPolicy describes, until the registry recovers or the consumer is closed. Other messages are always
+// read without the registry.
+func NewConsumer(numWorkers int, retryPolicy retry.Policy, deadLetters DeadLetterWriter, schemas SchemaRegistry) *Consumer {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if retryPolicy.MaxAttempts < 1 {
+		retryPolicy.MaxAttempts = 1
+	}
 	return &Consumer{
-		Closing: make(chan bool),
-		Closed:  make(chan bool),
+		Closing:      make(chan bool),
+		Closed:       make(chan bool),
+		numWorkers:   numWorkers,
+		retryPolicy:  retryPolicy,
+		deadLetters:  deadLetters,
+		schemas:      schemas,
+		stateChanged: make(chan struct{}),
 	}
 }
 
 // Consume convert them to event instances, and pass the event to the provided handler.
+// Each worker commits and releases its message once the event has been handled. The kafka consumer group does not
+// deliver the next message from a partition until the previous one has been released, so offsets are always committed
+// in order and the number of events handled concurrently is limited by the number of partitions assigned.
+//
+// The context passed to the handler is cancelled when the consumer is closed, so that long running events are
+// interrupted. Their messages are released without being committed, so that they are handled again after a restart.
 func (consumer *Consumer) Consume(ctx context.Context, messageConsumer kafka.IConsumerGroup, handler Handler, errorReporter reporter.ErrorReporter) {
+	ctx, cancel := context.WithCancel(ctx)
 	go func() {
-		defer close(consumer.Closed)
+		<-consumer.Closing
+		cancel()
+	}()
 
-		for {
-			select {
-			case message := <-messageConsumer.Channels().Upstream:
-
-				// In the future, the context will be obtained from the kafka message
-				msgCtx := context.Background()
-
-				// Unmarshal message
-				event, err := Unmarshal(message)
-				if err != nil {
-					log.Error(msgCtx, "message unmarshal error", err)
-					message.CommitAndRelease()
-					continue
-				}
-
-				logData := log.Data{"event": event}
-				log.Info(msgCtx, "event received", logData)
-
-				// Handle the message
-				if err = handler.Handle(ctx, event); err != nil {
-					log.Error(msgCtx, "failed to handle event", err, logData)
-					if err = errorReporter.Notify(event.InstanceID, "failed to handle event", err); err != nil {
-						log.Error(msgCtx, "errorReporter.Notify returned an unexpected error", err, logData)
-					}
-					message.CommitAndRelease()
-					continue
-				}
-
-				// On success, commit and release the message
-				log.Info(msgCtx, "event processed - committing message", logData)
-				message.CommitAndRelease()
-				log.Info(msgCtx, "message committed and kafka consumer released", logData)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < consumer.numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer.consumeLoop(ctx, messageConsumer, handler, errorReporter)
+		}()
+	}
 
+	go func() {
+		wg.Wait()
+		close(consumer.Closed)
+	}()
+}
+
+// consumeLoop handles messages one at a time until the consumer is closed. No messages are taken while the consumer
+// is paused.
+func (consumer *Consumer) consumeLoop(ctx context.Context, messageConsumer kafka.IConsumerGroup, handler Handler, errorReporter reporter.ErrorReporter) {
+	for {
+		paused, stateChanged := consumer.state()
+		if paused {
+			select {
+			case <-stateChanged:
+				continue
 			case <-consumer.Closing:
 				log.Info(ctx, "closing event consumer loop")
 				return
 			}
 		}
-	}()
+
+		select {
+		case message := <-messageConsumer.Channels().Upstream:
+			consumer.handleMessage(ctx, message, handler, errorReporter)
+		case <-stateChanged:
+		case <-consumer.Closing:
+			log.Info(ctx, "closing event consumer loop")
+			return
+		}
+	}
 }
 
-// Close safely closes the consumer and releases all resources
+// Pause stops the consumer taking any more messages. Events that are already being handled carry on until they
+// finish.
+func (consumer *Consumer) Pause() {
+	consumer.setPaused(true)
+}
+
+// Resume starts the consumer taking messages again after it has been paused.
+func (consumer *Consumer) Resume() {
+	consumer.setPaused(false)
+}
+
+// IsPaused returns true if the consumer has been paused.
+func (consumer *Consumer) IsPaused() bool {
+	paused, _ := consumer.state()
+	return paused
+}
+
+// Checker reports a warning while the consumer is paused, so that the paused state is visible in the service's health.
+func (consumer *Consumer) Checker(ctx context.Context, state *healthcheck.CheckState) error {
+	if consumer.IsPaused() {
+		return state.Update(healthcheck.StatusWarning, "event consumer is paused", 0)
+	}
+	return state.Update(healthcheck.StatusOK, "event consumer is consuming", 0)
+}
+
+// state returns whether the consumer is paused, and a channel that is closed when that changes.
+func (consumer *Consumer) state() (paused bool, stateChanged chan struct{}) {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+	return consumer.paused, consumer.stateChanged
+}
+
+// setPaused pauses or resumes the consumer, waking any workers waiting for the state to change.
+func (consumer *Consumer) setPaused(paused bool) {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+
+	if consumer.paused == paused {
+		return
+	}
+	consumer.paused = paused
+	close(consumer.stateChanged)
+	consumer.stateChanged = make(chan struct{})
+}
+
+// handleMessage unmarshals and handles a single message, then commits and releases it.
+func (consumer *Consumer) handleMessage(ctx context.Context, message kafka.Message, handler Handler, errorReporter reporter.ErrorReporter) {
+	// In the future, the context will be obtained from the kafka message
+	msgCtx := context.Background()
+
+	metrics.EventsConsumed.Inc()
+
+	// Unmarshal message
+	event, err := consumer.unmarshalWithRetry(ctx, message)
+	if err != nil && ctx.Err() != nil {
+		// The consumer was closed while waiting for the schema registry, so the message is read again after a restart
+		log.Info(msgCtx, "message unmarshal cancelled - releasing message without committing")
+		message.Release()
+		return
+	}
+	if err != nil {
+		reason := reasonUnmarshal
+		var lookupErr *SchemaLookupError
+		if errors.As(err, &lookupErr) {
+			reason = reasonSchemaLookup
+		}
+		metrics.EventsFailed.WithLabelValues(reason).Inc()
+		log.Error(msgCtx, "message unmarshal error", err)
+		consumer.deadLetterAndCommit(ctx, message, err, 1)
+		return
+	}
+
+	logData := log.Data{"event": event}
+	log.Info(msgCtx, "event received", logData)
+
+	// Handle the message, retrying with backoff up to the maximum number of attempts unless the error is permanent
+	attempts := 0
+	err = retry.Do(ctx, consumer.retryPolicy, func(err error) bool { return ctx.Err() == nil && !isPermanent(err) }, func() error {
+		attempts++
+		err := handler.Handle(ctx, event)
+		if err != nil && ctx.Err() == nil {
+			logData["attempt"] = attempts
+			log.Error(msgCtx, "failed to handle event", err, logData)
+		}
+		return err
+	})
+
+	if err != nil && ctx.Err() != nil {
+		// The event was interrupted rather than failing, so it is not reported and its offset is not committed. Any
+		// error once the consumer is closed is treated this way, as the handler may not return the context's error.
+		log.Info(msgCtx, "event handling cancelled - releasing message without committing", logData)
+		message.Release()
+		return
+	}
+
+	if err != nil {
+		metrics.EventsFailed.WithLabelValues(failureReason(err)).Inc()
+		if notifyErr := errorReporter.Notify(event.InstanceID, "failed to handle event", err); notifyErr != nil {
+			log.Error(msgCtx, "errorReporter.Notify returned an unexpected error", notifyErr, logData)
+		}
+		consumer.deadLetterAndCommit(ctx, message, err, attempts)
+		return
+	}
+
+	// On success, commit and release the message
+	log.Info(msgCtx, "event processed - committing message", logData)
+	message.CommitAndRelease()
+	log.Info(msgCtx, "message committed and kafka consumer released", logData)
+}
+
+// failureReason returns the reason an event failed with the given error, for reporting in metrics.
+func failureReason(err error) string {
+	var (
+		violation         *urlpolicy.Violation
+		unsupportedScheme *UnsupportedSchemeError
+		headerErr         *observation.HeaderError
+		readErr           *observation.ReadError
+		marshalErr        *observation.MarshalError
+		writeErr          *observation.WriteError
+		deliveryErr       *observation.DeliveryError
+	)
+
+	switch {
+	case errors.As(err, &violation):
+		return reasonURLPolicy
+	case errors.As(err, &unsupportedScheme):
+		return reasonUnsupportedScheme
+	case errors.As(err, &headerErr):
+		return reasonInvalidHeader
+	case errors.As(err, &readErr):
+		return reasonRead
+	case errors.As(err, &marshalErr):
+		return reasonMarshal
+	case errors.As(err, &writeErr):
+		return reasonWrite
+	case errors.As(err, &deliveryErr):
+		return reasonDelivery
+	default:
+		return reasonOther
+	}
+}
+
+// isPermanent returns true if the error will occur however many times the event is handled.
+func isPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent) && permanent.Permanent()
+}
+
+// deadLetterAndCommit sends the message to the dead letter writer, if there is one, and then commits and releases it.
+// If the message cannot be dead lettered, such as when the consumer is closed while the producer is stalled, it is
+// released without being committed so that it is not lost.
+func (consumer *Consumer) deadLetterAndCommit(ctx context.Context, message kafka.Message, cause error, attempts int) {
+	if consumer.deadLetters != nil {
+		if err := consumer.deadLetters.Write(ctx, message.GetData(), cause, attempts); err != nil {
+			log.Error(ctx, "failed to send message to dead letter topic - releasing message without committing", err, log.Data{"attempts": attempts})
+			message.Release()
+			return
+		}
+	}
+	message.CommitAndRelease()
+}
+
+// Close safely closes the consumer and releases all resources, waiting for any events being handled to finish
 func (consumer *Consumer) Close(ctx context.Context) (err error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -93,9 +351,52 @@ func (consumer *Consumer) Close(ctx context.Context) (err error) {
 	}
 }
 
-// Unmarshal converts a event instance to []byte.
+// Unmarshal converts the message to an event instance, whichever version of the schema it was written with.
 func Unmarshal(message kafka.Message) (*DimensionsInserted, error) {
-	var event DimensionsInserted
-	err := schema.DimensionsInsertedEvent.Unmarshal(message.GetData(), &event)
-	return &event, err
+	return UnmarshalDimensionsInserted(message.GetData())
+}
+
+// unmarshalWithRetry unmarshals the event from the message, trying again for as long as its schema cannot be looked
+// up because of a transient registry failure. The context's error is returned if it is done while waiting.
+func (consumer *Consumer) unmarshalWithRetry(ctx context.Context, message kafka.Message) (*DimensionsInserted, error) {
+	for attempt := 1; ; attempt++ {
+		event, err := consumer.unmarshal(ctx, message)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var lookupErr *SchemaLookupError
+		if !errors.As(err, &lookupErr) || lookupErr.Permanent() {
+			return event, err
+		}
+
+		delay := consumer.retryPolicy.Delay(attempt)
+		log.Warn(ctx, "unable to get message schema - retrying", log.FormatErrors([]error{err}), log.Data{"schema_id": lookupErr.SchemaID, "attempt": attempt, "delay": delay.String()})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// unmarshal converts the message to an event instance. Messages in the schema registry wire format are read with the
+// schema registered under their ID, if the consumer has a schema registry.
+func (consumer *Consumer) unmarshal(ctx context.Context, message kafka.Message) (*DimensionsInserted, error) {
+	data := message.GetData()
+	if consumer.schemas == nil || !schemaregistry.IsWireFormat(data) {
+		return UnmarshalDimensionsInserted(data)
+	}
+
+	schemaID, payload, err := schemaregistry.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	definition, err := consumer.schemas.GetSchema(ctx, schemaID)
+	if err != nil {
+		return nil, &SchemaLookupError{SchemaID: schemaID, Err: err}
+	}
+	return ResolveDimensionsInserted(&avro.Schema{Definition: definition}, payload)
 }
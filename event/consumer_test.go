@@ -2,16 +2,28 @@ package event_test
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
 	"github.com/ONSdigital/dp-kafka/v2/kafkatest"
 	"github.com/ONSdigital/dp-observation-extractor/event"
 	"github.com/ONSdigital/dp-observation-extractor/event/eventtest"
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
 	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry/schemaregistrytest"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
 
 	"errors"
 	"testing"
 
 	"github.com/ONSdigital/dp-reporter-client/reporter/reportertest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -35,7 +47,7 @@ func TestConsume_UnmarshallError(t *testing.T) {
 		}()
 
 		Convey("When consume messages is called", func() {
-			consumer := event.NewConsumer()
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 1}, nil, nil)
 			consumer.Consume(ctx, messageConsumer, handler, reporter)
 
 			// Wait for handler to receive message, and message to be successfully released
@@ -71,7 +83,7 @@ func TestConsumer_HandlerError(t *testing.T) {
 		messageConsumer.Channels().Upstream <- kafkatest.NewMessage(marshal(*expectedEvent, c), 0)
 
 		Convey("When consume is called", func() {
-			consumer := event.NewConsumer()
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 1}, nil, nil)
 			consumer.Consume(ctx, messageConsumer, handler, reporter)
 
 			waitEventsAndCloseHandler(ctx, consumer, handler, 1)
@@ -94,6 +106,171 @@ func TestConsumer_HandlerError(t *testing.T) {
 	})
 }
 
+func TestConsume_DeadLetter(t *testing.T) {
+	Convey("Given an event consumer with a dead letter writer and a maximum of 3 attempts", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		deadLetters := eventtest.NewDeadLetterWriter()
+		consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3}, deadLetters, nil)
+
+		Convey("When a message with an invalid schema is consumed", func() {
+			handler := eventtest.NewEventHandler(nil)
+			message := kafkatest.NewMessage([]byte("invalid schema"), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			<-message.UpstreamDone()
+			So(consumer.Close(ctx), ShouldBeNil)
+
+			Convey("Then the message is sent to the dead letter writer after a single attempt and committed", func() {
+				So(len(handler.Events), ShouldEqual, 0)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 1)
+				So(deadLetters.DeadLetters[0].Message, ShouldResemble, []byte("invalid schema"))
+				So(deadLetters.DeadLetters[0].Attempts, ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the handler fails on every attempt", func() {
+			handlerErr := errors.New("handler error")
+			handler := eventtest.NewEventHandler(handlerErr)
+			data := marshal(*getExampleEvent(), c)
+			message := kafkatest.NewMessage(data, 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			waitEventsAndCloseHandler(ctx, consumer, handler, 3)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is handled 3 times before the message is sent to the dead letter writer", func() {
+				So(len(handler.Events), ShouldEqual, 3)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 1)
+				So(deadLetters.DeadLetters[0].Message, ShouldResemble, data)
+				So(deadLetters.DeadLetters[0].Cause, ShouldEqual, handlerErr)
+				So(deadLetters.DeadLetters[0].Attempts, ShouldEqual, 3)
+			})
+
+			Convey("And the error is reported once and the message is committed", func() {
+				So(len(reporter.NotifyCalls()), ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestConsume_Backoff(t *testing.T) {
+	Convey("Given an event consumer with a maximum of 3 attempts and a delay between them", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		deadLetters := eventtest.NewDeadLetterWriter()
+		consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond, MaxDelay: time.Second}, deadLetters, nil)
+
+		Convey("When the handler fails on every attempt", func() {
+			handler := eventtest.NewEventHandler(errors.New("handler error"))
+			message := kafkatest.NewMessage(marshal(*getExampleEvent(), c), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			start := time.Now()
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			for i := 0; i < 3; i++ {
+				<-handler.ChHandle
+			}
+			<-message.UpstreamDone()
+			elapsed := time.Since(start)
+			So(consumer.Close(ctx), ShouldBeNil)
+
+			Convey("Then the consumer waits between attempts before dead lettering the message", func() {
+				So(len(handler.Events), ShouldEqual, 3)
+				So(elapsed, ShouldBeGreaterThanOrEqualTo, 60*time.Millisecond)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 1)
+				So(deadLetters.DeadLetters[0].Attempts, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the consumer is closed while waiting to retry", func() {
+			handler := eventtest.NewEventHandler(errors.New("handler error"))
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}, deadLetters, nil)
+			message := kafkatest.NewMessage(marshal(*getExampleEvent(), c), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			<-handler.ChHandle
+			So(consumer.Close(ctx), ShouldBeNil)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is not retried, and the message is released without being committed", func() {
+				So(len(handler.Events), ShouldEqual, 1)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 0)
+				So(len(message.ReleaseCalls()), ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestConsume_DeadLetterFailure(t *testing.T) {
+	Convey("Given an event consumer with a dead letter writer that fails to write", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		deadLetters := eventtest.NewErrorDeadLetterWriter(errors.New("producer stalled"))
+		consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3}, deadLetters, nil)
+
+		Convey("When a message with an invalid schema is consumed", func() {
+			handler := eventtest.NewEventHandler(nil)
+			message := kafkatest.NewMessage([]byte("invalid schema"), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			<-message.UpstreamDone()
+			So(consumer.Close(ctx), ShouldBeNil)
+
+			Convey("Then the message is released without being committed so that it is not lost", func() {
+				So(len(deadLetters.DeadLetters), ShouldEqual, 1)
+				So(len(message.ReleaseCalls()), ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestConsume_PermanentError(t *testing.T) {
+	Convey("Given an event consumer with a maximum of 3 attempts and a handler that fails with a permanent error", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		deadLetters := eventtest.NewDeadLetterWriter()
+		handlerErr := &urlpolicy.Violation{Bucket: "some-bucket", Key: "some-file", Reason: "does not match any allow rule"}
+		handler := eventtest.NewEventHandler(handlerErr)
+
+		message := kafkatest.NewMessage(marshal(*getExampleEvent(), c), 0)
+		messageConsumer.Channels().Upstream <- message
+
+		Convey("When consume is called", func() {
+			failedBefore := testutil.ToFloat64(metrics.EventsFailed.WithLabelValues("url_policy"))
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3}, deadLetters, nil)
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+
+			waitEventsAndCloseHandler(ctx, consumer, handler, 1)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is counted as failed by the url policy", func() {
+				So(testutil.ToFloat64(metrics.EventsFailed.WithLabelValues("url_policy"))-failedBefore, ShouldEqual, 1)
+			})
+
+			Convey("Then the event is handled once and the error is reported", func() {
+				So(len(handler.Events), ShouldEqual, 1)
+				So(len(reporter.NotifyCalls()), ShouldEqual, 1)
+				So(reporter.NotifyCalls()[0].Err, ShouldEqual, handlerErr)
+			})
+
+			Convey("And the message is sent to the dead letter writer and committed", func() {
+				So(len(deadLetters.DeadLetters), ShouldEqual, 1)
+				So(deadLetters.DeadLetters[0].Attempts, ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
 func TestConsume(t *testing.T) {
 	Convey("Given an event consumer with a valid schema", t, func(c C) {
 		reporter := reportertest.NewImportErrorReporterMock(nil)
@@ -106,7 +283,7 @@ func TestConsume(t *testing.T) {
 		messageConsumer.Channels().Upstream <- message
 
 		Convey("When consume is called", func() {
-			consumer := event.NewConsumer()
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 1}, nil, nil)
 			consumer.Consume(ctx, messageConsumer, handler, reporter)
 
 			waitEventsAndCloseHandler(ctx, consumer, handler, 1)
@@ -130,6 +307,282 @@ func TestConsume(t *testing.T) {
 	})
 }
 
+func TestConsume_Concurrent(t *testing.T) {
+	Convey("Given an event consumer with two workers and a handler that blocks until released", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		handler := newBlockingHandler()
+
+		expectedEvent := getExampleEvent()
+		message1 := kafkatest.NewMessage(marshal(*expectedEvent, c), 0)
+		message2 := kafkatest.NewMessage(marshal(*expectedEvent, c), 1)
+		go func() {
+			messageConsumer.Channels().Upstream <- message1
+			messageConsumer.Channels().Upstream <- message2
+		}()
+
+		Convey("When consume is called", func() {
+			consumer := event.NewConsumer(2, retry.Policy{MaxAttempts: 1}, nil, nil)
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+
+			Convey("Then both events are handled at the same time", func() {
+				<-handler.started
+				<-handler.started
+
+				So(len(message1.CommitAndReleaseCalls()), ShouldEqual, 0)
+				So(len(message2.CommitAndReleaseCalls()), ShouldEqual, 0)
+
+				Convey("And close waits for the in-flight events to finish before committing them", func() {
+					closeErr := make(chan error, 1)
+					go func() {
+						closeErr <- consumer.Close(ctx)
+					}()
+
+					close(handler.release)
+					So(<-closeErr, ShouldBeNil)
+					<-message1.UpstreamDone()
+					<-message2.UpstreamDone()
+					So(len(message1.CommitAndReleaseCalls()), ShouldEqual, 1)
+					So(len(message2.CommitAndReleaseCalls()), ShouldEqual, 1)
+				})
+			})
+		})
+	})
+}
+
+func TestConsume_Cancelled(t *testing.T) {
+	Convey("Given an event consumer with a maximum of 3 attempts and a handler that runs until it is cancelled", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		deadLetters := eventtest.NewDeadLetterWriter()
+		handler := newCancellableHandler()
+
+		message := kafkatest.NewMessage(marshal(*getExampleEvent(), c), 0)
+		messageConsumer.Channels().Upstream <- message
+
+		Convey("When the consumer is closed while the event is being handled", func() {
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3}, deadLetters, nil)
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+
+			<-handler.started
+			So(consumer.Close(ctx), ShouldBeNil)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is handled once and the error is not reported", func() {
+				So(handler.attempts, ShouldEqual, 1)
+				So(len(reporter.NotifyCalls()), ShouldEqual, 0)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 0)
+			})
+
+			Convey("And the message is released without being committed", func() {
+				So(len(message.ReleaseCalls()), ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the consumer is closed while the event is being handled and the handler returns a transient error", func() {
+			handler.err = errors.New("connection reset")
+			consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 3}, deadLetters, nil)
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+
+			<-handler.started
+			So(consumer.Close(ctx), ShouldBeNil)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is treated as cancelled and the message is released without being committed", func() {
+				So(handler.attempts, ShouldEqual, 1)
+				So(len(reporter.NotifyCalls()), ShouldEqual, 0)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 0)
+				So(len(message.ReleaseCalls()), ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestConsume_Paused(t *testing.T) {
+	Convey("Given a paused event consumer with a message waiting", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		handler := eventtest.NewEventHandler(nil)
+
+		message := kafkatest.NewMessage(marshal(*getExampleEvent(), c), 0)
+		messageConsumer.Channels().Upstream <- message
+
+		consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 1}, nil, nil)
+		consumer.Pause()
+
+		Convey("When consume is called", func() {
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+
+			Convey("Then the message is not handled while the consumer is paused", func() {
+				select {
+				case <-handler.ChHandle:
+					t.Error("event handled while the consumer was paused")
+				case <-time.After(50 * time.Millisecond):
+				}
+				So(consumer.IsPaused(), ShouldBeTrue)
+
+				Convey("And the event is handled once the consumer is resumed", func() {
+					consumer.Resume()
+					waitEventsAndCloseHandler(ctx, consumer, handler, 1)
+					<-message.UpstreamDone()
+					So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+				})
+			})
+		})
+
+		Convey("When the consumer is health checked", func() {
+			state := healthcheck.NewCheckState("Event Consumer")
+			So(consumer.Checker(ctx, state), ShouldBeNil)
+
+			Convey("Then a warning is reported while it is paused", func() {
+				So(state.Status(), ShouldEqual, healthcheck.StatusWarning)
+				So(state.Message(), ShouldEqual, "event consumer is paused")
+			})
+
+			Convey("And OK is reported once it is resumed", func() {
+				consumer.Resume()
+				So(consumer.Checker(ctx, state), ShouldBeNil)
+				So(state.Status(), ShouldEqual, healthcheck.StatusOK)
+			})
+		})
+	})
+
+	Convey("Given an event consumer that is handling an event", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		handler := newBlockingHandler()
+
+		message := kafkatest.NewMessage(marshal(*getExampleEvent(), c), 0)
+		messageConsumer.Channels().Upstream <- message
+
+		consumer := event.NewConsumer(1, retry.Policy{MaxAttempts: 1}, nil, nil)
+		consumer.Consume(ctx, messageConsumer, handler, reporter)
+		<-handler.started
+
+		Convey("When the consumer is paused", func() {
+			consumer.Pause()
+			close(handler.release)
+
+			Convey("Then the event finishes and its message is committed", func() {
+				<-message.UpstreamDone()
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+				So(consumer.Close(ctx), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestConsume_SchemaRegistry(t *testing.T) {
+	Convey("Given an event consumer with a schema registry holding version 1 of the event schema", t, func(c C) {
+		reporter := reportertest.NewImportErrorReporterMock(nil)
+		messageConsumer := kafkatest.NewMessageConsumer(true)
+		deadLetters := eventtest.NewDeadLetterWriter()
+		handler := eventtest.NewEventHandler(nil)
+
+		registry := schemaregistrytest.NewRegistry()
+		defer registry.Close()
+		v1, err := schema.DimensionsInsertedEventVersions.Version(1)
+		So(err, ShouldBeNil)
+		schemaID := registry.Add("dimensions-inserted-value", v1.Definition)
+		expectedEvent := getExampleEvent()
+		payload, err := v1.Marshal(dimensionsInsertedV1{FileURL: expectedEvent.FileURL, InstanceID: expectedEvent.InstanceID})
+		So(err, ShouldBeNil)
+
+		schemas := schemaregistry.NewClient(registry.URL, http.DefaultClient, retry.Policy{MaxAttempts: 1})
+		retryPolicy := retry.Policy{MaxAttempts: 1, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+		consumer := event.NewConsumer(1, retryPolicy, deadLetters, schemas)
+
+		Convey("When a message written with that schema is consumed in the wire format", func() {
+			message := kafkatest.NewMessage(schemaregistry.Encode(schemaID, payload), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			waitEventsAndCloseHandler(ctx, consumer, handler, 1)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is read with the registered schema and handled", func() {
+				So(len(handler.Events), ShouldEqual, 1)
+				So(handler.Events[0], ShouldResemble, *expectedEvent)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 0)
+				So(registry.Requests, ShouldResemble, []string{fmt.Sprintf("GET /schemas/ids/%d", schemaID)})
+			})
+		})
+
+		Convey("When a message with a schema ID that is not registered is consumed", func() {
+			data := schemaregistry.Encode(schemaID+1, payload)
+			message := kafkatest.NewMessage(data, 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			<-message.UpstreamDone()
+			So(consumer.Close(ctx), ShouldBeNil)
+
+			Convey("Then the message is sent to the dead letter writer without being handled", func() {
+				So(len(handler.Events), ShouldEqual, 0)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 1)
+				var lookupErr *event.SchemaLookupError
+				So(errors.As(deadLetters.DeadLetters[0].Cause, &lookupErr), ShouldBeTrue)
+				So(lookupErr.Permanent(), ShouldBeTrue)
+				So(deadLetters.DeadLetters[0].Message, ShouldResemble, data)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a message in the wire format is consumed while the registry cannot be reached", func() {
+			registry.Close()
+			message := kafkatest.NewMessage(schemaregistry.Encode(schemaID, payload), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			time.Sleep(50 * time.Millisecond)
+
+			Convey("Then the lookup is retried until the consumer is closed, and the message is released without being handled, dead lettered or committed", func() {
+				So(len(message.ReleaseCalls()), ShouldEqual, 0)
+				So(consumer.Close(ctx), ShouldBeNil)
+				<-message.UpstreamDone()
+				So(len(handler.Events), ShouldEqual, 0)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 0)
+				So(len(message.ReleaseCalls()), ShouldEqual, 1)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a message in the wire format is consumed while the registry cannot be reached for two lookups", func() {
+			unreachable := &unreachableRegistry{SchemaRegistry: schemas, failures: 2}
+			consumer := event.NewConsumer(1, retryPolicy, deadLetters, unreachable)
+			message := kafkatest.NewMessage(schemaregistry.Encode(schemaID, payload), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			waitEventsAndCloseHandler(ctx, consumer, handler, 1)
+			<-message.UpstreamDone()
+
+			Convey("Then the lookup is retried until the registry recovers and the event is handled and committed", func() {
+				So(unreachable.Lookups(), ShouldEqual, 3)
+				So(handler.Events[0], ShouldResemble, *expectedEvent)
+				So(len(deadLetters.DeadLetters), ShouldEqual, 0)
+				So(len(message.CommitAndReleaseCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a message that is not in the wire format is consumed", func() {
+			message := kafkatest.NewMessage(marshal(*expectedEvent, c), 0)
+			messageConsumer.Channels().Upstream <- message
+
+			consumer.Consume(ctx, messageConsumer, handler, reporter)
+			waitEventsAndCloseHandler(ctx, consumer, handler, 1)
+			<-message.UpstreamDone()
+
+			Convey("Then the event is read without the registry", func() {
+				So(handler.Events[0], ShouldResemble, *expectedEvent)
+				So(registry.RequestCount(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
 func TestToEvent(t *testing.T) {
 	Convey("Given a event schema encoded using avro", t, func(c C) {
 		expectedEvent := getExampleEvent()
@@ -147,9 +600,38 @@ func TestToEvent(t *testing.T) {
 	})
 }
 
+// unreachableRegistry is a schema registry that cannot be reached for a number of lookups, before passing lookups on
+// to the registry it wraps.
+type unreachableRegistry struct {
+	event.SchemaRegistry
+	failures int
+	lookups  int
+	mutex    sync.Mutex
+}
+
+// GetSchema fails with a refused connection until the number of failures has been reached.
+func (registry *unreachableRegistry) GetSchema(ctx context.Context, id int) (string, error) {
+	registry.mutex.Lock()
+	registry.lookups++
+	unreachable := registry.lookups <= registry.failures
+	registry.mutex.Unlock()
+
+	if unreachable {
+		return "", syscall.ECONNREFUSED
+	}
+	return registry.SchemaRegistry.GetSchema(ctx, id)
+}
+
+// Lookups returns the number of lookups that have been made.
+func (registry *unreachableRegistry) Lookups() int {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	return registry.lookups
+}
+
 // marshal helper method to marshal a event into a []byte
-func marshal(event event.DimensionsInserted, c C) []byte {
-	bytes, err := schema.DimensionsInsertedEvent.Marshal(event)
+func marshal(dimensionsInserted event.DimensionsInserted, c C) []byte {
+	bytes, err := event.MarshalDimensionsInserted(&dimensionsInserted)
 	c.So(err, ShouldBeNil)
 	return bytes
 }
@@ -175,3 +657,48 @@ func waitEventsAndCloseHandler(ctx context.Context, consumer *event.Consumer, ha
 	So(err, ShouldBeNil)
 	<-consumer.Closed
 }
+
+// blockingHandler is an event handler that signals when each event has started, and then waits to be released.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+// Handle signals that the event has started and waits until the handler is released.
+func (handler *blockingHandler) Handle(ctx context.Context, event *event.DimensionsInserted) error {
+	handler.started <- struct{}{}
+	<-handler.release
+	return nil
+}
+
+// cancellableHandler is an event handler that signals when each event has started, and then runs until its context
+// is cancelled. It then returns err, or the context's error if err is nil.
+type cancellableHandler struct {
+	started  chan struct{}
+	attempts int
+	err      error
+}
+
+func newCancellableHandler() *cancellableHandler {
+	return &cancellableHandler{
+		started: make(chan struct{}, 1),
+	}
+}
+
+// Handle signals that the event has started and waits until the context is cancelled, returning the handler's error.
+func (handler *cancellableHandler) Handle(ctx context.Context, event *event.DimensionsInserted) error {
+	handler.attempts++
+	handler.started <- struct{}{}
+	<-ctx.Done()
+	if handler.err != nil {
+		return handler.err
+	}
+	return ctx.Err()
+}
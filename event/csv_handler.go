@@ -2,145 +2,181 @@ package event
 
 import (
 	"context"
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
-	"strconv"
+	"net/url"
 
-	"github.com/ONSdigital/dp-healthcheck/healthcheck"
-	"github.com/ONSdigital/dp-observation-extractor/config"
+	"github.com/ONSdigital/dp-observation-extractor/compression"
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
 	"github.com/ONSdigital/dp-observation-extractor/observation"
-	s3client "github.com/ONSdigital/dp-s3/v3"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
 	"github.com/ONSdigital/log.go/v2/log"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsS3 "github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-//go:generate moq -out mocks/s3client.go -pkg mock . S3Client
-//go:generate moq -out mocks/vault.go -pkg mock . VaultClient
-
 // CSVHandler handles events to extract observations from CSV files.
 type CSVHandler struct {
-	AwsConfig         *aws.Config
-	s3Clients         map[string]S3Client
-	vaultClient       VaultClient
-	vaultPath         string
+	sources           map[string]FileSource
+	urlPolicy         urlpolicy.Policy
 	observationWriter ObservationWriter
+	badRowPolicy      observation.BadRowPolicy
+	jobs              JobRegistry
 }
 
-// NewCSVHandler returns a new CSVHandler instance that uses the given file.FileGetter and Output producer.
-func NewCSVHandler(awsConfig *aws.Config, s3Clients map[string]S3Client, vaultClient VaultClient, observationWriter ObservationWriter, vaultPath string) *CSVHandler {
+// NewCSVHandler returns a new CSVHandler instance that reads files using the FileSource for the scheme of each
+// event's file URL, and writes their observations to the given ObservationWriter. Only files allowed by the given
+// urlpolicy.Policy are read, whatever their scheme. The job for each event is recorded in the given JobRegistry,
+// unless it is nil.
+func NewCSVHandler(sources map[string]FileSource, urlPolicy urlpolicy.Policy, observationWriter ObservationWriter, badRowPolicy observation.BadRowPolicy, jobs JobRegistry) *CSVHandler {
 	return &CSVHandler{
-		AwsConfig:         awsConfig,
-		s3Clients:         s3Clients,
-		vaultClient:       vaultClient,
-		vaultPath:         vaultPath,
+		sources:           sources,
+		urlPolicy:         urlPolicy,
 		observationWriter: observationWriter,
+		badRowPolicy:      badRowPolicy,
+		jobs:              jobs,
 	}
 }
 
-// S3Client represents the S3 client from dp-s3 with the required methods
-type S3Client interface {
-	Get(ctx context.Context, key string) (io.ReadCloser, *int64, error)
-	GetWithPSK(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error)
-	Checker(ctx context.Context, state *healthcheck.CheckState) error
-}
-
-// VaultClient is an interface to represent methods called to action upon vault
-type VaultClient interface {
-	ReadKey(path, key string) (string, error)
-	Checker(ctx context.Context, state *healthcheck.CheckState) error
+// JobRegistry records the progress of the job extracting each instance. Start returns the ID of the job, which its
+// progress is then recorded against. An event whose extraction job ID is that of a queued job starts that job, and
+// one whose extraction job ID is that of a failed job restarts it. The job records the ID of the import job that
+// requested the extraction, if any. Start returns an error if the extraction cannot start, such as when it is a full
+// extraction of an instance that already has one in progress.
+type JobRegistry interface {
+	Start(jobID, instanceID, fileURL, importJobID string, partial bool) (string, error)
+	AddBytesRead(jobID string, bytes int64)
+	Finish(jobID string, err error)
 }
 
 // ObservationWriter provides operations for observation output.
 type ObservationWriter interface {
-	WriteAll(ctx context.Context, observationReader observation.Reader, instanceID string)
+	WriteAll(ctx context.Context, observationReader observation.Reader, extraction observation.Extraction) error
 }
 
-// Handle takes a single event, and returns the observations gathered from the URL in the event.
+// Handle takes a single event, and returns the observations gathered from the URL in the event. If the context is
+// done before every observation has been written, an *observation.CancelledError is returned with the number of rows
+// sent. The event's ExtractionJobID is set to the ID of its job, so that handling the event again after a failure
+// carries on the same job. If the job cannot be started, the error is returned without extracting anything.
 func (handler CSVHandler) Handle(ctx context.Context, event *DimensionsInserted) error {
-	url := event.FileURL
+	if handler.jobs == nil {
+		return cancelled(ctx, handler.extract(ctx, event, ""))
+	}
+
+	jobID, err := handler.jobs.Start(event.ExtractionJobID, event.InstanceID, event.FileURL, event.JobID, !event.Selection.IsZero())
+	if err != nil {
+		log.Warn(ctx, "unable to start extraction job", log.FormatErrors([]error{err}), log.Data{"instanceID": event.InstanceID})
+		return err
+	}
+	event.ExtractionJobID = jobID
+	err = cancelled(ctx, handler.extract(ctx, event, jobID))
+	handler.jobs.Finish(jobID, err)
+	return err
+}
+
+// cancelled returns an *observation.CancelledError for an extraction that failed with err once the context was done,
+// such as when a file source's retry is interrupted, so that it is recorded as cancelled rather than failed. Other
+// errors are returned as they are.
+func cancelled(ctx context.Context, err error) error {
+	var cancelledErr *observation.CancelledError
+	if err == nil || ctx.Err() == nil || errors.As(err, &cancelledErr) {
+		return err
+	}
+	return &observation.CancelledError{Err: fmt.Errorf("%w: %w", ctx.Err(), err)}
+}
 
-	logData := log.Data{"url": url, "event": event}
+// extract gets the file for the event and writes its observations, recording its progress against the job with the
+// given ID unless it is empty.
+func (handler CSVHandler) extract(ctx context.Context, event *DimensionsInserted, jobID string) error {
+	logData := log.Data{"url": event.FileURL, "event": event}
+	if err := ctx.Err(); err != nil {
+		log.Info(ctx, "event cancelled before getting file", logData)
+		return &observation.CancelledError{Err: err}
+	}
 	log.Info(ctx, "getting file", logData)
 
-	// parse the url - expected format; s3://bucket/k/e/y
-	s3Url, err := s3client.ParseURL(url, s3client.AliasVirtualHostedStyle)
+	fileURL, err := url.Parse(event.FileURL)
 	if err != nil {
-		log.Error(ctx, "unable to find bucket and filename in event file url", err, logData)
+		log.Error(ctx, "unable to parse event file url", err, logData)
 		return err
 	}
-	logData["bucket"] = s3Url.BucketName
-	logData["filename"] = s3Url.Key
 
-	// Get S3 Client corresponding to the Bucket extracted from URL, or create one if not available
-	s3, ok := handler.s3Clients[s3Url.BucketName]
-	if !ok {
-		log.Warn(ctx, "retreiving data from unexpected s3 bucket", log.Data{"RequestedBucket": s3Url.BucketName})
-		cfg, err := config.Get()
-		if err != nil {
-			log.Error(ctx, "unable to get config", err, logData)
-			return err
-		}
-
-		if cfg.LocalstackHost != "" {
-			s3 = s3client.NewClientWithConfig(s3Url.BucketName, *handler.AwsConfig, func(o *awsS3.Options) {
-				o.BaseEndpoint = aws.String(cfg.LocalstackHost)
-				o.UsePathStyle = true
-			})
-		} else {
-			s3 = s3client.NewClientWithConfig(s3Url.BucketName, *handler.AwsConfig)
-		}
+	if err = handler.urlPolicy.CheckURL(fileURL); err != nil {
+		log.Error(ctx, "event file url is not allowed by url policy", err, logData)
+		return err
 	}
 
-	var file io.ReadCloser
-	var contentLength *int64
-	if handler.vaultClient != nil {
-		vaultPath := handler.vaultPath + "/" + s3Url.Key
-		vaultKey := "key"
-		logData["vault_path"] = vaultPath
+	source, ok := handler.sources[fileURL.Scheme]
+	if !ok {
+		err = &UnsupportedSchemeError{Scheme: fileURL.Scheme}
+		log.Error(ctx, "no file source for event file url", err, logData)
+		return err
+	}
 
-		log.Info(ctx, "attempting to get psk from vault", logData)
-		pskStr, err := handler.vaultClient.ReadKey(vaultPath, vaultKey)
-		if err != nil {
+	file, err := source.Open(ctx, event.FileURL)
+	if err != nil {
+		log.Error(ctx, "unable to open file", err, logData)
+		return err
+	}
+	if file.ContentLength != nil {
+		if err = handler.urlPolicy.CheckURLSize(fileURL, *file.ContentLength); err != nil {
+			log.Error(ctx, "file is larger than allowed by url policy", err, logData)
+			file.Body.Close()
 			return err
 		}
+	}
+	body := metrics.CountBytesRead(handler.urlPolicy.LimitReader(fileURL, file.Body), fileURL.Scheme)
+	if handler.jobs != nil {
+		body = &jobBytesReader{ReadCloser: body, jobs: handler.jobs, jobID: jobID}
+	}
+	defer body.Close()
 
-		log.Info(ctx, "got psk", logData)
-		psk, err := hex.DecodeString(pskStr)
-		if err != nil {
-			return err
-		}
+	decompressed, format, err := compression.NewReader(body, file.Name, file.ContentEncoding)
+	if err != nil {
+		log.Error(ctx, "unable to decompress file", err, logData)
+		return err
+	}
+	defer decompressed.Close()
+	logData["compression"] = format
 
-		log.Info(ctx, "attempting to get S3 object with psk", logData)
+	observationReader, err := observation.NewCSVReader(decompressed, handler.badRowPolicy)
+	if err != nil {
+		log.Error(ctx, "file does not have a valid V4 header", err, logData)
+		return err
+	}
 
-		file, contentLength, err = s3.GetWithPSK(ctx, s3Url.Key, psk)
-		if err != nil {
-			log.Error(ctx, "encountered error retrieving and decrypting csv file", err, logData)
+	if !event.Selection.IsZero() {
+		logData["selection"] = event.Selection
+		if err = observationReader.Select(event.Selection); err != nil {
+			log.Error(ctx, "invalid selection of rows to extract", err, logData)
 			return err
 		}
-	} else {
-		log.Info(ctx, "attempting to get S3 object", logData)
-		file, contentLength, err = s3.Get(ctx, s3Url.Key)
-		if err != nil {
-			log.Error(ctx, "unable to retrieve s3 output object", err, logData)
+		log.Info(ctx, "extracting selected rows only", logData)
+	}
+
+	extraction := observation.Extraction{InstanceID: event.InstanceID, FileURL: event.FileURL, JobID: jobID, Partial: !event.Selection.IsZero()}
+	if err = handler.observationWriter.WriteAll(ctx, observationReader, extraction); err != nil {
+		var cancelled *observation.CancelledError
+		if errors.As(err, &cancelled) {
+			logData["rows_written"] = cancelled.RowsWritten
+			log.Info(ctx, "extraction of observations cancelled", logData)
 			return err
 		}
+		log.Error(ctx, "failed to extract all observations", err, logData)
+		return err
 	}
-	defer file.Close()
 
-	logData["content_length"] = getContentLengthStr(contentLength)
-	log.Info(ctx, "file read from s3", logData)
-
-	observationReader := observation.NewCSVReader(file)
-
-	handler.observationWriter.WriteAll(ctx, observationReader, event.InstanceID)
 	return nil
 }
 
-// getContentLengthStr returns the string representation of the provided *int64, returning '0' if it is nil
-func getContentLengthStr(cLen *int64) string {
-	if cLen == nil {
-		return "0"
-	}
-	return strconv.FormatInt(*cLen, 10)
+// jobBytesReader adds the number of bytes read to a job
+type jobBytesReader struct {
+	io.ReadCloser
+	jobs  JobRegistry
+	jobID string
+}
+
+func (reader *jobBytesReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.jobs.AddBytesRead(reader.jobID, int64(n))
+	return n, err
 }
@@ -1,15 +1,28 @@
 package event_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"io"
 	"strings"
+	"syscall"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/ONSdigital/dp-observation-extractor/event"
 	"github.com/ONSdigital/dp-observation-extractor/event/eventtest"
 	mock "github.com/ONSdigital/dp-observation-extractor/event/mocks"
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsS3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	vaultapi "github.com/hashicorp/vault/api"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -17,12 +30,19 @@ import (
 var (
 	bucket          = "some-bucket"
 	filename        = "some-file"
-	exampleHeader   = "Observation,other,stuff"
-	exampleCsvLine  = "153223,,Person,,Count,,,,,,,,,,K04000001,,,,,,,,,,,,,,,,,,,,,Sex,Sex,,All categories: Sex,All categories: Sex,,,,Age,Age,,All categories: Age 16 and over,All categories: Age 16 and over,,,,Residence Type,Residence Type,,All categories: Residence Type,All categories: Residence Type,,,"
+	exampleHeader   = "V4_1,Data_Marking,mmm-yy,time,uk-only,geography,cpih1dim1aggid,aggregate"
+	exampleCsvLine  = "117.8,,Jan-96,Jan-96,K02000001,United Kingdom,cpih1dim1A0,CPIH (overall index)"
+	invalidHeader   = "Observation,other,stuff"
 	contentLen      = int64(284)
 	errCryptoClient = errors.New("crypto client error")
 )
 
+// Retry policies, with no delay between attempts
+var (
+	noRetries    = retry.Policy{MaxAttempts: 1}
+	threeRetries = retry.Policy{MaxAttempts: 3}
+)
+
 // Vault testing vars
 var (
 	psk        = []byte("Hello World")
@@ -37,6 +57,11 @@ var funcGetValid = func(ctx context.Context, key string) (io.ReadCloser, *int64,
 	return io.NopCloser(strings.NewReader(exampleHeader + "\n" + exampleCsvLine)), &contentLen, nil
 }
 
+// S3 Get function for a file with an invalid header
+var funcGetInvalidHeader = func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
+	return io.NopCloser(strings.NewReader(invalidHeader + "\n" + exampleCsvLine)), &contentLen, nil
+}
+
 // S3 Get function for an error case
 var funcGetErr = func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
 	return nil, nil, io.EOF
@@ -52,24 +77,52 @@ var funcGetWithPskErr = func(ctx context.Context, key string, psk []byte) (io.Re
 	return nil, nil, errCryptoClient
 }
 
-// createS3MockGet creates an S3Client mock with the provided function and returns it, and the map as expected by Handler
-func createS3MockGet(funcGet func(ctx context.Context, key string) (io.ReadCloser, *int64, error)) (s3cli *mock.S3ClientMock, s3Clients map[string]event.S3Client) {
-	s3cli = &mock.S3ClientMock{GetFunc: funcGet}
-	s3Clients = map[string]event.S3Client{bucket: s3cli}
-	return
+// createS3MockGet creates an S3Client mock that gets objects by key with the provided function and returns it, and the
+// registry as expected by Handler
+func createS3MockGet(funcGet func(ctx context.Context, key string) (io.ReadCloser, *int64, error)) (s3cli *mock.S3ClientMock, s3Clients event.S3ClientProvider) {
+	s3cli = &mock.S3ClientMock{
+		GetObjectFunc: func(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error) {
+			return getObjectOutput(funcGet(ctx, aws.ToString(input.Key)))
+		},
+	}
+	return s3cli, createS3Registry(s3cli)
+}
+
+func createS3MockGetWithPsk(funcGetWithPsk func(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error)) (s3cli *mock.S3ClientMock, s3Clients event.S3ClientProvider) {
+	s3cli = &mock.S3ClientMock{
+		GetObjectWithPSKFunc: func(ctx context.Context, input *awsS3.GetObjectInput, psk []byte) (*awsS3.GetObjectOutput, error) {
+			return getObjectOutput(funcGetWithPsk(ctx, aws.ToString(input.Key), psk))
+		},
+	}
+	return s3cli, createS3Registry(s3cli)
 }
 
-func createS3MockGetWithPsk(funcGetWithPsk func(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error)) (s3cli *mock.S3ClientMock, s3Clients map[string]event.S3Client) {
-	s3cli = &mock.S3ClientMock{GetWithPSKFunc: funcGetWithPsk}
-	s3Clients = map[string]event.S3Client{bucket: s3cli}
-	return s3cli, s3Clients
+// getObjectOutput returns the output of getting an object with the given body and content length
+func getObjectOutput(body io.ReadCloser, contentLength *int64, err error) (*awsS3.GetObjectOutput, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &awsS3.GetObjectOutput{Body: body, ContentLength: contentLength}, nil
 }
 
-// createS3MockEmpty returns an empty s3 mock and the map as expected by Handler
-func createS3MockEmpty() (s3cli *mock.S3ClientMock, s3Clients map[string]event.S3Client) {
+// createS3MockEmpty returns an empty s3 mock and the registry as expected by Handler
+func createS3MockEmpty() (s3cli *mock.S3ClientMock, s3Clients event.S3ClientProvider) {
 	s3cli = &mock.S3ClientMock{}
-	s3Clients = map[string]event.S3Client{bucket: s3cli}
-	return
+	return s3cli, createS3Registry(s3cli)
+}
+
+// newS3Handler returns a handler that reads files from S3 with the given dependencies
+func newS3Handler(s3Clients event.S3ClientProvider, vaultClient event.VaultClient, observationWriter event.ObservationWriter,
+	vaultPath string, retryPolicy retry.Policy, urlPolicy urlpolicy.Policy) *event.CSVHandler {
+	sources := map[string]event.FileSource{
+		event.SchemeS3: event.NewS3Source(s3Clients, vaultClient, vaultPath, retryPolicy),
+	}
+	return event.NewCSVHandler(sources, urlPolicy, observationWriter, observation.BadRowPolicyFail, nil)
+}
+
+// createS3Registry returns a registry containing the given client for the test bucket, which only allows that bucket
+func createS3Registry(s3cli *mock.S3ClientMock) *event.S3ClientRegistry {
+	return event.NewS3ClientRegistry(map[string]event.S3Client{bucket: s3cli}, event.BucketPolicy{Mode: event.BucketAllowList, Buckets: []string{bucket}}, nil)
 }
 
 // Vault ReadKey function for a successful case
@@ -98,12 +151,12 @@ func TestSuccessfullyHandleCSV(t *testing.T) {
 			Convey("Then successfully return without an error", func() {
 				s3cli, s3Clients := createS3MockGet(funcGetValid)
 				observationWriterStub := &eventtest.ObservationWriter{}
-				csvHandler := event.NewCSVHandler(nil, s3Clients, nil, observationWriterStub, "")
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, getExampleEvent())
 				So(err, ShouldBeNil)
-				So(len(s3cli.GetCalls()), ShouldEqual, 1)
-				So(s3cli.GetCalls()[0].Key, ShouldEqual, filename)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 1)
+				So(aws.ToString(s3cli.GetObjectCalls()[0].Input.Key), ShouldEqual, filename)
 			})
 		})
 
@@ -117,14 +170,14 @@ func TestSuccessfullyHandleCSV(t *testing.T) {
 				}
 
 				observationWriterStub := &eventtest.ObservationWriter{}
-				csvHandler := event.NewCSVHandler(nil, s3Clients, vaultClient, observationWriterStub, vaultPath)
+				csvHandler := newS3Handler(s3Clients, vaultClient, observationWriterStub, vaultPath, noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, getExampleEvent())
 				So(err, ShouldBeNil)
 
-				So(len(s3cli.GetWithPSKCalls()), ShouldEqual, 1)
-				So(s3cli.GetWithPSKCalls()[0].Key, ShouldEqual, filename)
-				So(s3cli.GetWithPSKCalls()[0].Psk, ShouldResemble, psk)
+				So(len(s3cli.GetObjectWithPSKCalls()), ShouldEqual, 1)
+				So(aws.ToString(s3cli.GetObjectWithPSKCalls()[0].Input.Key), ShouldEqual, filename)
+				So(s3cli.GetObjectWithPSKCalls()[0].Psk, ShouldResemble, psk)
 
 				So(len(vaultClient.ReadKeyCalls()), ShouldEqual, 1)
 				So(vaultClient.ReadKeyCalls()[0].Key, ShouldEqual, "key")
@@ -134,18 +187,106 @@ func TestSuccessfullyHandleCSV(t *testing.T) {
 	})
 }
 
+func TestHandleCompressedCSV(t *testing.T) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err := gzipWriter.Write([]byte(exampleHeader + "\n" + exampleCsvLine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	funcGetCompressed := func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
+		return io.NopCloser(bytes.NewReader(compressed.Bytes())), &contentLen, nil
+	}
+
+	funcGetWithPskCompressed := func(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error) {
+		return io.NopCloser(bytes.NewReader(compressed.Bytes())), &contentLen, nil
+	}
+
+	Convey("Given an event for a gzip compressed file", t, func() {
+		Convey("When handle method is called with event", func() {
+			Convey("Then the file is decompressed before the observations are read", func() {
+				s3cli, s3Clients := createS3MockGet(funcGetCompressed)
+				observationWriterStub := &eventtest.ObservationWriter{}
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(ctx, getExampleEvent())
+				So(err, ShouldBeNil)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 1)
+
+				row, err := observationWriterStub.Reader.Read()
+				So(err, ShouldBeNil)
+				So(row.Row, ShouldEqual, exampleCsvLine)
+			})
+		})
+
+		Convey("When handle method is called with event, and encryption is enabled", func() {
+			Convey("Then the decrypted file is decompressed before the observations are read", func() {
+				_, s3Clients := createS3MockGetWithPsk(funcGetWithPskCompressed)
+				observationWriterStub := &eventtest.ObservationWriter{}
+				csvHandler := newS3Handler(s3Clients, createVaultMock(funcReadKey), observationWriterStub, vaultPath, noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(ctx, getExampleEvent())
+				So(err, ShouldBeNil)
+
+				row, err := observationWriterStub.Reader.Read()
+				So(err, ShouldBeNil)
+				So(row.Row, ShouldEqual, exampleCsvLine)
+			})
+		})
+	})
+
+	Convey("Given an event for a file with a gzip Content-Encoding that is not compressed", t, func() {
+		Convey("When handle method is called with event", func() {
+			Convey("Then an error is returned", func() {
+				s3cli, s3Clients := createS3MockGet(funcGetValid)
+				getObject := s3cli.GetObjectFunc
+				s3cli.GetObjectFunc = func(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error) {
+					output, err := getObject(ctx, input)
+					output.ContentEncoding = aws.String("gzip")
+					return output, err
+				}
+				observationWriterStub := &eventtest.ObservationWriter{}
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(ctx, getExampleEvent())
+				So(err, ShouldEqual, gzip.ErrHeader)
+				So(observationWriterStub.Reader, ShouldBeNil)
+			})
+		})
+	})
+}
+
 func TestFailToHandleCSV(t *testing.T) {
 	t.Parallel()
 	Convey("Given an event is missing a file URL", t, func() {
 		Convey("When handle method is called with event", func() {
-			Convey("Then error returns with a message 'could not find bucket or filename in file url'", func() {
+			Convey("Then an unsupported scheme error is returned, as there is no file source for the url", func() {
 				_, s3Clients := createS3MockEmpty()
-				csvHandler := event.NewCSVHandler(nil, s3Clients, nil, &eventtest.ObservationWriter{}, "")
+				csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{})
 				err := csvHandler.Handle(ctx, &event.DimensionsInserted{
 					InstanceID: "1234",
 					FileURL:    "",
 				})
-				So(err, ShouldResemble, errors.New("wrong bucketName in DNS-alias-virtual-hosted-style url: "))
+				So(err, ShouldResemble, &event.UnsupportedSchemeError{Scheme: ""})
+			})
+		})
+	})
+
+	Convey("Given an event with a file URL scheme that has no file source", t, func() {
+		Convey("When handle method is called with event", func() {
+			Convey("Then a permanent unsupported scheme error is returned", func() {
+				_, s3Clients := createS3MockEmpty()
+				csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{})
+				err := csvHandler.Handle(ctx, &event.DimensionsInserted{
+					InstanceID: "1234",
+					FileURL:    "file:///tmp/some-file",
+				})
+				So(err, ShouldResemble, &event.UnsupportedSchemeError{Scheme: "file"})
+				So(err.(*event.UnsupportedSchemeError).Permanent(), ShouldBeTrue)
 			})
 		})
 	})
@@ -154,7 +295,7 @@ func TestFailToHandleCSV(t *testing.T) {
 		Convey("When handle method is called with event", func() {
 			Convey("Then error returns with a message 'missing filename in file url'", func() {
 				_, s3Clients := createS3MockEmpty()
-				csvHandler := event.NewCSVHandler(nil, s3Clients, nil, &eventtest.ObservationWriter{}, "")
+				csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{})
 				err := csvHandler.Handle(ctx, &event.DimensionsInserted{
 					InstanceID: "1234",
 					FileURL:    "s3://",
@@ -169,7 +310,7 @@ func TestFailToHandleCSV(t *testing.T) {
 			Convey("Then the correct error is returned", func() {
 				_, s3Clients := createS3MockEmpty()
 				vaultClient := createVaultMock(funcReadKeyErr)
-				csvHandler := event.NewCSVHandler(nil, s3Clients, vaultClient, nil, vaultPath)
+				csvHandler := newS3Handler(s3Clients, vaultClient, nil, vaultPath, noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, getExampleEvent())
 				So(err, ShouldResemble, errVault)
@@ -186,7 +327,7 @@ func TestFailToHandleCSV(t *testing.T) {
 			Convey("Then the correct error is returned", func() {
 				_, s3Clients := createS3MockEmpty()
 				vaultClient := createVaultMock(funcReadKeyInvalidPSK)
-				csvHandler := event.NewCSVHandler(nil, s3Clients, vaultClient, nil, vaultPath)
+				csvHandler := newS3Handler(s3Clients, vaultClient, nil, vaultPath, noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, getExampleEvent())
 				So(err, ShouldNotBeNil)
@@ -204,14 +345,14 @@ func TestFailToHandleCSV(t *testing.T) {
 			Convey("Then the correct error is returned", func() {
 				s3cli, s3Clients := createS3MockGetWithPsk(funcGetWithPskErr)
 				vaultClient := createVaultMock(funcReadKey)
-				csvHandler := event.NewCSVHandler(nil, s3Clients, vaultClient, &eventtest.ObservationWriter{}, vaultPath)
+				csvHandler := newS3Handler(s3Clients, vaultClient, &eventtest.ObservationWriter{}, vaultPath, noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, getExampleEvent())
 				So(err, ShouldResemble, errCryptoClient)
 
-				So(len(s3cli.GetWithPSKCalls()), ShouldEqual, 1)
-				So(s3cli.GetWithPSKCalls()[0].Key, ShouldEqual, filename)
-				So(s3cli.GetWithPSKCalls()[0].Psk, ShouldResemble, psk)
+				So(len(s3cli.GetObjectWithPSKCalls()), ShouldEqual, 1)
+				So(aws.ToString(s3cli.GetObjectWithPSKCalls()[0].Input.Key), ShouldEqual, filename)
+				So(s3cli.GetObjectWithPSKCalls()[0].Psk, ShouldResemble, psk)
 
 				So(len(vaultClient.ReadKeyCalls()), ShouldEqual, 1)
 				So(vaultClient.ReadKeyCalls()[0].Key, ShouldEqual, "key")
@@ -224,7 +365,7 @@ func TestFailToHandleCSV(t *testing.T) {
 		Convey("When handle method is called with event", func() {
 			Convey("Then error returns with a message 'wrong key in global virtual hosted style url: s3://some-file'", func() {
 				_, s3Clients := createS3MockEmpty()
-				csvHandler := event.NewCSVHandler(nil, s3Clients, nil, &eventtest.ObservationWriter{}, "")
+				csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, &event.DimensionsInserted{
 					InstanceID: "1234",
@@ -240,14 +381,396 @@ func TestFailToHandleCSV(t *testing.T) {
 		Convey("When handle method is called with event", func() {
 			Convey("Then error returns with a message 'EOF'", func() {
 				s3cli, s3Clients := createS3MockGet(funcGetErr)
-				csvHandler := event.NewCSVHandler(nil, s3Clients, nil, &eventtest.ObservationWriter{}, "")
+				csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{})
 
 				err := csvHandler.Handle(ctx, getExampleEvent())
 				So(err, ShouldNotBeNil)
 				So(err, ShouldResemble, errors.New("EOF"))
 
-				So(len(s3cli.GetCalls()), ShouldEqual, 1)
-				So(s3cli.GetCalls()[0].Key, ShouldEqual, filename)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 1)
+				So(aws.ToString(s3cli.GetObjectCalls()[0].Input.Key), ShouldEqual, filename)
+			})
+		})
+	})
+
+	Convey("Given the event message refers to a file with an invalid V4 header", t, func() {
+		Convey("When handle method is called with event", func() {
+			Convey("Then a header error is returned and no observations are written", func() {
+				_, s3Clients := createS3MockGet(funcGetInvalidHeader)
+				observationWriterStub := &eventtest.ObservationWriter{}
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(ctx, getExampleEvent())
+				So(err, ShouldHaveSameTypeAs, &observation.HeaderError{})
+				So(observationWriterStub.Reader, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given an observation writer that fails to extract all observations", t, func() {
+		Convey("When handle method is called with event", func() {
+			Convey("Then the observation writer error is returned", func() {
+				_, s3Clients := createS3MockGet(funcGetValid)
+				writerErr := &observation.ReadError{RowsWritten: 1, Err: errors.New("connection reset")}
+				observationWriterStub := &eventtest.ObservationWriter{Error: writerErr}
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(ctx, getExampleEvent())
+				So(err, ShouldEqual, writerErr)
+				So(observationWriterStub.Reader, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestHandleCSV_Cancelled(t *testing.T) {
+	Convey("Given a context that has already been cancelled", t, func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		Convey("When handle method is called with event", func() {
+			Convey("Then a cancelled error is returned without getting the file", func() {
+				s3cli, s3Clients := createS3MockGet(funcGetValid)
+				observationWriterStub := &eventtest.ObservationWriter{}
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(cancelled, getExampleEvent())
+				So(err, ShouldResemble, &observation.CancelledError{Err: context.Canceled})
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 0)
+				So(observationWriterStub.Reader, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given an observation writer that is cancelled part way through the file", t, func() {
+		Convey("When handle method is called with event", func() {
+			Convey("Then the cancelled error is returned with the rows sent", func() {
+				_, s3Clients := createS3MockGet(funcGetValid)
+				writerErr := &observation.CancelledError{RowsWritten: 1, Err: context.Canceled}
+				observationWriterStub := &eventtest.ObservationWriter{Error: writerErr}
+				csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+				err := csvHandler.Handle(ctx, getExampleEvent())
+				So(err, ShouldEqual, writerErr)
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			})
+		})
+	})
+	Convey("Given a file source that is waiting to retry a transient error", t, func() {
+		cancellable, cancel := context.WithCancel(ctx)
+		s3cli, s3Clients := createS3MockGet(func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
+			cancel()
+			return nil, nil, &smithy.GenericAPIError{Code: "SlowDown"}
+		})
+		observationWriterStub := &eventtest.ObservationWriter{}
+		csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", retry.Policy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}, urlpolicy.Policy{})
+
+		Convey("When the context is cancelled before the retry", func() {
+			err := csvHandler.Handle(cancellable, getExampleEvent())
+
+			Convey("Then a cancelled error is returned rather than the transient error", func() {
+				var cancelled *observation.CancelledError
+				So(errors.As(err, &cancelled), ShouldBeTrue)
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 1)
+				So(observationWriterStub.Reader, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestHandleCSV_Jobs(t *testing.T) {
+	Convey("Given a handler with a job registry", t, func() {
+		_, s3Clients := createS3MockGet(funcGetValid)
+		observationWriterStub := &eventtest.ObservationWriter{}
+		sources := map[string]event.FileSource{
+			event.SchemeS3: event.NewS3Source(s3Clients, nil, "", noRetries),
+		}
+		registry := jobs.NewRegistry(10)
+		csvHandler := event.NewCSVHandler(sources, urlpolicy.Policy{}, observationWriterStub, observation.BadRowPolicyFail, registry)
+
+		Convey("When an event is handled successfully", func() {
+			err := csvHandler.Handle(ctx, getExampleEvent())
+			So(err, ShouldBeNil)
+
+			Convey("Then a completed job is recorded with the bytes read from the file", func() {
+				job, ok := registry.Get(getExampleEvent().InstanceID)
+				So(ok, ShouldBeTrue)
+				So(job.FileURL, ShouldEqual, getExampleEvent().FileURL)
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+				So(job.BytesRead, ShouldEqual, len(exampleHeader+"\n"+exampleCsvLine))
+			})
+		})
+
+		Convey("When an event for a queued job is handled", func() {
+			queued, err := registry.Queue(getExampleEvent().InstanceID, getExampleEvent().FileURL)
+			So(err, ShouldBeNil)
+			dimensionsInserted := getExampleEvent()
+			dimensionsInserted.ExtractionJobID = queued.ID
+			So(csvHandler.Handle(ctx, dimensionsInserted), ShouldBeNil)
+
+			Convey("Then the queued job is the one completed", func() {
+				job, ok := registry.GetByID(queued.ID)
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+				So(registry.List(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When a partial extraction event whose import job ID is that of a queued job is handled", func() {
+			queued, err := registry.Queue(getExampleEvent().InstanceID, getExampleEvent().FileURL)
+			So(err, ShouldBeNil)
+			dimensionsInserted := getExampleEvent()
+			dimensionsInserted.JobID = queued.ID
+			dimensionsInserted.Selection = observation.Selection{Limit: 1}
+			So(csvHandler.Handle(ctx, dimensionsInserted), ShouldBeNil)
+
+			Convey("Then the queued job is not started, and a new job is recorded with the import job ID", func() {
+				job, ok := registry.GetByID(queued.ID)
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusQueued)
+
+				list := registry.List()
+				So(list, ShouldHaveLength, 2)
+				job = list[1]
+				So(job.ID, ShouldNotEqual, queued.ID)
+				So(job.ImportJobID, ShouldEqual, queued.ID)
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+			})
+		})
+
+		Convey("When an event is handled while a full extraction of the instance is in progress", func() {
+			_, err := registry.Start("", getExampleEvent().InstanceID, getExampleEvent().FileURL, "", false)
+			So(err, ShouldBeNil)
+			err = csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then ErrInProgress is returned without extracting the instance again", func() {
+				So(err, ShouldEqual, jobs.ErrInProgress)
+				So(observationWriterStub.Reader, ShouldBeNil)
+				So(registry.List(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the observation writer fails", func() {
+			observationWriterStub.Error = errors.New("disk full")
+			err := csvHandler.Handle(ctx, getExampleEvent())
+			So(err, ShouldNotBeNil)
+
+			Convey("Then a failed job is recorded with the error", func() {
+				job, ok := registry.Get(getExampleEvent().InstanceID)
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusFailed)
+				So(job.Error, ShouldEqual, "disk full")
+			})
+
+			Convey("And handling the event again carries on the same job", func() {
+				dimensionsInserted := getExampleEvent()
+				So(csvHandler.Handle(ctx, dimensionsInserted), ShouldNotBeNil)
+				So(csvHandler.Handle(ctx, dimensionsInserted), ShouldNotBeNil)
+				list := registry.List()
+				So(list, ShouldHaveLength, 2)
+				So(list[0].ID, ShouldEqual, dimensionsInserted.ExtractionJobID)
+				So(list[0].Attempts, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestHandleCSV_Selection(t *testing.T) {
+	funcGetRows := func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
+		content := exampleHeader + "\n" + exampleCsvLine + "\n" + exampleCsvLine + "\n" + exampleCsvLine
+		return io.NopCloser(strings.NewReader(content)), &contentLen, nil
+	}
+
+	Convey("Given a handler for a file with three rows", t, func() {
+		_, s3Clients := createS3MockGet(funcGetRows)
+		observationWriterStub := &eventtest.ObservationWriter{}
+		csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{})
+
+		Convey("When an event with a selection of the rows after the first is handled", func() {
+			dimensionsInserted := getExampleEvent()
+			dimensionsInserted.Selection = observation.Selection{FirstRow: 2}
+			err := csvHandler.Handle(ctx, dimensionsInserted)
+
+			Convey("Then the observation reader only returns the selected rows, with their original row indexes", func() {
+				So(err, ShouldBeNil)
+				row, err := observationWriterStub.Reader.Read()
+				So(err, ShouldBeNil)
+				So(row.RowIndex, ShouldEqual, 2)
+			})
+
+			Convey("And the extraction is partial", func() {
+				So(observationWriterStub.Extraction.Partial, ShouldBeTrue)
+			})
+		})
+
+		Convey("When an event with an invalid selection is handled", func() {
+			dimensionsInserted := getExampleEvent()
+			dimensionsInserted.Selection = observation.Selection{Limit: -1}
+			err := csvHandler.Handle(ctx, dimensionsInserted)
+
+			Convey("Then an invalid selection error is returned and no observations are written", func() {
+				So(errors.Is(err, observation.ErrInvalidSelection), ShouldBeTrue)
+				So(observationWriterStub.Reader, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestHandleCSV_BucketNotAllowed(t *testing.T) {
+	t.Parallel()
+	Convey("Given an event for a file in a bucket that the bucket policy does not allow", t, func() {
+		s3cli, s3Clients := createS3MockGet(funcGetValid)
+		csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{})
+
+		Convey("When handle method is called with event", func() {
+			err := csvHandler.Handle(ctx, &event.DimensionsInserted{
+				InstanceID: "1234",
+				FileURL:    "s3://other-bucket/some-file",
+			})
+
+			Convey("Then a url policy violation for ErrBucketNotAllowed is returned and the file is not read", func() {
+				So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+				So(errors.Is(err, event.ErrBucketNotAllowed), ShouldBeTrue)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestHandleCSV_URLPolicy(t *testing.T) {
+	t.Parallel()
+	Convey("Given a handler with a url policy", t, func() {
+		deny, err := urlpolicy.ParseRules([]string{bucket + "/" + filename})
+		So(err, ShouldBeNil)
+
+		Convey("When handle method is called with an event for a file matching a deny rule", func() {
+			s3cli, s3Clients := createS3MockGet(funcGetValid)
+			csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", noRetries, urlpolicy.Policy{Deny: deny})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then a url policy violation is returned and the file is not read", func() {
+				So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When handle method is called with an event for a file larger than the maximum object size", func() {
+			_, s3Clients := createS3MockGet(funcGetValid)
+			observationWriterStub := &eventtest.ObservationWriter{}
+			csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", noRetries, urlpolicy.Policy{MaxObjectSize: contentLen - 1})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then a url policy violation is returned and no observations are written", func() {
+				So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+				So(observationWriterStub.Reader, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestHandleCSV_Retry(t *testing.T) {
+	t.Parallel()
+	Convey("Given a handler that retries up to 3 times", t, func() {
+		Convey("When S3 throttles the first request for the file", func() {
+			calls := 0
+			s3cli, s3Clients := createS3MockGet(func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
+				calls++
+				if calls == 1 {
+					return nil, nil, &smithy.GenericAPIError{Code: "SlowDown"}
+				}
+				return funcGetValid(ctx, key)
+			})
+			observationWriterStub := &eventtest.ObservationWriter{}
+			csvHandler := newS3Handler(s3Clients, nil, observationWriterStub, "", threeRetries, urlpolicy.Policy{})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then the file is requested again and read successfully", func() {
+				So(err, ShouldBeNil)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 2)
+
+				row, err := observationWriterStub.Reader.Read()
+				So(err, ShouldBeNil)
+				So(row.Row, ShouldEqual, exampleCsvLine)
+			})
+		})
+
+		Convey("When the connection to S3 is reset part of the way through the file and the file is then changed", func() {
+			s3cli := &mock.S3ClientMock{
+				GetObjectFunc: func(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error) {
+					if input.IfMatch != nil {
+						return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+					}
+					body := io.MultiReader(strings.NewReader(exampleHeader+"\n"), iotest.ErrReader(syscall.ECONNRESET))
+					return &awsS3.GetObjectOutput{Body: io.NopCloser(body), ETag: aws.String(`"v1"`)}, nil
+				},
+			}
+			observationWriterStub := &eventtest.ObservationWriter{}
+			csvHandler := newS3Handler(createS3Registry(s3cli), nil, observationWriterStub, "", threeRetries, urlpolicy.Policy{})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+			So(err, ShouldBeNil)
+			_, err = observationWriterStub.Reader.Read()
+
+			Convey("Then the file is only requested again if it still has the ETag it was first read with", func() {
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 2)
+				So(aws.ToString(s3cli.GetObjectCalls()[1].Input.IfMatch), ShouldEqual, `"v1"`)
+			})
+
+			Convey("And a permanent ChangedError is returned", func() {
+				var changedErr *retry.ChangedError
+				So(errors.As(err, &changedErr), ShouldBeTrue)
+				So(changedErr.Permanent(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the file does not exist in S3", func() {
+			s3cli, s3Clients := createS3MockGet(func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
+				return nil, nil, &smithy.GenericAPIError{Code: "NoSuchKey"}
+			})
+			csvHandler := newS3Handler(s3Clients, nil, &eventtest.ObservationWriter{}, "", threeRetries, urlpolicy.Policy{})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then the error is returned without retrying", func() {
+				So(err, ShouldNotBeNil)
+				So(len(s3cli.GetObjectCalls()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When vault fails with a server error before returning the psk", func() {
+			calls := 0
+			vaultClient := createVaultMock(func(path string, key string) (string, error) {
+				calls++
+				if calls == 1 {
+					return "", &vaultapi.ResponseError{StatusCode: 503}
+				}
+				return encodedPSK, nil
+			})
+			_, s3Clients := createS3MockGetWithPsk(funcGetWithPskValid)
+			csvHandler := newS3Handler(s3Clients, vaultClient, &eventtest.ObservationWriter{}, vaultPath, threeRetries, urlpolicy.Policy{})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then the psk is read again and the file is handled", func() {
+				So(err, ShouldBeNil)
+				So(len(vaultClient.ReadKeyCalls()), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When vault returns a psk that is not hex encoded", func() {
+			vaultClient := createVaultMock(funcReadKeyInvalidPSK)
+			_, s3Clients := createS3MockEmpty()
+			csvHandler := newS3Handler(s3Clients, vaultClient, nil, vaultPath, threeRetries, urlpolicy.Policy{})
+
+			err := csvHandler.Handle(ctx, getExampleEvent())
+
+			Convey("Then the error is returned without reading the psk again", func() {
+				So(err, ShouldNotBeNil)
+				So(len(vaultClient.ReadKeyCalls()), ShouldEqual, 1)
 			})
 		})
 	})
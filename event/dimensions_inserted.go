@@ -1,7 +1,111 @@
 package event
 
-// DimensionsInserted is the structure of each event consumed by the observation extractor.
+import (
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/ONSdigital/go-ns/avro"
+)
+
+// DimensionsInserted is the structure of each event consumed by the observation extractor. Only the file url and
+// instance ID are always set, as the other fields were added in version 2 of the schema and are optional. JobID is the
+// ID of the import job that requested the extraction, not that of the extraction job recorded by this service.
+//
+// ExtractionJobID is not part of the schema, so is never set for events consumed from kafka. It is the ID of the
+// queued extraction job that an event created by this service, such as for an extraction requested through the admin
+// api, is extracted as.
 type DimensionsInserted struct {
-	FileURL    string `avro:"file_url"`
-	InstanceID string `avro:"instance_id"`
+	FileURL         string                `avro:"file_url"`
+	InstanceID      string                `avro:"instance_id"`
+	JobID           string                `avro:"job_id"`
+	DatasetID       string                `avro:"dataset_id"`
+	Edition         string                `avro:"edition"`
+	Version         string                `avro:"version"`
+	TraceID         string                `avro:"trace_id"`
+	Selection       observation.Selection `avro:"extraction_options"`
+	ExtractionJobID string                `avro:"-"`
+}
+
+// UnmarshalDimensionsInserted decodes a dimensions inserted message written with any version of its schema. Optional
+// fields that are missing from the message are left empty.
+func UnmarshalDimensionsInserted(message []byte) (*DimensionsInserted, error) {
+	record, _, err := schema.DimensionsInsertedEventVersions.Decode(message)
+	if err != nil {
+		return nil, err
+	}
+	return fromRecord(record), nil
+}
+
+// ResolveDimensionsInserted decodes a dimensions inserted message written with the given schema, such as one looked
+// up in a schema registry. Fields the writer's schema does not have are left empty.
+func ResolveDimensionsInserted(writer *avro.Schema, message []byte) (*DimensionsInserted, error) {
+	record, err := schema.Resolve(writer, schema.DimensionsInsertedEvent, message)
+	if err != nil {
+		return nil, err
+	}
+	return fromRecord(record), nil
+}
+
+// fromRecord returns the event for a record of the latest version of the schema.
+func fromRecord(record schema.Record) *DimensionsInserted {
+	event := &DimensionsInserted{
+		FileURL:    stringField(record, "file_url"),
+		InstanceID: stringField(record, "instance_id"),
+		JobID:      stringField(record, "job_id"),
+		DatasetID:  stringField(record, "dataset_id"),
+		Edition:    stringField(record, "edition"),
+		Version:    stringField(record, "version"),
+		TraceID:    stringField(record, "trace_id"),
+	}
+	if options, ok := record["extraction_options"].(schema.Record); ok {
+		event.Selection = observation.Selection{
+			FirstRow:    longField(options, "first_row"),
+			LastRow:     longField(options, "last_row"),
+			Limit:       longField(options, "limit"),
+			SampleEvery: longField(options, "sample_every"),
+		}
+	}
+	return event
+}
+
+// MarshalDimensionsInserted encodes the event with the latest version of its schema. Empty optional fields are
+// written as null.
+func MarshalDimensionsInserted(event *DimensionsInserted) ([]byte, error) {
+	record := schema.Record{
+		"file_url":    event.FileURL,
+		"instance_id": event.InstanceID,
+		"job_id":      optionalString(event.JobID),
+		"dataset_id":  optionalString(event.DatasetID),
+		"edition":     optionalString(event.Edition),
+		"version":     optionalString(event.Version),
+		"trace_id":    optionalString(event.TraceID),
+	}
+	if !event.Selection.IsZero() {
+		record["extraction_options"] = schema.Record{
+			"first_row":    event.Selection.FirstRow,
+			"last_row":     event.Selection.LastRow,
+			"limit":        event.Selection.Limit,
+			"sample_every": event.Selection.SampleEvery,
+		}
+	}
+	return schema.DimensionsInsertedEventVersions.Encode(record)
+}
+
+// stringField returns the string value of a field, or an empty string if it is null.
+func stringField(record schema.Record, name string) string {
+	value, _ := record[name].(string)
+	return value
+}
+
+// longField returns the long value of a field, or zero if it is null.
+func longField(record schema.Record, name string) int64 {
+	value, _ := record[name].(int64)
+	return value
+}
+
+// optionalString returns nil for an empty string, so that it is written as null.
+func optionalString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
 }
@@ -0,0 +1,69 @@
+package event_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/event"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/schema"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// dimensionsInsertedV1 is the event as written by producers using version 1 of the schema
+type dimensionsInsertedV1 struct {
+	FileURL    string `avro:"file_url"`
+	InstanceID string `avro:"instance_id"`
+}
+
+func TestUnmarshalDimensionsInserted(t *testing.T) {
+	Convey("Given a message written with version 1 of the schema", t, func() {
+		v1, err := schema.DimensionsInsertedEventVersions.Version(1)
+		So(err, ShouldBeNil)
+		message, err := v1.Marshal(dimensionsInsertedV1{FileURL: "s3://some-bucket/some-file", InstanceID: "1234"})
+		So(err, ShouldBeNil)
+
+		Convey("When it is unmarshalled", func() {
+			dimensionsInserted, err := event.UnmarshalDimensionsInserted(message)
+
+			Convey("Then the event has the file url and instance ID, and no optional fields", func() {
+				So(err, ShouldBeNil)
+				So(*dimensionsInserted, ShouldResemble, event.DimensionsInserted{
+					FileURL:    "s3://some-bucket/some-file",
+					InstanceID: "1234",
+				})
+			})
+		})
+	})
+
+	Convey("Given an event with every optional field set", t, func() {
+		expected := event.DimensionsInserted{
+			FileURL:    "s3://some-bucket/some-file",
+			InstanceID: "1234",
+			JobID:      "job-1",
+			DatasetID:  "cpih01",
+			Edition:    "time-series",
+			Version:    "3",
+			TraceID:    "trace-1",
+			Selection:  observation.Selection{FirstRow: 10, Limit: 5},
+		}
+
+		Convey("When it is marshalled and unmarshalled", func() {
+			message, err := event.MarshalDimensionsInserted(&expected)
+			So(err, ShouldBeNil)
+			dimensionsInserted, err := event.UnmarshalDimensionsInserted(message)
+
+			Convey("Then every field is kept", func() {
+				So(err, ShouldBeNil)
+				So(*dimensionsInserted, ShouldResemble, expected)
+			})
+
+			Convey("And a reader of version 1 of the schema can still read the file url and instance ID", func() {
+				v1, err := schema.DimensionsInsertedEventVersions.Version(1)
+				So(err, ShouldBeNil)
+				record, err := schema.Resolve(schema.DimensionsInsertedEvent, v1, message)
+				So(err, ShouldBeNil)
+				So(record, ShouldResemble, schema.Record{"file_url": expected.FileURL, "instance_id": expected.InstanceID})
+			})
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package eventtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ONSdigital/dp-observation-extractor/event"
+)
+
+var _ event.DeadLetterWriter = (*DeadLetterWriter)(nil)
+
+// DeadLetter is a message captured by the DeadLetterWriter.
+type DeadLetter struct {
+	Message  []byte
+	Cause    error
+	Attempts int
+}
+
+// NewDeadLetterWriter returns a new mock dead letter writer to capture messages.
+func NewDeadLetterWriter() *DeadLetterWriter {
+	return &DeadLetterWriter{
+		DeadLetters: make([]DeadLetter, 0),
+	}
+}
+
+// NewErrorDeadLetterWriter returns a new mock dead letter writer that captures messages and fails to write them
+// with the given error.
+func NewErrorDeadLetterWriter(err error) *DeadLetterWriter {
+	return &DeadLetterWriter{
+		DeadLetters: make([]DeadLetter, 0),
+		err:         err,
+	}
+}
+
+// DeadLetterWriter provides a mock implementation that captures dead letter messages to check.
+type DeadLetterWriter struct {
+	DeadLetters []DeadLetter
+	err         error
+	mutex       sync.Mutex
+}
+
+// Write captures the given message and stores it for later assertions, returning the configured error if there is one
+func (writer *DeadLetterWriter) Write(ctx context.Context, message []byte, cause error, attempts int) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.DeadLetters = append(writer.DeadLetters, DeadLetter{Message: message, Cause: cause, Attempts: attempts})
+	return writer.err
+}
@@ -2,6 +2,7 @@ package eventtest
 
 import (
 	"context"
+	"sync"
 
 	"github.com/ONSdigital/dp-observation-extractor/event"
 )
@@ -22,11 +23,14 @@ type EventHandler struct {
 	Events   []event.DimensionsInserted
 	Error    error
 	ChHandle chan *event.DimensionsInserted
+	mutex    sync.Mutex
 }
 
 // Handle captures the given event and stores it for later assertions
 func (handler *EventHandler) Handle(ctx context.Context, event *event.DimensionsInserted) error {
+	handler.mutex.Lock()
 	handler.Events = append(handler.Events, *event)
+	handler.mutex.Unlock()
 	handler.ChHandle <- event
 	return handler.Error
 }
@@ -9,12 +9,17 @@ import (
 
 var _ event.ObservationWriter = (*ObservationWriter)(nil)
 
-// ObservationWriter when used will capture the reader passed to it for assertions. Will return the configured error.
+// ObservationWriter when used will capture the reader and extraction passed to it for assertions. Will return the
+// configured error.
 type ObservationWriter struct {
-	Reader observation.Reader
+	Reader     observation.Reader
+	Extraction observation.Extraction
+	Error      error
 }
 
-// WriteAll will capture the reader passed to it for assertions.
-func (observationWriter *ObservationWriter) WriteAll(ctx context.Context, reader observation.Reader, instanceID string) {
+// WriteAll will capture the reader and extraction passed to it for assertions, and return the configured error.
+func (observationWriter *ObservationWriter) WriteAll(ctx context.Context, reader observation.Reader, extraction observation.Extraction) error {
 	observationWriter.Reader = reader
+	observationWriter.Extraction = extraction
+	return observationWriter.Error
 }
@@ -0,0 +1,43 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Schemes of the file URLs that can be read from
+const (
+	SchemeS3    = "s3"
+	SchemeFile  = "file"
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+)
+
+// FileSource opens the files that events refer to, for the URL schemes it is registered for.
+type FileSource interface {
+	Open(ctx context.Context, fileURL string) (*File, error)
+}
+
+// File is a file opened by a FileSource. Name and ContentEncoding are used to detect whether the file is compressed.
+type File struct {
+	Body            io.ReadCloser
+	Name            string
+	ContentLength   *int64
+	ContentEncoding string
+}
+
+// UnsupportedSchemeError is returned when an event refers to a file URL with a scheme that has no FileSource.
+type UnsupportedSchemeError struct {
+	Scheme string
+}
+
+// Error returns a description of the unsupported scheme.
+func (err *UnsupportedSchemeError) Error() string {
+	return fmt.Sprintf("unsupported file url scheme: %q", err.Scheme)
+}
+
+// Permanent returns true, as handling the event again will not succeed.
+func (err *UnsupportedSchemeError) Permanent() bool {
+	return true
+}
@@ -0,0 +1,123 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// HTTPClient is the subset of http.Client used to download files
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// maxRedirects is the number of redirects followed when downloading a file, as for http.DefaultClient.
+const maxRedirects = 10
+
+// NewHTTPClient returns a client for downloading files that checks each redirect against the given urlpolicy.Policy,
+// so that a file URL the policy allows cannot redirect to a file that it does not. A redirect that is not allowed
+// fails the request with a *urlpolicy.Violation.
+func NewHTTPClient(urlPolicy urlpolicy.Policy) *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return urlPolicy.CheckURL(req.URL)
+		},
+	}
+}
+
+// HTTPStatusError is returned when a file could not be downloaded because of an unsuccessful response status.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+// Error returns a description of the unsuccessful response.
+func (err *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d getting %s", err.StatusCode, err.URL)
+}
+
+// HTTPStatusCode returns the status code of the unsuccessful response.
+func (err *HTTPStatusError) HTTPStatusCode() int {
+	return err.StatusCode
+}
+
+// HTTPSource downloads files over HTTP or HTTPS.
+type HTTPSource struct {
+	client      HTTPClient
+	retryPolicy retry.Policy
+}
+
+// NewHTTPSource returns a new HTTPSource that downloads files with the given client, which should be one returned by
+// NewHTTPClient if redirects are to be checked against the url policy. Transient failures are retried according to
+// the given retry.Policy.
+func NewHTTPSource(client HTTPClient, retryPolicy retry.Policy) *HTTPSource {
+	return &HTTPSource{
+		client:      client,
+		retryPolicy: retryPolicy,
+	}
+}
+
+// Open downloads the file at the given URL.
+func (source *HTTPSource) Open(ctx context.Context, fileURL string) (*File, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentLength *int64
+	var contentEncoding string
+	open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, http.NoBody)
+		if err != nil {
+			return nil, "", err
+		}
+		// weak ETags cannot be used in If-Match, so a changed file with one is only noticed by comparing the ETags
+		if version != "" && !strings.HasPrefix(version, "W/") {
+			req.Header.Set("If-Match", version)
+		}
+
+		resp, err := source.client.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode == http.StatusPreconditionFailed {
+			resp.Body.Close()
+			return nil, "", &retry.ChangedError{Version: version, Err: &HTTPStatusError{URL: fileURL, StatusCode: resp.StatusCode}}
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			resp.Body.Close()
+			return nil, "", &HTTPStatusError{URL: fileURL, StatusCode: resp.StatusCode}
+		}
+
+		contentLength = nil
+		if resp.ContentLength >= 0 {
+			contentLength = &resp.ContentLength
+		}
+		contentEncoding = resp.Header.Get("Content-Encoding")
+		return resp.Body, resp.Header.Get("ETag"), nil
+	}
+
+	body, err := retry.NewReader(ctx, source.retryPolicy, retry.IsRetryable, open)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx, "file downloaded", log.Data{"url": fileURL, "content_length": getContentLengthStr(contentLength)})
+
+	return &File{
+		Body:            body,
+		Name:            u.Path,
+		ContentLength:   contentLength,
+		ContentEncoding: contentEncoding,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package event_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/event"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPSource_Open(t *testing.T) {
+	Convey("Given a server that fails the first request for a file with a server error", t, func() {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			switch {
+			case r.URL.Path != "/observations.csv.gz":
+				w.WriteHeader(http.StatusNotFound)
+			case requests == 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.Header().Set("Content-Encoding", "zstd")
+				w.Write([]byte("contents"))
+			}
+		}))
+		defer server.Close()
+		source := event.NewHTTPSource(server.Client(), retry.Policy{MaxAttempts: 3})
+
+		Convey("When the file url is opened", func() {
+			file, err := source.Open(ctx, server.URL+"/observations.csv.gz")
+			So(err, ShouldBeNil)
+			defer file.Body.Close()
+
+			Convey("Then the file is requested again and its contents and metadata are returned", func() {
+				b, err := io.ReadAll(file.Body)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "contents")
+				So(requests, ShouldEqual, 2)
+				So(*file.ContentLength, ShouldEqual, len("contents"))
+				So(file.ContentEncoding, ShouldEqual, "zstd")
+				So(file.Name, ShouldEqual, "/observations.csv.gz")
+			})
+		})
+
+		Convey("When a url for a file that does not exist is opened", func() {
+			_, err := source.Open(ctx, server.URL+"/missing.csv")
+
+			Convey("Then the status error is returned without retrying", func() {
+				So(err, ShouldResemble, &event.HTTPStatusError{URL: server.URL + "/missing.csv", StatusCode: http.StatusNotFound})
+				So(requests, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestHTTPSource_Reopen(t *testing.T) {
+	Convey("Given a server that drops the connection part of the way through a file and then changes it", t, func() {
+		var ifMatch []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+			if len(ifMatch) > 1 {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("contents"))
+		}))
+		defer server.Close()
+		source := event.NewHTTPSource(server.Client(), retry.Policy{MaxAttempts: 3})
+
+		Convey("When the file is read", func() {
+			file, err := source.Open(ctx, server.URL+"/observations.csv")
+			So(err, ShouldBeNil)
+			defer file.Body.Close()
+			_, err = io.ReadAll(file.Body)
+
+			Convey("Then it is only requested again if it still has the ETag it was first read with", func() {
+				So(ifMatch, ShouldResemble, []string{"", `"v1"`})
+			})
+
+			Convey("And a permanent ChangedError is returned", func() {
+				var changedErr *retry.ChangedError
+				So(errors.As(err, &changedErr), ShouldBeTrue)
+				So(changedErr.Version, ShouldEqual, `"v1"`)
+			})
+		})
+	})
+}
+
+func TestHTTPSource_Redirect(t *testing.T) {
+	Convey("Given a server that redirects an allowed file to one that the url policy denies", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/allowed.csv":
+				http.Redirect(w, r, "/denied.csv", http.StatusFound)
+			case "/moved.csv":
+				http.Redirect(w, r, "/allowed-too.csv", http.StatusFound)
+			default:
+				w.Write([]byte(exampleHeader + "\n" + exampleCsvLine + "\n"))
+			}
+		}))
+		defer server.Close()
+
+		deny, err := urlpolicy.ParseRule("*/denied.csv")
+		So(err, ShouldBeNil)
+		policy := urlpolicy.Policy{Deny: []urlpolicy.Rule{deny}}
+		sources := map[string]event.FileSource{event.SchemeHTTP: event.NewHTTPSource(event.NewHTTPClient(policy), noRetries)}
+		csvHandler := event.NewCSVHandler(sources, policy, &readingWriter{}, observation.BadRowPolicyFail, nil)
+
+		Convey("When an event for the allowed file is handled", func() {
+			err := csvHandler.Handle(ctx, &event.DimensionsInserted{InstanceID: "1234", FileURL: server.URL + "/allowed.csv"})
+
+			Convey("Then the redirect is not followed and a url policy violation is returned for the denied file", func() {
+				var violation *urlpolicy.Violation
+				So(errors.As(err, &violation), ShouldBeTrue)
+				So(violation.URL, ShouldEqual, server.URL+"/denied.csv")
+			})
+		})
+
+		Convey("When an event for a file that redirects to another allowed file is handled", func() {
+			err := csvHandler.Handle(ctx, &event.DimensionsInserted{InstanceID: "1234", FileURL: server.URL + "/moved.csv"})
+
+			Convey("Then the redirect is followed", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestHTTPSource_MaxObjectSize(t *testing.T) {
+	Convey("Given a server that streams a file without a content length", t, func() {
+		content := exampleHeader + "\n" + strings.Repeat(exampleCsvLine+"\n", 100)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Transfer-Encoding", "chunked")
+			w.Write([]byte(content))
+			w.(http.Flusher).Flush()
+		}))
+		defer server.Close()
+		sources := map[string]event.FileSource{event.SchemeHTTP: event.NewHTTPSource(server.Client(), noRetries)}
+
+		Convey("When a handler with a maximum object size smaller than the file handles an event for it", func() {
+			writer := &readingWriter{}
+			policy := urlpolicy.Policy{MaxObjectSize: int64(len(content) / 2)}
+			csvHandler := event.NewCSVHandler(sources, policy, writer, observation.BadRowPolicyFail, nil)
+
+			err := csvHandler.Handle(ctx, &event.DimensionsInserted{InstanceID: "1234", FileURL: server.URL + "/observations.csv"})
+
+			Convey("Then a url policy violation is returned once the maximum size has been read", func() {
+				var violation *urlpolicy.Violation
+				So(errors.As(err, &violation), ShouldBeTrue)
+				So(len(writer.rows), ShouldBeLessThan, 100)
+			})
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// LocalSource opens files from the local filesystem, for file URLs of the form file:///path/to/file.csv
+type LocalSource struct{}
+
+// NewLocalSource returns a new LocalSource.
+func NewLocalSource() *LocalSource {
+	return &LocalSource{}
+}
+
+// Open opens the local file for the given URL.
+func (source *LocalSource) Open(ctx context.Context, fileURL string) (*File, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file url must refer to the local host: %s", fileURL)
+	}
+
+	file, err := os.Open(u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("file url refers to a directory: %s", fileURL)
+	}
+
+	contentLength := info.Size()
+	log.Info(ctx, "local file opened", log.Data{"path": u.Path, "content_length": contentLength})
+
+	return &File{
+		Body:          file,
+		Name:          u.Path,
+		ContentLength: &contentLength,
+	}, nil
+}
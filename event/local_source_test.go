@@ -0,0 +1,110 @@
+package event_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/event"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocalSource_Open(t *testing.T) {
+	Convey("Given a local CSV file", t, func() {
+		path := filepath.Join(t.TempDir(), "observations.csv")
+		content := exampleHeader + "\n" + exampleCsvLine
+		So(os.WriteFile(path, []byte(content), 0o600), ShouldBeNil)
+		source := event.NewLocalSource()
+
+		Convey("When the file url is opened", func() {
+			file, err := source.Open(ctx, "file://"+path)
+			So(err, ShouldBeNil)
+			defer file.Body.Close()
+
+			Convey("Then the file contents and size are returned", func() {
+				b, err := io.ReadAll(file.Body)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, content)
+				So(*file.ContentLength, ShouldEqual, len(content))
+				So(file.Name, ShouldEqual, path)
+			})
+		})
+
+		Convey("When a handler with a local source handles an event for the file", func() {
+			writer := &readingWriter{}
+			csvHandler := event.NewCSVHandler(map[string]event.FileSource{event.SchemeFile: source}, urlpolicy.Policy{}, writer, observation.BadRowPolicyFail, nil)
+
+			err := csvHandler.Handle(ctx, &event.DimensionsInserted{InstanceID: "1234", FileURL: "file://" + path})
+
+			Convey("Then the observations are read from the local file", func() {
+				So(err, ShouldBeNil)
+				So(writer.rows, ShouldResemble, []string{exampleCsvLine})
+			})
+		})
+
+		Convey("When a handler whose url policy does not allow the local file handles an event for it", func() {
+			deny, err := urlpolicy.ParseRules([]string{"localhost/**"})
+			So(err, ShouldBeNil)
+			writer := &readingWriter{}
+			csvHandler := event.NewCSVHandler(map[string]event.FileSource{event.SchemeFile: source}, urlpolicy.Policy{Deny: deny}, writer, observation.BadRowPolicyFail, nil)
+
+			err = csvHandler.Handle(ctx, &event.DimensionsInserted{InstanceID: "1234", FileURL: "file://" + path})
+
+			Convey("Then a url policy violation is returned and no observations are read", func() {
+				So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+				So(writer.rows, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a handler with a maximum object size smaller than the local file handles an event for it", func() {
+			writer := &readingWriter{}
+			policy := urlpolicy.Policy{MaxObjectSize: int64(len(content) - 1)}
+			csvHandler := event.NewCSVHandler(map[string]event.FileSource{event.SchemeFile: source}, policy, writer, observation.BadRowPolicyFail, nil)
+
+			err := csvHandler.Handle(ctx, &event.DimensionsInserted{InstanceID: "1234", FileURL: "file://" + path})
+
+			Convey("Then a url policy violation is returned and no observations are read", func() {
+				So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+				So(writer.rows, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a file url for a directory is opened", func() {
+			_, err := source.Open(ctx, "file://"+filepath.Dir(path))
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a file url for a remote host is opened", func() {
+			_, err := source.Open(ctx, "file://remote-host"+path)
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+// readingWriter reads all observations while the file is still open, capturing the rows for assertions.
+type readingWriter struct {
+	rows []string
+}
+
+func (writer *readingWriter) WriteAll(ctx context.Context, reader observation.Reader, extraction observation.Extraction) error {
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		writer.rows = append(writer.rows, row.Row)
+	}
+}
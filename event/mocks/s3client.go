@@ -7,7 +7,7 @@ import (
 	"context"
 	"github.com/ONSdigital/dp-healthcheck/healthcheck"
 	"github.com/ONSdigital/dp-observation-extractor/event"
-	"io"
+	awsS3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	"sync"
 )
 
@@ -24,11 +24,11 @@ var _ event.S3Client = &S3ClientMock{}
 //			CheckerFunc: func(ctx context.Context, state *healthcheck.CheckState) error {
 //				panic("mock out the Checker method")
 //			},
-//			GetFunc: func(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
-//				panic("mock out the Get method")
+//			GetObjectFunc: func(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error) {
+//				panic("mock out the GetObject method")
 //			},
-//			GetWithPSKFunc: func(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error) {
-//				panic("mock out the GetWithPSK method")
+//			GetObjectWithPSKFunc: func(ctx context.Context, input *awsS3.GetObjectInput, psk []byte) (*awsS3.GetObjectOutput, error) {
+//				panic("mock out the GetObjectWithPSK method")
 //			},
 //		}
 //
@@ -40,11 +40,11 @@ type S3ClientMock struct {
 	// CheckerFunc mocks the Checker method.
 	CheckerFunc func(ctx context.Context, state *healthcheck.CheckState) error
 
-	// GetFunc mocks the Get method.
-	GetFunc func(ctx context.Context, key string) (io.ReadCloser, *int64, error)
+	// GetObjectFunc mocks the GetObject method.
+	GetObjectFunc func(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error)
 
-	// GetWithPSKFunc mocks the GetWithPSK method.
-	GetWithPSKFunc func(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error)
+	// GetObjectWithPSKFunc mocks the GetObjectWithPSK method.
+	GetObjectWithPSKFunc func(ctx context.Context, input *awsS3.GetObjectInput, psk []byte) (*awsS3.GetObjectOutput, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -55,26 +55,26 @@ type S3ClientMock struct {
 			// State is the state argument value.
 			State *healthcheck.CheckState
 		}
-		// Get holds details about calls to the Get method.
-		Get []struct {
+		// GetObject holds details about calls to the GetObject method.
+		GetObject []struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
-			// Key is the key argument value.
-			Key string
+			// Input is the input argument value.
+			Input *awsS3.GetObjectInput
 		}
-		// GetWithPSK holds details about calls to the GetWithPSK method.
-		GetWithPSK []struct {
+		// GetObjectWithPSK holds details about calls to the GetObjectWithPSK method.
+		GetObjectWithPSK []struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
-			// Key is the key argument value.
-			Key string
+			// Input is the input argument value.
+			Input *awsS3.GetObjectInput
 			// Psk is the psk argument value.
 			Psk []byte
 		}
 	}
-	lockChecker    sync.RWMutex
-	lockGet        sync.RWMutex
-	lockGetWithPSK sync.RWMutex
+	lockChecker          sync.RWMutex
+	lockGetObject        sync.RWMutex
+	lockGetObjectWithPSK sync.RWMutex
 }
 
 // Checker calls CheckerFunc.
@@ -113,78 +113,78 @@ func (mock *S3ClientMock) CheckerCalls() []struct {
 	return calls
 }
 
-// Get calls GetFunc.
-func (mock *S3ClientMock) Get(ctx context.Context, key string) (io.ReadCloser, *int64, error) {
-	if mock.GetFunc == nil {
-		panic("S3ClientMock.GetFunc: method is nil but S3Client.Get was just called")
+// GetObject calls GetObjectFunc.
+func (mock *S3ClientMock) GetObject(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error) {
+	if mock.GetObjectFunc == nil {
+		panic("S3ClientMock.GetObjectFunc: method is nil but S3Client.GetObject was just called")
 	}
 	callInfo := struct {
-		Ctx context.Context
-		Key string
+		Ctx   context.Context
+		Input *awsS3.GetObjectInput
 	}{
-		Ctx: ctx,
-		Key: key,
+		Ctx:   ctx,
+		Input: input,
 	}
-	mock.lockGet.Lock()
-	mock.calls.Get = append(mock.calls.Get, callInfo)
-	mock.lockGet.Unlock()
-	return mock.GetFunc(ctx, key)
+	mock.lockGetObject.Lock()
+	mock.calls.GetObject = append(mock.calls.GetObject, callInfo)
+	mock.lockGetObject.Unlock()
+	return mock.GetObjectFunc(ctx, input)
 }
 
-// GetCalls gets all the calls that were made to Get.
+// GetObjectCalls gets all the calls that were made to GetObject.
 // Check the length with:
 //
-//	len(mockedS3Client.GetCalls())
-func (mock *S3ClientMock) GetCalls() []struct {
-	Ctx context.Context
-	Key string
+//	len(mockedS3Client.GetObjectCalls())
+func (mock *S3ClientMock) GetObjectCalls() []struct {
+	Ctx   context.Context
+	Input *awsS3.GetObjectInput
 } {
 	var calls []struct {
-		Ctx context.Context
-		Key string
+		Ctx   context.Context
+		Input *awsS3.GetObjectInput
 	}
-	mock.lockGet.RLock()
-	calls = mock.calls.Get
-	mock.lockGet.RUnlock()
+	mock.lockGetObject.RLock()
+	calls = mock.calls.GetObject
+	mock.lockGetObject.RUnlock()
 	return calls
 }
 
-// GetWithPSK calls GetWithPSKFunc.
-func (mock *S3ClientMock) GetWithPSK(ctx context.Context, key string, psk []byte) (io.ReadCloser, *int64, error) {
-	if mock.GetWithPSKFunc == nil {
-		panic("S3ClientMock.GetWithPSKFunc: method is nil but S3Client.GetWithPSK was just called")
+// GetObjectWithPSK calls GetObjectWithPSKFunc.
+func (mock *S3ClientMock) GetObjectWithPSK(ctx context.Context, input *awsS3.GetObjectInput, psk []byte) (*awsS3.GetObjectOutput, error) {
+	if mock.GetObjectWithPSKFunc == nil {
+		panic("S3ClientMock.GetObjectWithPSKFunc: method is nil but S3Client.GetObjectWithPSK was just called")
 	}
 	callInfo := struct {
-		Ctx context.Context
-		Key string
-		Psk []byte
+		Ctx   context.Context
+		Input *awsS3.GetObjectInput
+		Psk   []byte
 	}{
-		Ctx: ctx,
-		Key: key,
-		Psk: psk,
+		Ctx:   ctx,
+		Input: input,
+		Psk:   psk,
 	}
-	mock.lockGetWithPSK.Lock()
-	mock.calls.GetWithPSK = append(mock.calls.GetWithPSK, callInfo)
-	mock.lockGetWithPSK.Unlock()
-	return mock.GetWithPSKFunc(ctx, key, psk)
+	mock.lockGetObjectWithPSK.Lock()
+	mock.calls.GetObjectWithPSK = append(mock.calls.GetObjectWithPSK, callInfo)
+	mock.lockGetObjectWithPSK.Unlock()
+	return mock.GetObjectWithPSKFunc(ctx, input, psk)
 }
 
-// GetWithPSKCalls gets all the calls that were made to GetWithPSK.
+// GetObjectWithPSKCalls gets all the calls that were made to GetObjectWithPSK.
 // Check the length with:
 //
-//	len(mockedS3Client.GetWithPSKCalls())
-func (mock *S3ClientMock) GetWithPSKCalls() []struct {
-	Ctx context.Context
-	Key string
-	Psk []byte
+//	len(mockedS3Client.GetObjectWithPSKCalls())
+func (mock *S3ClientMock) GetObjectWithPSKCalls() []struct {
+	Ctx   context.Context
+	Input *awsS3.GetObjectInput
+	Psk   []byte
 } {
 	var calls []struct {
-		Ctx context.Context
-		Key string
-		Psk []byte
+		Ctx   context.Context
+		Input *awsS3.GetObjectInput
+		Psk   []byte
 	}
-	mock.lockGetWithPSK.RLock()
-	calls = mock.calls.GetWithPSK
-	mock.lockGetWithPSK.RUnlock()
+	mock.lockGetObjectWithPSK.RLock()
+	calls = mock.calls.GetObjectWithPSK
+	mock.lockGetObjectWithPSK.RUnlock()
 	return calls
 }
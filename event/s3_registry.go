@@ -0,0 +1,129 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Possible modes of a BucketPolicy
+const (
+	BucketAllowList = "allow-list"
+	BucketDenyList  = "deny-list"
+)
+
+// ErrBucketNotAllowed is returned when an event refers to an S3 bucket that the bucket policy does not allow.
+var ErrBucketNotAllowed = errors.New("s3 bucket not allowed by bucket policy")
+
+// BucketPolicy decides which S3 buckets files may be read from. In allow-list mode only the listed buckets are
+// allowed, and in deny-list mode all buckets except the listed ones are allowed.
+type BucketPolicy struct {
+	Mode    string
+	Buckets []string
+}
+
+// Allows returns true if files may be read from the given bucket.
+func (policy BucketPolicy) Allows(bucketName string) bool {
+	listed := slices.Contains(policy.Buckets, bucketName)
+	if policy.Mode == BucketDenyList {
+		return !listed
+	}
+	return listed
+}
+
+// S3ClientRegistry holds an S3 client for each bucket that files are read from. Clients for buckets that were not
+// known when the registry was created are created the first time they are needed, if the bucket policy allows it,
+// and are then reused for later events. It is safe for concurrent use.
+type S3ClientRegistry struct {
+	mutex     sync.Mutex
+	clients   map[string]S3Client
+	created   map[string]S3Client
+	policy    BucketPolicy
+	newClient func(bucketName string) S3Client
+}
+
+// NewS3ClientRegistry returns a new S3ClientRegistry containing the given clients, mapped by bucket name. newClient
+// creates clients for other buckets, which are health checked together by the registry's Checker.
+func NewS3ClientRegistry(clients map[string]S3Client, policy BucketPolicy, newClient func(bucketName string) S3Client) *S3ClientRegistry {
+	registry := &S3ClientRegistry{
+		clients:   make(map[string]S3Client, len(clients)),
+		created:   make(map[string]S3Client),
+		policy:    policy,
+		newClient: newClient,
+	}
+	for bucketName, client := range clients {
+		registry.clients[bucketName] = client
+	}
+	return registry
+}
+
+// Get returns the S3 client for the given bucket, creating it if it does not exist yet. ErrBucketNotAllowed is
+// returned if the bucket policy does not allow files to be read from the bucket.
+func (registry *S3ClientRegistry) Get(ctx context.Context, bucketName string) (S3Client, error) {
+	if !registry.policy.Allows(bucketName) {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotAllowed, bucketName)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if client, ok := registry.clients[bucketName]; ok {
+		return client, nil
+	}
+
+	if registry.newClient == nil {
+		return nil, fmt.Errorf("no s3 client for bucket: %s", bucketName)
+	}
+
+	log.Info(ctx, "creating s3 client for new bucket", log.Data{"bucket": bucketName})
+	client := registry.newClient(bucketName)
+
+	registry.clients[bucketName] = client
+	registry.created[bucketName] = client
+	return client, nil
+}
+
+// Checker checks the clients created for buckets that were not known when the registry was created. The clients it
+// was created with are expected to be health checked individually. As the buckets come from events rather than
+// configuration, a bucket that cannot be reached is reported as a warning rather than making the service critical.
+func (registry *S3ClientRegistry) Checker(ctx context.Context, state *healthcheck.CheckState) error {
+	registry.mutex.Lock()
+	created := make(map[string]S3Client, len(registry.created))
+	for bucketName, client := range registry.created {
+		created[bucketName] = client
+	}
+	registry.mutex.Unlock()
+
+	var unhealthy []string
+	for bucketName, client := range created {
+		bucketState := healthcheck.NewCheckState(bucketName)
+		if err := client.Checker(ctx, bucketState); err != nil || bucketState.Status() != healthcheck.StatusOK {
+			unhealthy = append(unhealthy, bucketName)
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		return state.Update(healthcheck.StatusWarning, "s3 buckets cannot be reached: "+strings.Join(unhealthy, ", "), 0)
+	}
+	return state.Update(healthcheck.StatusOK, fmt.Sprintf("%d s3 buckets from events are healthy", len(created)), 0)
+}
+
+// Clients returns a copy of the clients currently held, mapped by bucket name.
+func (registry *S3ClientRegistry) Clients() map[string]S3Client {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	clients := make(map[string]S3Client, len(registry.clients))
+	for bucketName, client := range registry.clients {
+		clients[bucketName] = client
+	}
+	return clients
+}
@@ -0,0 +1,138 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/dp-observation-extractor/event"
+	mock "github.com/ONSdigital/dp-observation-extractor/event/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBucketPolicy_Allows(t *testing.T) {
+	Convey("Given an allow-list bucket policy", t, func() {
+		policy := event.BucketPolicy{Mode: event.BucketAllowList, Buckets: []string{"allowed"}}
+
+		Convey("Then only the listed buckets are allowed", func() {
+			So(policy.Allows("allowed"), ShouldBeTrue)
+			So(policy.Allows("other"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a deny-list bucket policy", t, func() {
+		policy := event.BucketPolicy{Mode: event.BucketDenyList, Buckets: []string{"denied"}}
+
+		Convey("Then all buckets except the listed buckets are allowed", func() {
+			So(policy.Allows("denied"), ShouldBeFalse)
+			So(policy.Allows("other"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestS3ClientRegistry_Get(t *testing.T) {
+	Convey("Given a registry with a client for an existing bucket and a deny-list policy", t, func() {
+		existing := &mock.S3ClientMock{}
+		created := []string{}
+		mutex := &sync.Mutex{}
+		newClient := func(bucketName string) event.S3Client {
+			mutex.Lock()
+			defer mutex.Unlock()
+			created = append(created, bucketName)
+			return &mock.S3ClientMock{}
+		}
+		policy := event.BucketPolicy{Mode: event.BucketDenyList, Buckets: []string{"denied"}}
+		registry := event.NewS3ClientRegistry(map[string]event.S3Client{"existing": existing}, policy, newClient)
+
+		Convey("When a client is requested for the existing bucket", func() {
+			client, err := registry.Get(ctx, "existing")
+
+			Convey("Then the existing client is returned and no client is created", func() {
+				So(err, ShouldBeNil)
+				So(client, ShouldEqual, existing)
+				So(created, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When clients are requested concurrently for a new bucket", func() {
+			clients := make([]event.S3Client, 10)
+			wg := &sync.WaitGroup{}
+			for i := range clients {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					clients[i], _ = registry.Get(ctx, "new")
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("Then a single client is created and reused", func() {
+				So(created, ShouldResemble, []string{"new"})
+				for _, client := range clients {
+					So(client, ShouldEqual, clients[0])
+				}
+				So(registry.Clients(), ShouldContainKey, "new")
+			})
+		})
+
+		Convey("When a client is requested for a denied bucket", func() {
+			client, err := registry.Get(ctx, "denied")
+
+			Convey("Then ErrBucketNotAllowed is returned and no client is created", func() {
+				So(errors.Is(err, event.ErrBucketNotAllowed), ShouldBeTrue)
+				So(client, ShouldBeNil)
+				So(created, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestS3ClientRegistry_Checker(t *testing.T) {
+	Convey("Given a registry with a client for an existing bucket that cannot be reached", t, func() {
+		unreachable := func(ctx context.Context, state *healthcheck.CheckState) error {
+			return state.Update(healthcheck.StatusCritical, "bucket not found", 0)
+		}
+		reachable := func(ctx context.Context, state *healthcheck.CheckState) error {
+			return state.Update(healthcheck.StatusOK, "ok", 0)
+		}
+		newClientChecker := reachable
+		registry := event.NewS3ClientRegistry(map[string]event.S3Client{"existing": &mock.S3ClientMock{CheckerFunc: unreachable}},
+			event.BucketPolicy{Mode: event.BucketDenyList},
+			func(bucketName string) event.S3Client { return &mock.S3ClientMock{CheckerFunc: newClientChecker} })
+
+		Convey("When it is checked before any clients have been created", func() {
+			state := healthcheck.NewCheckState("S3 buckets from events")
+			So(registry.Checker(ctx, state), ShouldBeNil)
+
+			Convey("Then the state is OK, as the existing bucket is checked separately", func() {
+				So(state.Status(), ShouldEqual, healthcheck.StatusOK)
+			})
+		})
+
+		Convey("When a client is created for a bucket that can be reached and the registry is checked", func() {
+			_, err := registry.Get(ctx, "new")
+			So(err, ShouldBeNil)
+			state := healthcheck.NewCheckState("S3 buckets from events")
+			So(registry.Checker(ctx, state), ShouldBeNil)
+
+			Convey("Then the state is OK", func() {
+				So(state.Status(), ShouldEqual, healthcheck.StatusOK)
+			})
+		})
+
+		Convey("When a client is created for a bucket that cannot be reached and the registry is checked", func() {
+			newClientChecker = unreachable
+			_, err := registry.Get(ctx, "missing")
+			So(err, ShouldBeNil)
+			state := healthcheck.NewCheckState("S3 buckets from events")
+			So(registry.Checker(ctx, state), ShouldBeNil)
+
+			Convey("Then a warning naming the bucket is reported, rather than making the service critical", func() {
+				So(state.Status(), ShouldEqual, healthcheck.StatusWarning)
+				So(state.Message(), ShouldContainSubstring, "missing")
+			})
+		})
+	})
+}
@@ -0,0 +1,165 @@
+package event
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+	s3client "github.com/ONSdigital/dp-s3/v3"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsS3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//go:generate moq -out mocks/s3client.go -pkg mock . S3Client
+//go:generate moq -out mocks/vault.go -pkg mock . VaultClient
+
+// S3Client represents the S3 client for a bucket with the required methods. Objects are got with a GetObjectInput,
+// rather than by key as in dp-s3, so that reopening an object can be made conditional on its ETag.
+type S3Client interface {
+	GetObject(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error)
+	GetObjectWithPSK(ctx context.Context, input *awsS3.GetObjectInput, psk []byte) (*awsS3.GetObjectOutput, error)
+	Checker(ctx context.Context, state *healthcheck.CheckState) error
+}
+
+// S3ClientProvider provides the S3 client to read files from each bucket
+type S3ClientProvider interface {
+	Get(ctx context.Context, bucketName string) (S3Client, error)
+}
+
+// VaultClient is an interface to represent methods called to action upon vault
+type VaultClient interface {
+	ReadKey(path, key string) (string, error)
+	Checker(ctx context.Context, state *healthcheck.CheckState) error
+}
+
+// S3Source opens files from S3, decrypting them with a PSK from vault if a vault client is provided.
+type S3Source struct {
+	s3Clients   S3ClientProvider
+	vaultClient VaultClient
+	vaultPath   string
+	retryPolicy retry.Policy
+}
+
+// NewS3Source returns a new S3Source. Transient failures reading from Vault and S3 are retried according to the
+// given retry.Policy.
+func NewS3Source(s3Clients S3ClientProvider, vaultClient VaultClient, vaultPath string, retryPolicy retry.Policy) *S3Source {
+	return &S3Source{
+		s3Clients:   s3Clients,
+		vaultClient: vaultClient,
+		vaultPath:   vaultPath,
+		retryPolicy: retryPolicy,
+	}
+}
+
+// Open gets the S3 object for the given URL, of the form s3://bucket/k/e/y
+func (source *S3Source) Open(ctx context.Context, fileURL string) (*File, error) {
+	logData := log.Data{"url": fileURL}
+
+	s3Url, err := s3client.ParseURL(fileURL, s3client.AliasVirtualHostedStyle)
+	if err != nil {
+		log.Error(ctx, "unable to find bucket and filename in event file url", err, logData)
+		return nil, err
+	}
+	logData["bucket"] = s3Url.BucketName
+	logData["filename"] = s3Url.Key
+
+	// Get S3 Client corresponding to the Bucket extracted from URL
+	s3, err := source.s3Clients.Get(ctx, s3Url.BucketName)
+	if errors.Is(err, ErrBucketNotAllowed) {
+		err = &urlpolicy.Violation{Bucket: s3Url.BucketName, Key: s3Url.Key, Reason: "bucket not allowed by bucket policy", Err: err}
+	}
+	if err != nil {
+		log.Error(ctx, "unable to get s3 client for bucket", err, logData)
+		return nil, err
+	}
+
+	getObject := s3.GetObject
+	if source.vaultClient != nil {
+		vaultPath := source.vaultPath + "/" + s3Url.Key
+		vaultKey := "key"
+		logData["vault_path"] = vaultPath
+
+		log.Info(ctx, "attempting to get psk from vault", logData)
+		var pskStr string
+		err = retry.Do(ctx, source.retryPolicy, retry.IsRetryable, func() (err error) {
+			timer := prometheus.NewTimer(metrics.VaultReadDuration)
+			defer timer.ObserveDuration()
+			pskStr, err = source.vaultClient.ReadKey(vaultPath, vaultKey)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		log.Info(ctx, "got psk", logData)
+		psk, err := hex.DecodeString(pskStr)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Info(ctx, "attempting to get S3 object with psk", logData)
+		getObject = func(ctx context.Context, input *awsS3.GetObjectInput) (*awsS3.GetObjectOutput, error) {
+			return s3.GetObjectWithPSK(ctx, input, psk)
+		}
+	} else {
+		log.Info(ctx, "attempting to get S3 object", logData)
+	}
+
+	var contentLength *int64
+	var contentEncoding string
+	open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+		input := &awsS3.GetObjectInput{
+			Bucket: aws.String(s3Url.BucketName),
+			Key:    aws.String(s3Url.Key),
+		}
+		if version != "" {
+			input.IfMatch = aws.String(version)
+		}
+
+		output, err := getObject(ctx, input)
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+			return nil, "", &retry.ChangedError{Version: version, Err: err}
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		contentLength = output.ContentLength
+		contentEncoding = aws.ToString(output.ContentEncoding)
+		return output.Body, aws.ToString(output.ETag), nil
+	}
+
+	body, err := retry.NewReader(ctx, source.retryPolicy, retry.IsRetryable, open)
+	if err != nil {
+		log.Error(ctx, "unable to retrieve s3 output object", err, logData)
+		return nil, err
+	}
+
+	logData["content_length"] = getContentLengthStr(contentLength)
+	log.Info(ctx, "file read from s3", logData)
+
+	return &File{
+		Body:            body,
+		Name:            s3Url.Key,
+		ContentLength:   contentLength,
+		ContentEncoding: contentEncoding,
+	}, nil
+}
+
+// getContentLengthStr returns the string representation of the provided *int64, returning '0' if it is nil
+func getContentLengthStr(cLen *int64) string {
+	if cLen == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*cLen, 10)
+}
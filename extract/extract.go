@@ -0,0 +1,151 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ONSdigital/dp-observation-extractor/compression"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Possible output formats
+const (
+	FormatNDJSON = sink.FormatNDJSON
+	FormatAvro   = sink.FormatAvro
+	FormatRaw    = sink.FormatRaw
+)
+
+// Stdout is the output path used to write to standard output.
+const Stdout = "-"
+
+// Options for extracting observations from a local file.
+type Options struct {
+	File         string
+	InstanceID   string
+	Out          string
+	Format       string
+	BadRowPolicy observation.BadRowPolicy
+	Selection    observation.Selection
+}
+
+// ParseArgs parses the command line arguments of the extract command into Options. If no format is given, it is
+// inferred from the extension of the output file, defaulting to NDJSON.
+func ParseArgs(args []string, output io.Writer) (*Options, error) {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	opts := &Options{}
+	var badRowPolicy string
+	flags.StringVar(&opts.File, "file", "", "the CSV file to extract observations from, which may be compressed")
+	flags.StringVar(&opts.InstanceID, "instance", "", "the instance ID to include in each observation extracted event")
+	flags.StringVar(&opts.Out, "out", Stdout, "the file to write the observation extracted events to, or - for standard output")
+	flags.StringVar(&opts.Format, "format", "", "the output format: ndjson, avro for an avro object container file, or raw for the messages that would be sent to kafka")
+	flags.StringVar(&badRowPolicy, "bad-row-policy", string(observation.BadRowPolicyFail), "what to do with rows that have the wrong number of columns: fail, skip or pass")
+	flags.Int64Var(&opts.Selection.FirstRow, "first-row", 0, "the row index of the first row to extract, where the first row after the header is 1")
+	flags.Int64Var(&opts.Selection.LastRow, "last-row", 0, "the row index of the last row to extract, or 0 to extract to the end of the file")
+	flags.Int64Var(&opts.Selection.Limit, "limit", 0, "the most rows to extract, or 0 for no limit")
+	flags.Int64Var(&opts.Selection.SampleEvery, "sample-every", 0, "extract one row in every N rows, starting from the first row extracted")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if opts.File == "" {
+		return nil, errors.New("no --file given")
+	}
+	if opts.InstanceID == "" {
+		return nil, errors.New("no --instance given")
+	}
+
+	switch observation.BadRowPolicy(badRowPolicy) {
+	case observation.BadRowPolicyFail, observation.BadRowPolicySkip, observation.BadRowPolicyPass:
+		opts.BadRowPolicy = observation.BadRowPolicy(badRowPolicy)
+	default:
+		return nil, fmt.Errorf("invalid --bad-row-policy: %s", badRowPolicy)
+	}
+
+	if err := opts.Selection.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.Format == "" {
+		opts.Format = FormatNDJSON
+		if filepath.Ext(opts.Out) == ".avro" {
+			opts.Format = FormatAvro
+		}
+	}
+	switch opts.Format {
+	case FormatNDJSON, FormatAvro, FormatRaw:
+	default:
+		return nil, fmt.Errorf("invalid --format: %s", opts.Format)
+	}
+
+	return opts, nil
+}
+
+// Run extracts the observations from the local file described by the options, and writes the observation extracted
+// events to the output file instead of sending them to kafka. The messages are produced by observation.MessageWriter,
+// so they are identical to the messages the service would send for the same file. Avro output is an object container
+// file of the observation extracted events, and raw output is the messages one after another.
+func Run(ctx context.Context, opts Options) (err error) {
+	in, err := os.Open(opts.File)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	decompressed, compressionFormat, err := compression.NewReader(in, opts.File, "")
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+
+	reader, err := observation.NewCSVReader(decompressed, opts.BadRowPolicy)
+	if err != nil {
+		return err
+	}
+	if err = reader.Select(opts.Selection); err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Out != Stdout {
+		var file *os.File
+		file, err = os.Create(opts.Out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out = file
+	}
+
+	output, err := sink.NewWriter(out, opts.Format, sink.ExtractedEvents)
+	if err != nil {
+		return err
+	}
+
+	logData := log.Data{"file": opts.File, "out": opts.Out, "format": opts.Format, "compression": compressionFormat}
+	log.Info(ctx, "extracting observations from local file", logData)
+
+	err = observation.NewMessageWriter(output, nil, nil, 0, 1, 0, nil).WriteAll(ctx, reader, observation.Extraction{InstanceID: opts.InstanceID})
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info(ctx, "observations extracted from local file", logData)
+	return nil
+}
@@ -0,0 +1,261 @@
+package extract_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/extract"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/go-avro/avro"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const csvContent = "V4_0,time,time,geography,geography\n" +
+	"1,2020,2020,K02000001,UK\n" +
+	"2,2021,2021,K02000001,\"United, Kingdom\"\n"
+
+func TestParseArgs(t *testing.T) {
+	Convey("Given only the required arguments", t, func() {
+		args := []string{"--file", "data.csv", "--instance", "123"}
+
+		Convey("When ParseArgs is called", func() {
+			opts, err := extract.ParseArgs(args, io.Discard)
+
+			Convey("Then the defaults are used for the other options", func() {
+				So(err, ShouldBeNil)
+				So(*opts, ShouldResemble, extract.Options{
+					File:         "data.csv",
+					InstanceID:   "123",
+					Out:          extract.Stdout,
+					Format:       extract.FormatNDJSON,
+					BadRowPolicy: observation.BadRowPolicyFail,
+				})
+			})
+		})
+	})
+
+	Convey("Given an output file with an avro extension", t, func() {
+		args := []string{"--file", "data.csv", "--instance", "123", "--out", "out.avro", "--bad-row-policy", "skip"}
+
+		Convey("When ParseArgs is called", func() {
+			opts, err := extract.ParseArgs(args, io.Discard)
+
+			Convey("Then the avro format is used", func() {
+				So(err, ShouldBeNil)
+				So(opts.Format, ShouldEqual, extract.FormatAvro)
+				So(opts.BadRowPolicy, ShouldEqual, observation.BadRowPolicySkip)
+			})
+		})
+	})
+
+	Convey("Given the raw format and an output file with an avro extension", t, func() {
+		args := []string{"--file", "data.csv", "--instance", "123", "--out", "out.avro", "--format", "raw"}
+
+		Convey("When ParseArgs is called", func() {
+			opts, err := extract.ParseArgs(args, io.Discard)
+
+			Convey("Then the given format is used", func() {
+				So(err, ShouldBeNil)
+				So(opts.Format, ShouldEqual, extract.FormatRaw)
+			})
+		})
+	})
+
+	Convey("Given a selection of rows", t, func() {
+		args := []string{"--file", "data.csv", "--instance", "123", "--first-row", "10", "--last-row", "100", "--limit", "5", "--sample-every", "3"}
+
+		Convey("When ParseArgs is called", func() {
+			opts, err := extract.ParseArgs(args, io.Discard)
+
+			Convey("Then the selection is returned in the options", func() {
+				So(err, ShouldBeNil)
+				So(opts.Selection, ShouldResemble, observation.Selection{FirstRow: 10, LastRow: 100, Limit: 5, SampleEvery: 3})
+			})
+		})
+	})
+
+	Convey("Given invalid arguments", t, func() {
+		Convey("When no file is given, then an error is returned", func() {
+			_, err := extract.ParseArgs([]string{"--instance", "123"}, io.Discard)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "no --file given")
+		})
+
+		Convey("When no instance is given, then an error is returned", func() {
+			_, err := extract.ParseArgs([]string{"--file", "data.csv"}, io.Discard)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "no --instance given")
+		})
+
+		Convey("When an invalid format is given, then an error is returned", func() {
+			_, err := extract.ParseArgs([]string{"--file", "data.csv", "--instance", "123", "--format", "csv"}, io.Discard)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid --format: csv")
+		})
+
+		Convey("When an invalid bad row policy is given, then an error is returned", func() {
+			_, err := extract.ParseArgs([]string{"--file", "data.csv", "--instance", "123", "--bad-row-policy", "ignore"}, io.Discard)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid --bad-row-policy: ignore")
+		})
+
+		Convey("When a last row before the first row is given, then an error is returned", func() {
+			_, err := extract.ParseArgs([]string{"--file", "data.csv", "--instance", "123", "--first-row", "5", "--last-row", "4"}, io.Discard)
+			So(errors.Is(err, observation.ErrInvalidSelection), ShouldBeTrue)
+		})
+	})
+}
+
+func TestRun(t *testing.T) {
+	Convey("Given a local CSV file", t, func() {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "data.csv")
+		So(os.WriteFile(file, []byte(csvContent), 0o600), ShouldBeNil)
+
+		expected := expectedMessages("123")
+
+		Convey("When Run is called with the avro format", func() {
+			out := filepath.Join(dir, "out.avro")
+			err := extract.Run(context.Background(), extract.Options{
+				File:         file,
+				InstanceID:   "123",
+				Out:          out,
+				Format:       extract.FormatAvro,
+				BadRowPolicy: observation.BadRowPolicyFail,
+			})
+
+			Convey("Then the output is an avro object container file of the observation extracted events", func() {
+				So(err, ShouldBeNil)
+				reader, err := avro.NewDataFileReader(out)
+				So(err, ShouldBeNil)
+				defer reader.Close()
+
+				var events []observation.ExtractedEvent
+				for reader.HasNext() {
+					var event observation.ExtractedEvent
+					So(reader.Next(&event), ShouldBeNil)
+					events = append(events, event)
+				}
+				So(reader.Err(), ShouldBeNil)
+				So(events, ShouldResemble, []observation.ExtractedEvent{
+					{InstanceID: "123", RowIndex: 1, Row: "1,2020,2020,K02000001,UK"},
+					{InstanceID: "123", RowIndex: 2, Row: `2,2021,2021,K02000001,"United, Kingdom"`},
+				})
+			})
+		})
+
+		Convey("When Run is called with the raw format", func() {
+			out := filepath.Join(dir, "out.bin")
+			err := extract.Run(context.Background(), extract.Options{
+				File:         file,
+				InstanceID:   "123",
+				Out:          out,
+				Format:       extract.FormatRaw,
+				BadRowPolicy: observation.BadRowPolicyFail,
+			})
+
+			Convey("Then the output is the messages that would be sent to kafka", func() {
+				So(err, ShouldBeNil)
+				written, err := os.ReadFile(out)
+				So(err, ShouldBeNil)
+				So(written, ShouldResemble, bytes.Join(expected, nil))
+			})
+		})
+
+		Convey("When Run is called with the ndjson format", func() {
+			out := filepath.Join(dir, "out.ndjson")
+			err := extract.Run(context.Background(), extract.Options{
+				File:         file,
+				InstanceID:   "123",
+				Out:          out,
+				Format:       extract.FormatNDJSON,
+				BadRowPolicy: observation.BadRowPolicyFail,
+			})
+
+			Convey("Then a line is written for each row, including the message that would be sent to kafka", func() {
+				So(err, ShouldBeNil)
+				written, err := os.Open(out)
+				So(err, ShouldBeNil)
+				defer written.Close()
+
+				var lines []map[string]interface{}
+				scanner := bufio.NewScanner(written)
+				for scanner.Scan() {
+					var line map[string]interface{}
+					So(json.Unmarshal(scanner.Bytes(), &line), ShouldBeNil)
+					lines = append(lines, line)
+				}
+				So(lines, ShouldHaveLength, 2)
+
+				So(lines[0]["instance_id"], ShouldEqual, "123")
+				So(lines[0]["row_index"], ShouldEqual, 1)
+				So(lines[0]["row"], ShouldEqual, "1,2020,2020,K02000001,UK")
+				So(lines[1]["row"], ShouldEqual, `2,2021,2021,K02000001,"United, Kingdom"`)
+
+				for i, line := range lines {
+					message, err := base64.StdEncoding.DecodeString(line["message"].(string))
+					So(err, ShouldBeNil)
+					So(message, ShouldResemble, expected[i])
+				}
+			})
+		})
+	})
+
+	Convey("Given a local CSV file and a selection of its second row", t, func() {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "data.csv")
+		So(os.WriteFile(file, []byte(csvContent), 0o600), ShouldBeNil)
+
+		Convey("When Run is called", func() {
+			out := filepath.Join(dir, "out.bin")
+			err := extract.Run(context.Background(), extract.Options{
+				File:         file,
+				InstanceID:   "123",
+				Out:          out,
+				Format:       extract.FormatRaw,
+				BadRowPolicy: observation.BadRowPolicyFail,
+				Selection:    observation.Selection{FirstRow: 2},
+			})
+
+			Convey("Then only the message for the second row is written, with its original row index", func() {
+				So(err, ShouldBeNil)
+				written, err := os.ReadFile(out)
+				So(err, ShouldBeNil)
+				So(written, ShouldResemble, expectedMessages("123")[1])
+			})
+		})
+	})
+
+	Convey("Given a file that does not exist", t, func() {
+		file := filepath.Join(t.TempDir(), "missing.csv")
+
+		Convey("When Run is called", func() {
+			err := extract.Run(context.Background(), extract.Options{File: file, InstanceID: "123", Out: extract.Stdout})
+
+			Convey("Then an error is returned", func() {
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// expectedMessages returns the messages observation.MessageWriter sends for the rows in csvContent.
+func expectedMessages(instanceID string) [][]byte {
+	rows := []string{"1,2020,2020,K02000001,UK", `2,2021,2021,K02000001,"United, Kingdom"`}
+
+	var messages [][]byte
+	for i, row := range rows {
+		message, err := observation.Marshal(observation.ExtractedEvent{RowIndex: int64(i + 1), Row: row, InstanceID: instanceID})
+		So(err, ShouldBeNil)
+		messages = append(messages, message)
+	}
+	return messages
+}
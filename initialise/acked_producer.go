@@ -0,0 +1,129 @@
+package initialise
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/dp-observation-extractor/config"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	"github.com/Shopify/sarama"
+	saramatls "github.com/Shopify/sarama/tools/tls"
+)
+
+// certPrefix identifies certificates and keys given as PEM strings rather than file paths, as in dp-kafka
+const certPrefix = "-----BEGIN "
+
+// AckedProducer is a kafka sink for observations that confirms the delivery of each message. dp-kafka producers do
+// not return successes, so it uses a sarama producer directly.
+type AckedProducer struct {
+	*sink.AckedKafka
+	client sarama.Client
+	topic  string
+}
+
+// GetAckedProducer returns a kafka sink for observations sent to the given topic, with at most maxInFlight messages
+// waiting to be acknowledged. Messages are sent in the schema registry wire format if schemaID is not zero.
+func (e *ExternalServiceList) GetAckedProducer(ctx context.Context, kafkaConfig *config.KafkaConfig, topic string, maxInFlight, schemaID int) (*AckedProducer, error) {
+	client, err := newSaramaClient(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	e.ObservationProducer = true
+
+	return &AckedProducer{
+		AckedKafka: sink.NewAckedKafka(producer, topic, maxInFlight, schemaID),
+		client:     client,
+		topic:      topic,
+	}, nil
+}
+
+// Checker checks that the topic can be reached, and updates the provided CheckState accordingly
+func (producer *AckedProducer) Checker(ctx context.Context, state *healthcheck.CheckState) error {
+	if err := producer.client.RefreshMetadata(producer.topic); err != nil {
+		return state.Update(healthcheck.StatusCritical, fmt.Sprintf("kafka observation producer cannot reach topic: %v", err), 0)
+	}
+	return state.Update(healthcheck.StatusOK, "kafka observation producer is healthy", 0)
+}
+
+// Close sends any buffered messages, waits for them to be acknowledged and then closes the producer and its client.
+func (producer *AckedProducer) Close() error {
+	err := producer.AckedKafka.Close()
+	if closeErr := producer.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// newSaramaClient returns a sarama client for the kafka configuration, set up for producers that return both successes
+// and errors.
+func newSaramaClient(kafkaConfig *config.KafkaConfig) (sarama.Client, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
+
+	version, err := sarama.ParseKafkaVersion(kafkaConfig.Version)
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Version = version
+
+	if kafkaConfig.SecProtocol == config.KafkaTLSProtocolFlag {
+		if saramaConfig.Net.TLS.Config, err = getTLSConfig(kafkaConfig); err != nil {
+			return nil, err
+		}
+		saramaConfig.Net.TLS.Enable = true
+	}
+
+	return sarama.NewClient(kafkaConfig.Brokers, saramaConfig)
+}
+
+// getTLSConfig returns the TLS config for the kafka security configuration, in the same way as dp-kafka. Certificates
+// and keys can either be PEM strings, with escaped newlines, or file paths.
+func getTLSConfig(kafkaConfig *config.KafkaConfig) (tlsConfig *tls.Config, err error) {
+	if strings.HasPrefix(kafkaConfig.SecClientCert, certPrefix) {
+		cert, err := tls.X509KeyPair([]byte(expandNewlines(kafkaConfig.SecClientCert)), []byte(expandNewlines(kafkaConfig.SecClientKey)))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+	} else if tlsConfig, err = saramatls.NewConfig(kafkaConfig.SecClientCert, kafkaConfig.SecClientKey); err != nil {
+		return nil, err
+	}
+
+	if kafkaConfig.SecCACerts != "" {
+		rootCAs := []byte(expandNewlines(kafkaConfig.SecCACerts))
+		if !strings.HasPrefix(kafkaConfig.SecCACerts, certPrefix) {
+			if rootCAs, err = os.ReadFile(kafkaConfig.SecCACerts); err != nil {
+				return nil, fmt.Errorf("failed read from %q: %w", kafkaConfig.SecCACerts, err)
+			}
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(rootCAs) {
+			return nil, errors.New("cannot load CA certs")
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	tlsConfig.InsecureSkipVerify = kafkaConfig.SecSkipVerify //nolint:gosec // only skipped if configured to
+	return tlsConfig, nil
+}
+
+// expandNewlines replaces escaped newlines in PEM strings given through the environment
+func expandNewlines(s string) string {
+	return strings.ReplaceAll(s, `\n`, "\n")
+}
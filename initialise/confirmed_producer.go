@@ -0,0 +1,67 @@
+package initialise
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/dp-observation-extractor/config"
+	"github.com/ONSdigital/dp-observation-extractor/deadletter"
+	"github.com/Shopify/sarama"
+)
+
+// ConfirmedProducer is a kafka producer that waits for each message to be acknowledged and can set headers per
+// message, for dead letters and for replaying them.
+type ConfirmedProducer struct {
+	*deadletter.Producer
+	client sarama.Client
+	topic  string
+}
+
+// GetConfirmedProducer returns a confirmed producer for the given topic. Only the DeadLetter and Replay producers
+// are confirmed producers.
+func (e *ExternalServiceList) GetConfirmedProducer(ctx context.Context, kafkaConfig *config.KafkaConfig, topic string, name KafkaProducerName) (*ConfirmedProducer, error) {
+	if name != DeadLetter && name != Replay {
+		return nil, fmt.Errorf("kafka producer name not recognised as a confirmed producer: '%s'", name.String())
+	}
+
+	client, err := newSaramaClient(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if name == DeadLetter {
+		e.DeadLetterProducer = true
+	} else {
+		e.ReplayProducer = true
+	}
+
+	return &ConfirmedProducer{
+		Producer: deadletter.NewProducer(producer, topic),
+		client:   client,
+		topic:    topic,
+	}, nil
+}
+
+// Checker checks that the topic can be reached, and updates the provided CheckState accordingly
+func (producer *ConfirmedProducer) Checker(ctx context.Context, state *healthcheck.CheckState) error {
+	if err := producer.client.RefreshMetadata(producer.topic); err != nil {
+		return state.Update(healthcheck.StatusCritical, fmt.Sprintf("kafka producer cannot reach topic: %v", err), 0)
+	}
+	return state.Update(healthcheck.StatusOK, "kafka producer is healthy", 0)
+}
+
+// Close sends any buffered messages, waits for them to be acknowledged and then closes the producer and its client.
+func (producer *ConfirmedProducer) Close() error {
+	err := producer.Producer.Close()
+	if closeErr := producer.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
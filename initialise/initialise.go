@@ -8,7 +8,6 @@ import (
 	kafka "github.com/ONSdigital/dp-kafka/v2"
 	"github.com/ONSdigital/dp-observation-extractor/config"
 	"github.com/ONSdigital/dp-observation-extractor/event"
-	s3client "github.com/ONSdigital/dp-s3/v3"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
@@ -19,8 +18,12 @@ import (
 // ExternalServiceList represents a list of services
 type ExternalServiceList struct {
 	Consumer              bool
+	DeadLetterConsumer    bool
 	ObservationProducer   bool
 	ErrorReporterProducer bool
+	CompleteProducer      bool
+	DeadLetterProducer    bool
+	ReplayProducer        bool
 	Vault                 bool
 	HealthCheck           bool
 	S3Clients             bool
@@ -33,9 +36,12 @@ type KafkaProducerName int
 const (
 	Observation = iota
 	ErrorReporter
+	ExtractionComplete
+	DeadLetter
+	Replay
 )
 
-var kafkaProducerNames = []string{"Observation", "ErrorReporter"}
+var kafkaProducerNames = []string{"Observation", "ErrorReporter", "ExtractionComplete", "DeadLetter", "Replay"}
 
 // Values of the kafka producers names
 func (k KafkaProducerName) String() string {
@@ -44,6 +50,30 @@ func (k KafkaProducerName) String() string {
 
 // GetConsumer returns a kafka consumer, which might not be initialised
 func (e *ExternalServiceList) GetConsumer(ctx context.Context, kafkaConfig *config.KafkaConfig) (*kafka.ConsumerGroup, error) {
+	kafkaConsumer, err := newConsumerGroup(ctx, kafkaConfig, kafkaConfig.FileConsumerTopic, kafkaConfig.FileConsumerGroup, kafkaConfig.NumWorkers)
+	if err != nil {
+		return kafkaConsumer, err
+	}
+
+	e.Consumer = true
+
+	return kafkaConsumer, nil
+}
+
+// GetDeadLetterConsumer returns a kafka consumer for the dead letter topic, which might not be initialised
+func (e *ExternalServiceList) GetDeadLetterConsumer(ctx context.Context, kafkaConfig *config.KafkaConfig) (*kafka.ConsumerGroup, error) {
+	kafkaConsumer, err := newConsumerGroup(ctx, kafkaConfig, kafkaConfig.DeadLetterProducerTopic, kafkaConfig.DeadLetterConsumerGroup, 1)
+	if err != nil {
+		return kafkaConsumer, err
+	}
+
+	e.DeadLetterConsumer = true
+
+	return kafkaConsumer, nil
+}
+
+// newConsumerGroup creates a kafka consumer group for the given topic and group
+func newConsumerGroup(ctx context.Context, kafkaConfig *config.KafkaConfig, topic, group string, bufferSize int) (*kafka.ConsumerGroup, error) {
 	kafkaOffset := kafka.OffsetNewest
 
 	if kafkaConfig.OffsetOldest {
@@ -63,21 +93,14 @@ func (e *ExternalServiceList) GetConsumer(ctx context.Context, kafkaConfig *conf
 		)
 	}
 
-	kafkaConsumer, err := kafka.NewConsumerGroup(
+	return kafka.NewConsumerGroup(
 		ctx,
 		kafkaConfig.Brokers,
-		kafkaConfig.FileConsumerTopic,
-		kafkaConfig.FileConsumerGroup,
-		kafka.CreateConsumerGroupChannels(1),
+		topic,
+		group,
+		kafka.CreateConsumerGroupChannels(bufferSize),
 		cgConfig,
 	)
-	if err != nil {
-		return kafkaConsumer, err
-	}
-
-	e.Consumer = true
-
-	return kafkaConsumer, nil
 }
 
 // GetProducer returns a kafka producer, which might not be initialised
@@ -107,6 +130,8 @@ func (e *ExternalServiceList) GetProducer(ctx context.Context, kafkaConfig *conf
 		e.ObservationProducer = true
 	case name == ErrorReporter:
 		e.ErrorReporterProducer = true
+	case name == ExtractionComplete:
+		e.CompleteProducer = true
 	default:
 		return nil, fmt.Errorf("kafka producer name not recognised: '%s'. valid names: %v", name.String(), kafkaProducerNames)
 	}
@@ -117,43 +142,42 @@ func (e *ExternalServiceList) GetProducer(ctx context.Context, kafkaConfig *conf
 // GetS3Clients returns a map of AWS S3 clients corresponding to the list of BucketNames
 // and the AWS region provided in the configuration. If encryption is enabled, the s3clients will be cryptoclients.
 func (e *ExternalServiceList) GetS3Clients(ctx context.Context, cfg *config.Config) (*aws.Config, map[string]event.S3Client, error) {
+	// establish AWS config
+	opts := []func(*awsConfig.LoadOptions) error{awsConfig.WithRegion(cfg.AWSRegion)}
 	if cfg.LocalstackHost != "" {
-		awsConfig, err := awsConfig.LoadDefaultConfig(ctx,
-			awsConfig.WithRegion(cfg.AWSRegion),
-			awsConfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
-		)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		s3Clients := make(map[string]event.S3Client)
-		for _, bucketName := range cfg.BucketNames {
-			s3Clients[bucketName] = s3client.NewClientWithConfig(bucketName, awsConfig, func(o *s3.Options) {
-				o.BaseEndpoint = aws.String(cfg.LocalstackHost)
-				o.UsePathStyle = true
-			})
-		}
-		e.S3Clients = true
-
-		return &awsConfig, s3Clients, nil
+		opts = append(opts, awsConfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")))
 	}
 
-	// establish AWS config
-	awsConfig, err := awsConfig.LoadDefaultConfig(ctx, awsConfig.WithRegion(cfg.AWSRegion))
+	awsConfig, err := awsConfig.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// create S3 clients for expected bucket names, so that they can be health-checked
+	newS3Client := NewS3ClientFunc(awsConfig, cfg.LocalstackHost)
 	s3Clients := make(map[string]event.S3Client)
 	for _, bucketName := range cfg.BucketNames {
-		s3Clients[bucketName] = s3client.NewClientWithConfig(bucketName, awsConfig)
+		s3Clients[bucketName] = newS3Client(bucketName)
 	}
 	e.S3Clients = true
 
 	return &awsConfig, s3Clients, nil
 }
 
+// NewS3ClientFunc returns a function that creates an S3 client for a bucket, using the given AWS config.
+// If localstackHost is not empty, the clients connect to localstack instead of AWS.
+func NewS3ClientFunc(awsConfig aws.Config, localstackHost string) func(bucketName string) event.S3Client {
+	return func(bucketName string) event.S3Client {
+		if localstackHost != "" {
+			return NewS3Client(bucketName, awsConfig, func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(localstackHost)
+				o.UsePathStyle = true
+			})
+		}
+		return NewS3Client(bucketName, awsConfig)
+	}
+}
+
 // GetHealthChecker creates a new healthcheck object
 func (e *ExternalServiceList) GetHealthChecker(ctx context.Context, buildTime, gitCommit, version string, cfg *config.Config) (*healthcheck.HealthCheck, error) {
 	versionInfo, err := healthcheck.NewVersionInfo(buildTime, gitCommit, version)
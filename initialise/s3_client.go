@@ -0,0 +1,37 @@
+package initialise
+
+import (
+	"context"
+
+	s3client "github.com/ONSdigital/dp-s3/v3"
+	"github.com/ONSdigital/dp-s3/v3/crypto"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Client is an S3 client for a bucket that gets objects through the AWS SDK and the dp-s3 crypto client directly,
+// so that requests can be conditional on an object's ETag. The dp-s3 client is used for everything else.
+type S3Client struct {
+	*s3client.Client
+	sdkClient    *s3.Client
+	cryptoClient *crypto.CryptoClient
+}
+
+// NewS3Client returns an S3Client for the given bucket, using the given AWS config and S3 options.
+func NewS3Client(bucketName string, awsConfig aws.Config, optFns ...func(*s3.Options)) *S3Client {
+	return &S3Client{
+		Client:       s3client.NewClientWithConfig(bucketName, awsConfig, optFns...),
+		sdkClient:    s3.NewFromConfig(awsConfig, optFns...),
+		cryptoClient: crypto.New(awsConfig, &crypto.Config{HasUserDefinedPSK: true}, optFns...),
+	}
+}
+
+// GetObject gets the object described by the input.
+func (client *S3Client) GetObject(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return client.sdkClient.GetObject(ctx, input)
+}
+
+// GetObjectWithPSK gets the object described by the input, decrypting its contents with the given PSK.
+func (client *S3Client) GetObjectWithPSK(ctx context.Context, input *s3.GetObjectInput, psk []byte) (*s3.GetObjectOutput, error) {
+	return client.cryptoClient.GetObjectWithPSK(ctx, input, psk)
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// Names of the path variables identifying a job
+const (
+	InstanceIDVar = "instance_id"
+	IDVar         = "id"
+)
+
+// jobList is the response body listing jobs
+type jobList struct {
+	Items []Job `json:"items"`
+	Count int   `json:"count"`
+}
+
+// ListHandler serves the jobs in progress and the recently finished jobs as JSON.
+func (registry *Registry) ListHandler(w http.ResponseWriter, req *http.Request) {
+	jobs := registry.List()
+	writeJSON(w, req, http.StatusOK, jobList{Items: jobs, Count: len(jobs)})
+}
+
+// GetHandler serves the job for the instance ID in the request path as JSON, or responds with a 404 if there is no
+// job for the instance.
+func (registry *Registry) GetHandler(w http.ResponseWriter, req *http.Request) {
+	job, ok := registry.Get(mux.Vars(req)[InstanceIDVar])
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, req, http.StatusOK, job)
+}
+
+// GetByIDHandler serves the job with the ID in the request path as JSON, or responds with a 404 if there is no such
+// job.
+func (registry *Registry) GetByIDHandler(w http.ResponseWriter, req *http.Request) {
+	job, ok := registry.GetByID(mux.Vars(req)[IDVar])
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, req, http.StatusOK, job)
+}
+
+// writeJSON writes the body as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, req *http.Request, status int, body interface{}) {
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		log.Error(req.Context(), "failed to marshal jobs response", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(bytes); err != nil {
+		log.Error(req.Context(), "failed to write jobs response", err)
+	}
+}
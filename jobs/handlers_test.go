@@ -0,0 +1,94 @@
+package jobs_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandlers(t *testing.T) {
+	Convey("Given a router for a registry with a finished job and a job in progress", t, func() {
+		registry := jobs.NewRegistry(10)
+		registry.Finish(start(registry, "", "1", ""), nil)
+		start(registry, "", "2", "")
+
+		router := mux.NewRouter()
+		router.Path("/jobs").HandlerFunc(registry.ListHandler)
+		router.Path("/jobs/{" + jobs.InstanceIDVar + "}").HandlerFunc(registry.GetHandler)
+		router.Path("/extractions/{" + jobs.IDVar + "}").HandlerFunc(registry.GetByIDHandler)
+
+		Convey("When the jobs are listed", func() {
+			recorder := serve(router, "/jobs")
+
+			Convey("Then both jobs are returned as JSON", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(recorder.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+				var body struct {
+					Items []jobs.Job `json:"items"`
+					Count int        `json:"count"`
+				}
+				So(json.Unmarshal(recorder.Body.Bytes(), &body), ShouldBeNil)
+				So(body.Count, ShouldEqual, 2)
+				So(body.Items[0].InstanceID, ShouldEqual, "2")
+				So(body.Items[0].Status, ShouldEqual, jobs.StatusInProgress)
+				So(body.Items[1].InstanceID, ShouldEqual, "1")
+				So(body.Items[1].Status, ShouldEqual, jobs.StatusCompleted)
+			})
+		})
+
+		Convey("When a job is requested", func() {
+			recorder := serve(router, "/jobs/1")
+
+			Convey("Then the job is returned as JSON", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+
+				var job jobs.Job
+				So(json.Unmarshal(recorder.Body.Bytes(), &job), ShouldBeNil)
+				So(job.InstanceID, ShouldEqual, "1")
+				So(job.FileURL, ShouldEqual, fileURL)
+			})
+		})
+
+		Convey("When a job that does not exist is requested", func() {
+			recorder := serve(router, "/jobs/3")
+
+			Convey("Then a 404 is returned", func() {
+				So(recorder.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When a job is requested by its ID", func() {
+			job, _ := registry.Get("2")
+			recorder := serve(router, "/extractions/"+job.ID)
+
+			Convey("Then the job is returned as JSON", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+
+				var body jobs.Job
+				So(json.Unmarshal(recorder.Body.Bytes(), &body), ShouldBeNil)
+				So(body.ID, ShouldEqual, job.ID)
+				So(body.InstanceID, ShouldEqual, "2")
+			})
+		})
+
+		Convey("When a job is requested by an ID that does not exist", func() {
+			recorder := serve(router, "/extractions/unknown")
+
+			Convey("Then a 404 is returned", func() {
+				So(recorder.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func serve(handler http.Handler, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	return recorder
+}
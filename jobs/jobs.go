@@ -0,0 +1,264 @@
+// Package jobs keeps track of the extraction jobs that are in progress, and those that have recently finished.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+)
+
+// The status of a job
+const (
+	StatusQueued     = "queued"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+)
+
+// ErrInProgress is returned when a job is queued for an instance that already has a job queued or in progress, or a
+// full extraction is started for an instance that already has one, as they would share the instance's checkpoint.
+var ErrInProgress = errors.New("a job is already in progress for the instance")
+
+// Job is the extraction of the observations for an instance. ImportJobID is the ID of the import job that requested
+// the extraction, if it was requested by an event that has one. Partial is true if only a selection of the rows is
+// being extracted.
+type Job struct {
+	ID          string     `json:"id"`
+	InstanceID  string     `json:"instance_id"`
+	ImportJobID string     `json:"import_job_id,omitempty"`
+	FileURL     string     `json:"file_url"`
+	Partial     bool       `json:"partial,omitempty"`
+	RowsEmitted int64      `json:"rows_emitted"`
+	BytesRead   int64      `json:"bytes_read"`
+	Attempts    int        `json:"attempts"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Registry keeps the jobs in progress, and up to a maximum number of the most recently finished jobs. Jobs are
+// identified by their ID, so that partial extractions of an instance can be in progress alongside its full extraction.
+type Registry struct {
+	mutex     sync.Mutex
+	current   map[string]*Job
+	recent    []Job
+	maxRecent int
+}
+
+// NewRegistry returns a new job registry, which keeps up to maxRecent finished jobs.
+func NewRegistry(maxRecent int) *Registry {
+	return &Registry{
+		current:   make(map[string]*Job),
+		maxRecent: maxRecent,
+	}
+}
+
+// Queue records a job for the instance that has been requested but not yet started, and returns it so that its ID
+// can be given to whoever requested it. ErrInProgress is returned if the instance already has a job queued or in
+// progress.
+func (registry *Registry) Queue(instanceID, fileURL string) (Job, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, job := range registry.current {
+		if job.InstanceID == instanceID {
+			return Job{}, ErrInProgress
+		}
+	}
+
+	job := &Job{
+		ID:         newID(),
+		InstanceID: instanceID,
+		FileURL:    fileURL,
+		StartTime:  time.Now().UTC(),
+		Status:     StatusQueued,
+	}
+	registry.current[job.ID] = job
+	return *job, nil
+}
+
+// Start records that extraction has started for the instance, and returns the ID of its job. If jobID is the ID of
+// a queued job for the instance, that job is started, and if it is the ID of a recent job for the instance that
+// failed, that job is started again as another attempt. Otherwise a new job is started, with a new ID, alongside any
+// others in progress for the instance. The job records the ID of the import job that requested it, unless it is empty.
+// ErrInProgress is returned if a full extraction is started while another job for the instance might be one.
+func (registry *Registry) Start(jobID, instanceID, fileURL, importJobID string, partial bool) (string, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if !partial && registry.fullInProgress(jobID, instanceID) {
+		return "", ErrInProgress
+	}
+
+	job, ok := registry.current[jobID]
+	if !ok || job.Status != StatusQueued || job.InstanceID != instanceID {
+		job = registry.restart(jobID, instanceID)
+	}
+
+	job.Attempts++
+	job.InstanceID = instanceID
+	job.ImportJobID = importJobID
+	job.FileURL = fileURL
+	job.Partial = partial
+	job.StartTime = time.Now().UTC()
+	job.Status = StatusInProgress
+	registry.current[job.ID] = job
+	return job.ID, nil
+}
+
+// fullInProgress returns true if a job for the instance, other than the one with the given ID, is a full extraction
+// in progress or is queued, as it is not known whether a queued job is partial until it starts. The caller must hold
+// the lock.
+func (registry *Registry) fullInProgress(jobID, instanceID string) bool {
+	for id, job := range registry.current {
+		if id != jobID && job.InstanceID == instanceID && (job.Status == StatusQueued || !job.Partial) {
+			return true
+		}
+	}
+	return false
+}
+
+// restart removes the recent job for the instance with the given ID from the recent jobs if it failed, and returns it
+// so that it can be started again. Otherwise a new job is returned, with a new ID. The caller must hold the lock.
+func (registry *Registry) restart(jobID, instanceID string) *Job {
+	for i, recent := range registry.recent {
+		if jobID != "" && recent.ID == jobID && recent.InstanceID == instanceID && recent.Status == StatusFailed {
+			registry.recent = append(registry.recent[:i], registry.recent[i+1:]...)
+			recent.EndTime = nil
+			recent.Error = ""
+			return &recent
+		}
+	}
+	return &Job{ID: newID()}
+}
+
+// SetRowsEmitted records the number of rows emitted so far for the job in progress with the given ID.
+func (registry *Registry) SetRowsEmitted(id string, rows int64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if job, ok := registry.current[id]; ok {
+		job.RowsEmitted = rows
+	}
+}
+
+// AddBytesRead adds to the number of bytes read for the job in progress with the given ID.
+func (registry *Registry) AddBytesRead(id string, bytes int64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if job, ok := registry.current[id]; ok {
+		job.BytesRead += bytes
+	}
+}
+
+// Finish records that the job in progress with the given ID has finished with the given error, which is nil if it
+// completed. The job is then kept as a recent job, discarding the oldest recent job if there are too many.
+func (registry *Registry) Finish(id string, err error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	job, ok := registry.current[id]
+	if !ok {
+		return
+	}
+	delete(registry.current, id)
+
+	endTime := time.Now().UTC()
+	job.EndTime = &endTime
+	job.Status = finishedStatus(err)
+	if err != nil {
+		job.Error = err.Error()
+	}
+
+	if registry.maxRecent < 1 {
+		return
+	}
+	registry.recent = append([]Job{*job}, registry.recent...)
+	if len(registry.recent) > registry.maxRecent {
+		registry.recent = registry.recent[:registry.maxRecent]
+	}
+}
+
+// List returns the jobs in progress, most recently started first, followed by the recent jobs, most recently
+// finished first.
+func (registry *Registry) List() []Job {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(registry.current)+len(registry.recent))
+	for _, job := range registry.current {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartTime.After(jobs[j].StartTime)
+	})
+	return append(jobs, registry.recent...)
+}
+
+// Get returns the most recently started job in progress for the instance, or its most recently finished job. False
+// is returned if there is no job for the instance.
+func (registry *Registry) Get(instanceID string) (Job, bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	var latest *Job
+	for _, job := range registry.current {
+		if job.InstanceID == instanceID && (latest == nil || job.StartTime.After(latest.StartTime)) {
+			latest = job
+		}
+	}
+	if latest != nil {
+		return *latest, true
+	}
+	for _, job := range registry.recent {
+		if job.InstanceID == instanceID {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+// GetByID returns the job with the given ID, whether it is in progress or recently finished. False is returned if
+// there is no such job.
+func (registry *Registry) GetByID(id string) (Job, bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if job, ok := registry.current[id]; ok {
+		return *job, true
+	}
+	for _, job := range registry.recent {
+		if job.ID == id {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+// newID returns a random ID for a job.
+func newID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// finishedStatus returns the status of a job that finished with the given error.
+func finishedStatus(err error) string {
+	var cancelled *observation.CancelledError
+	switch {
+	case err == nil:
+		return StatusCompleted
+	case errors.As(err, &cancelled):
+		return StatusCancelled
+	default:
+		return StatusFailed
+	}
+}
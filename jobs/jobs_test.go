@@ -0,0 +1,230 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const fileURL = "s3://some-bucket/some-file"
+
+func TestRegistry(t *testing.T) {
+	Convey("Given a registry with a job in progress", t, func() {
+		registry := jobs.NewRegistry(2)
+		id := start(registry, "", "1", "")
+		registry.AddBytesRead(id, 100)
+		registry.AddBytesRead(id, 50)
+		registry.SetRowsEmitted(id, 3)
+
+		Convey("When the job is got", func() {
+			job, ok := registry.Get("1")
+
+			Convey("Then its progress is returned", func() {
+				So(ok, ShouldBeTrue)
+				So(job.ID, ShouldEqual, id)
+				So(job.InstanceID, ShouldEqual, "1")
+				So(job.FileURL, ShouldEqual, fileURL)
+				So(job.BytesRead, ShouldEqual, 150)
+				So(job.RowsEmitted, ShouldEqual, 3)
+				So(job.Status, ShouldEqual, jobs.StatusInProgress)
+				So(job.StartTime.IsZero(), ShouldBeFalse)
+				So(job.EndTime, ShouldBeNil)
+			})
+		})
+
+		Convey("When the job finishes without an error", func() {
+			registry.Finish(id, nil)
+
+			Convey("Then it is not started again when retried with its ID", func() {
+				So(start(registry, id, "1", ""), ShouldNotEqual, id)
+			})
+
+			Convey("Then it is kept as a completed job", func() {
+				job, ok := registry.Get("1")
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+				So(job.EndTime, ShouldNotBeNil)
+				So(job.RowsEmitted, ShouldEqual, 3)
+			})
+
+			Convey("And further progress for the job is ignored", func() {
+				registry.SetRowsEmitted(id, 10)
+				job, _ := registry.Get("1")
+				So(job.RowsEmitted, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the job finishes with an error", func() {
+			registry.Finish(id, errors.New("connection reset"))
+
+			Convey("Then it is kept as a failed job with the error", func() {
+				job, _ := registry.Get("1")
+				So(job.Status, ShouldEqual, jobs.StatusFailed)
+				So(job.Error, ShouldEqual, "connection reset")
+			})
+
+			Convey("And it is started again as another attempt when retried with its ID", func() {
+				So(start(registry, id, "1", ""), ShouldEqual, id)
+				job, _ := registry.Get("1")
+				So(job.Attempts, ShouldEqual, 2)
+				So(job.Status, ShouldEqual, jobs.StatusInProgress)
+				So(job.Error, ShouldBeEmpty)
+				So(job.EndTime, ShouldBeNil)
+				So(registry.List(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the job is cancelled", func() {
+			registry.Finish(id, &observation.CancelledError{RowsWritten: 3, Err: context.Canceled})
+
+			Convey("Then it is kept as a cancelled job", func() {
+				job, _ := registry.Get("1")
+				So(job.Status, ShouldEqual, jobs.StatusCancelled)
+			})
+		})
+	})
+
+	Convey("Given a registry with a queued job", t, func() {
+		registry := jobs.NewRegistry(2)
+		queued, err := registry.Queue("1", fileURL)
+		So(err, ShouldBeNil)
+
+		Convey("Then the job is queued with an ID", func() {
+			So(queued.ID, ShouldNotBeEmpty)
+			So(queued.Status, ShouldEqual, jobs.StatusQueued)
+		})
+
+		Convey("When another job is queued for the instance", func() {
+			_, err := registry.Queue("1", fileURL)
+
+			Convey("Then ErrInProgress is returned", func() {
+				So(err, ShouldEqual, jobs.ErrInProgress)
+			})
+		})
+
+		Convey("When the job starts with its ID and finishes", func() {
+			id := start(registry, queued.ID, "1", "")
+			started, _ := registry.GetByID(queued.ID)
+			registry.Finish(id, nil)
+
+			Convey("Then it keeps its ID throughout", func() {
+				So(id, ShouldEqual, queued.ID)
+				So(started.Status, ShouldEqual, jobs.StatusInProgress)
+				job, ok := registry.GetByID(queued.ID)
+				So(ok, ShouldBeTrue)
+				So(job.InstanceID, ShouldEqual, "1")
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+			})
+
+			Convey("And the next job for the instance has a different ID, and records the import job that requested it", func() {
+				id := start(registry, "", "1", "import-job")
+				So(id, ShouldNotBeEmpty)
+				So(id, ShouldNotEqual, queued.ID)
+				job, ok := registry.GetByID(id)
+				So(ok, ShouldBeTrue)
+				So(job.ImportJobID, ShouldEqual, "import-job")
+			})
+		})
+
+		Convey("When a partial run of the instance, without the job's ID, starts alongside it and both finish", func() {
+			first := start(registry, queued.ID, "1", "")
+			second, err := registry.Start("", "1", fileURL, "", true)
+			So(err, ShouldBeNil)
+			registry.SetRowsEmitted(second, 5)
+			registry.Finish(first, nil)
+			registry.Finish(second, errors.New("connection reset"))
+
+			Convey("Then each run is kept as a separate job with its own result", func() {
+				So(first, ShouldEqual, queued.ID)
+				So(second, ShouldNotEqual, first)
+
+				job, ok := registry.GetByID(first)
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusCompleted)
+
+				job, ok = registry.GetByID(second)
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusFailed)
+				So(job.RowsEmitted, ShouldEqual, 5)
+
+				So(registry.List(), ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When a partial job for the instance starts without the queued job's ID", func() {
+			id, err := registry.Start("", "1", fileURL, "", true)
+			So(err, ShouldBeNil)
+
+			Convey("Then it does not take over the queued job", func() {
+				So(id, ShouldNotEqual, queued.ID)
+				job, ok := registry.GetByID(queued.ID)
+				So(ok, ShouldBeTrue)
+				So(job.Status, ShouldEqual, jobs.StatusQueued)
+				job, _ = registry.GetByID(id)
+				So(job.Partial, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a full job for the instance starts without the queued job's ID", func() {
+			_, err := registry.Start("", "1", fileURL, "", false)
+
+			Convey("Then ErrInProgress is returned, as the queued job might also be a full extraction", func() {
+				So(err, ShouldEqual, jobs.ErrInProgress)
+				So(registry.List(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the job starts and another full job for the instance starts alongside it", func() {
+			start(registry, queued.ID, "1", "")
+			_, err := registry.Start("", "1", fileURL, "", false)
+
+			Convey("Then ErrInProgress is returned, so that they do not share the instance's checkpoint", func() {
+				So(err, ShouldEqual, jobs.ErrInProgress)
+				So(registry.List(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When a job is got by an ID that does not exist", func() {
+			_, ok := registry.GetByID("unknown")
+
+			Convey("Then it is not found", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a registry that keeps two recent jobs", t, func() {
+		registry := jobs.NewRegistry(2)
+
+		Convey("When three jobs finish and another is started", func() {
+			for _, instanceID := range []string{"1", "2", "3"} {
+				registry.Finish(start(registry, "", instanceID, ""), nil)
+			}
+			start(registry, "", "4", "")
+
+			Convey("Then the job in progress is listed before the two most recently finished jobs", func() {
+				list := registry.List()
+				So(list, ShouldHaveLength, 3)
+				So(list[0].InstanceID, ShouldEqual, "4")
+				So(list[1].InstanceID, ShouldEqual, "3")
+				So(list[2].InstanceID, ShouldEqual, "2")
+			})
+
+			Convey("And the oldest job is no longer found", func() {
+				_, ok := registry.Get("1")
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+// start starts a full extraction job, which is expected to succeed, and returns its ID.
+func start(registry *jobs.Registry, jobID, instanceID, importJobID string) string {
+	id, err := registry.Start(jobID, instanceID, fileURL, importJobID, false)
+	So(err, ShouldBeNil)
+	return id
+}
@@ -0,0 +1,102 @@
+// Package metrics defines the prometheus metrics reported by the service, and the handler that serves them.
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "observation_extractor"
+
+// registry holds the service's metrics, along with the go runtime and process metrics
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+var (
+	// EventsConsumed counts the event messages consumed.
+	EventsConsumed = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_consumed_total",
+		Help:      "The number of event messages consumed.",
+	})
+
+	// EventsFailed counts the events that failed on every attempt, by the reason they failed.
+	EventsFailed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_failed_total",
+		Help:      "The number of events that failed on every attempt, by reason.",
+	}, []string{"reason"})
+
+	// RowsExtracted counts the observation rows sent.
+	RowsExtracted = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_extracted_total",
+		Help:      "The number of observation rows sent.",
+	})
+
+	// BytesRead counts the bytes read from files, before decompression, by the scheme of their url.
+	BytesRead = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_read_total",
+		Help:      "The number of bytes read from files before decompression, by url scheme.",
+	}, []string{"scheme"})
+
+	// ExtractionDuration observes how long each instance takes to extract, by its final status.
+	ExtractionDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "extraction_duration_seconds",
+		Help:      "The time taken to extract the observations for an instance, by status.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 15),
+	}, []string{"status"})
+
+	// VaultReadDuration observes how long each attempt to read a key from vault takes.
+	VaultReadDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vault_read_duration_seconds",
+		Help:      "The time taken by each attempt to read a key from vault.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// ProducerErrors counts the errors returned by kafka producers, by topic.
+	ProducerErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "producer_errors_total",
+		Help:      "The number of errors returned by kafka producers, by topic.",
+	}, []string{"topic"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns an http handler that serves the metrics in the prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// CountBytesRead returns a reader that adds the number of bytes read from the given reader to BytesRead for the
+// scheme.
+func CountBytesRead(reader io.ReadCloser, scheme string) io.ReadCloser {
+	return &countingReader{ReadCloser: reader, counter: BytesRead.WithLabelValues(scheme)}
+}
+
+// countingReader adds the number of bytes read to a counter
+type countingReader struct {
+	io.ReadCloser
+	counter prometheus.Counter
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.counter.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,47 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCountBytesRead(t *testing.T) {
+	Convey("Given a reader that counts the bytes read for a scheme", t, func() {
+		before := testutil.ToFloat64(metrics.BytesRead.WithLabelValues("file"))
+		reader := metrics.CountBytesRead(io.NopCloser(strings.NewReader("V4_0,mmm-yy,time\n")), "file")
+
+		Convey("When it is read to the end", func() {
+			content, err := io.ReadAll(reader)
+			So(err, ShouldBeNil)
+
+			Convey("Then the bytes read are added to the counter for the scheme", func() {
+				So(testutil.ToFloat64(metrics.BytesRead.WithLabelValues("file"))-before, ShouldEqual, len(content))
+				So(reader.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestHandler(t *testing.T) {
+	Convey("Given a metric that has been recorded", t, func() {
+		metrics.RowsExtracted.Add(3)
+
+		Convey("When the metrics are requested", func() {
+			recorder := httptest.NewRecorder()
+			metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+			Convey("Then the service and go runtime metrics are served in the prometheus format", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(recorder.Body.String(), ShouldContainSubstring, "observation_extractor_rows_extracted_total")
+				So(recorder.Body.String(), ShouldContainSubstring, "go_goroutines")
+			})
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package observation
+
+import "fmt"
+
+// BadRowPolicy determines what happens to rows that do not have the number of columns defined by the header.
+type BadRowPolicy string
+
+// Possible bad row policies
+const (
+	// BadRowPolicyFail stops reading and returns a RowError, failing the whole instance.
+	BadRowPolicyFail BadRowPolicy = "fail"
+	// BadRowPolicySkip reports and discards the row, then carries on reading.
+	BadRowPolicySkip BadRowPolicy = "skip"
+	// BadRowPolicyPass reports the row and returns it as a normal observation.
+	BadRowPolicyPass BadRowPolicy = "pass"
+)
+
+// MaxBadRowIndexes is the most bad row indexes that are kept for reporting. Further bad rows are only counted.
+const MaxBadRowIndexes = 100
+
+// RowError is returned when a row does not have the number of columns defined by the header.
+type RowError struct {
+	RowIndex int64
+	Expected int
+	Actual   int
+}
+
+// Error returns a description of the bad row, including its row index.
+func (err *RowError) Error() string {
+	return fmt.Sprintf("row %d has %d columns, expected %d", err.RowIndex, err.Actual, err.Expected)
+}
+
+// Permanent returns true, as the row will be bad however many times the file is read.
+func (err *RowError) Permanent() bool {
+	return true
+}
@@ -0,0 +1,83 @@
+package observation
+
+import (
+	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/go-avro/avro"
+)
+
+// batch holds consecutive observations that are sent together in a single message.
+type batch struct {
+	rowIndex int64
+	rows     []string
+	bytes    int64
+}
+
+// accepts returns true if the observation follows on from the last row in the batch, and can be added without the
+// rows totalling more than maxBytes. Rows are never limited by size if maxBytes is 0, and an empty batch accepts
+// any observation.
+func (batch *batch) accepts(observation *Observation, maxBytes int64) bool {
+	if len(batch.rows) == 0 {
+		return true
+	}
+
+	if observation.RowIndex != batch.lastRowIndex()+1 {
+		return false
+	}
+
+	return maxBytes <= 0 || batch.bytes+int64(len(observation.Row)) <= maxBytes
+}
+
+// add appends the observation to the batch.
+func (batch *batch) add(observation *Observation) {
+	if len(batch.rows) == 0 {
+		batch.rowIndex = observation.RowIndex
+	}
+	batch.rows = append(batch.rows, observation.Row)
+	batch.bytes += int64(len(observation.Row))
+}
+
+// lastRowIndex returns the index of the last row in the batch.
+func (batch *batch) lastRowIndex() int64 {
+	return batch.rowIndex + int64(len(batch.rows)) - 1
+}
+
+// reset empties the batch.
+func (batch *batch) reset() {
+	batch.rowIndex = 0
+	batch.rows = batch.rows[:0]
+	batch.bytes = 0
+}
+
+// marshal returns the message for the batch. Unless batched is true, the batch must hold a single observation,
+// which is marshalled as an observation extracted event.
+func (batch *batch) marshal(instanceID string, batched bool) ([]byte, error) {
+	if !batched {
+		return schema.ObservationExtractedEvent.Marshal(ExtractedEvent{
+			InstanceID: instanceID,
+			Row:        batch.rows[0],
+			RowIndex:   batch.rowIndex,
+		})
+	}
+
+	return schema.ObservationExtractedBatchEvent.Marshal(ExtractedBatchEvent{
+		InstanceID: instanceID,
+		Rows:       batch.rows,
+		RowIndex:   batch.rowIndex,
+	})
+}
+
+// UnmarshalBatch converts an observation extracted batch event message into an ExtractedBatchEvent. The message is
+// decoded with go-avro directly, as the schema's Unmarshal pads string arrays with empty strings.
+func UnmarshalBatch(message []byte) (*ExtractedBatchEvent, error) {
+	batchSchema, err := avro.ParseSchema(schema.ObservationExtractedBatchEvent.Definition)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &ExtractedBatchEvent{}
+	reader := avro.NewSpecificDatumReader().SetSchema(batchSchema)
+	if err = reader.Read(event, avro.NewBinaryDecoder(message)); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
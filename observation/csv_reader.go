@@ -2,60 +2,264 @@ package observation
 
 import (
 	"bufio"
+	"encoding/csv"
 	"io"
 )
 
+const (
+	quote     = '"'
+	separator = ','
+)
+
+// parser states used while reading a CSV record.
+const (
+	stateFieldStart = iota
+	stateUnquoted
+	stateQuoted
+	stateQuoteInQuoted
+)
+
 // CSVReader deserialises observations from an io.Reader containing CSV encoded observations.
+// Records are parsed as described in RFC 4180, so quoted fields may contain separators, escaped
+// quotes and line breaks.
 type CSVReader struct {
-	scanner  *bufio.Scanner
-	rowIndex int64
+	reader        *bufio.Reader
+	header        *Header
+	badRowPolicy  BadRowPolicy
+	badRows       int64
+	badRowIndexes []int64
+	resumeAfter   int64
+	selection     Selection
+	selected      int64
+	rowIndex      int64
+	line          int64
 }
 
-// NewCSVReader returns a new CSVReader instance for the given io.CSVReader
-func NewCSVReader(ioreader io.Reader) *CSVReader {
-	scanner := bufio.NewScanner(ioreader)
+// NewCSVReader returns a new CSVReader instance for the given io.Reader. The header row is read and validated
+// against the V4 layout, and an error is returned if it is missing or invalid. Rows that do not have the
+// number of columns defined by the header are handled according to the given BadRowPolicy.
+func NewCSVReader(ioreader io.Reader, badRowPolicy BadRowPolicy) (*CSVReader, error) {
+	reader := &CSVReader{
+		reader:       bufio.NewReader(ioreader),
+		badRowPolicy: badRowPolicy,
+	}
+
+	_, fields, err := reader.readRecord()
+	if err == io.EOF {
+		return nil, ErrMissingHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reader.header, err = ParseHeader(fields); err != nil {
+		return nil, err
+	}
 
-	// Discard the header row.
-	scanner.Scan()
+	reader.rowIndex = 1 // have read the header row so start at 1.
 
-	rowIndex := int64(1) // have discarded the header row so start at 1.
+	return reader, nil
+}
 
-	return &CSVReader{
-		scanner:  scanner,
-		rowIndex: rowIndex,
+// Header returns the V4 header parsed from the first row of the input.
+func (reader *CSVReader) Header() *Header {
+	return reader.header
+}
+
+// ResumeAfter makes the reader skip all rows up to and including the given row index, without validating them.
+func (reader *CSVReader) ResumeAfter(rowIndex int64) {
+	reader.resumeAfter = rowIndex
+}
+
+// Select makes the reader only return the rows chosen by the selection, with their original row indexes. Reading
+// stops once there are no more rows to select. An error wrapping ErrInvalidSelection is returned if the selection is
+// not valid.
+func (reader *CSVReader) Select(selection Selection) error {
+	if err := selection.Validate(); err != nil {
+		return err
 	}
+	reader.selection = selection
+	return nil
 }
 
-// Read will take a line from the input batchReader and convert it into an Observation instance.
+// BadRowCount returns the number of rows read so far that did not have the expected number of columns.
+func (reader *CSVReader) BadRowCount() int64 {
+	return reader.badRows
+}
+
+// BadRowIndexes returns the indexes of up to MaxBadRowIndexes of the rows read so far that did not have the expected
+// number of columns.
+func (reader *CSVReader) BadRowIndexes() []int64 {
+	return reader.badRowIndexes
+}
+
+// Read will take a record from the input reader and convert it into an Observation instance.
+// Rows that are not selected are skipped without being validated. Bad rows are skipped, passed through or returned
+// as a RowError depending on the BadRowPolicy, and are counted for reporting once reading has finished.
 func (reader *CSVReader) Read() (*Observation, error) {
-	text, err := reader.readLine()
-	if err != nil {
-		return nil, err
-	}
+	for {
+		text, fields, err := reader.readRecord()
+		if err != nil {
+			return nil, err
+		}
 
-	observation := &Observation{
-		Row:      text,
-		RowIndex: reader.rowIndex,
-	}
+		observation := &Observation{
+			Row:      text,
+			RowIndex: reader.rowIndex,
+		}
+
+		reader.rowIndex++
+
+		if reader.selection.isPast(observation.RowIndex, reader.selected) {
+			return nil, io.EOF
+		}
+		if !reader.selection.selects(observation.RowIndex) {
+			continue
+		}
+		// rows skipped when resuming are still counted, so that the limit applies to the whole extraction
+		reader.selected++
+
+		if observation.RowIndex <= reader.resumeAfter {
+			continue
+		}
 
-	reader.rowIndex++
+		if len(fields) == reader.header.ColumnCount() {
+			return observation, nil
+		}
+
+		reader.badRows++
+		if len(reader.badRowIndexes) < MaxBadRowIndexes {
+			reader.badRowIndexes = append(reader.badRowIndexes, observation.RowIndex)
+		}
 
-	return observation, nil
+		switch reader.badRowPolicy {
+		case BadRowPolicySkip:
+			continue
+		case BadRowPolicyPass:
+			return observation, nil
+		default:
+			return nil, &RowError{
+				RowIndex: observation.RowIndex,
+				Expected: reader.header.ColumnCount(),
+				Actual:   len(fields),
+			}
+		}
+	}
 }
 
-// ReadLine will read a single line from the input batchReader, returning an error if the read fails.
-func (reader *CSVReader) readLine() (string, error) {
-	scanner := reader.scanner
-	scanSuccessful := scanner.Scan()
+// readRecord reads a single logical record from the input reader, which may span several physical
+// lines if a quoted field contains line breaks. The record text is returned exactly as it appears in
+// the input, without its line terminator, along with the unquoted field values. Empty lines are skipped.
+// Line terminators are handled in the same way as encoding/csv: CRLF is read as LF, and a carriage return
+// at the end of the input is dropped. Any other carriage return is part of the field it is in.
+func (reader *CSVReader) readRecord() (string, []string, error) {
+	var raw, field []byte
+	var fields []string
+	state := stateFieldStart
+	startLine := reader.line + 1
 
-	if !scanSuccessful {
-		if scanner.Err() != nil {
-			return "", scanner.Err()
+lines:
+	for {
+		chunk, readErr := reader.reader.ReadBytes('\n')
+		if len(chunk) > 0 {
+			reader.line++
 		}
+		line := normaliseLine(chunk, readErr)
+
+		for i, b := range line {
+			switch state {
+			case stateQuoted:
+				if b == quote {
+					state = stateQuoteInQuoted
+				} else {
+					field = append(field, b)
+				}
+				continue
+			case stateQuoteInQuoted:
+				if b == quote {
+					field = append(field, quote)
+					state = stateQuoted
+					continue
+				}
+				if b != separator && b != '\n' {
+					return "", nil, reader.parseError(startLine, i, csv.ErrQuote)
+				}
+			case stateFieldStart:
+				if b == quote {
+					state = stateQuoted
+					continue
+				}
+			case stateUnquoted:
+				if b == quote {
+					return "", nil, reader.parseError(startLine, i, csv.ErrBareQuote)
+				}
+			}
 
-		// Scanner can return a nil error for EOF
-		return "", io.EOF
+			switch b {
+			case separator:
+				fields = append(fields, string(field))
+				field = field[:0]
+				state = stateFieldStart
+			case '\n':
+				raw = append(raw, line[:i]...)
+				if len(raw) == 0 {
+					// skip empty lines
+					field, state = field[:0], stateFieldStart
+					startLine = reader.line + 1
+					continue lines
+				}
+				return string(raw), append(fields, string(field)), nil
+			default:
+				field = append(field, b)
+				if state == stateFieldStart {
+					state = stateUnquoted
+				}
+			}
+		}
+
+		if readErr == nil {
+			// the record continues on the next line as the line break was inside a quoted field
+			raw = append(raw, chunk...)
+			continue
+		}
+
+		if readErr != io.EOF {
+			return "", nil, readErr
+		}
+
+		raw = append(raw, line...)
+		if state == stateQuoted {
+			return "", nil, reader.parseError(startLine, len(line), csv.ErrQuote)
+		}
+		if len(raw) == 0 {
+			return "", nil, io.EOF
+		}
+		return string(raw), append(fields, string(field)), nil
 	}
+}
+
+// parseError returns a csv.ParseError for the current line and the given column offset.
+func (reader *CSVReader) parseError(startLine int64, offset int, err error) error {
+	return &csv.ParseError{
+		StartLine: int(startLine),
+		Line:      int(reader.line),
+		Column:    offset + 1,
+		Err:       err,
+	}
+}
 
-	return scanner.Text(), nil
+// normaliseLine returns the line to parse for a chunk read up to and including a line feed. As in encoding/csv, a CRLF
+// terminator is read as LF, and a carriage return at the end of the input is dropped.
+func normaliseLine(chunk []byte, readErr error) []byte {
+	n := len(chunk)
+	if readErr == io.EOF && n > 0 && chunk[n-1] == '\r' {
+		return chunk[:n-1]
+	}
+	if n >= 2 && chunk[n-2] == '\r' && chunk[n-1] == '\n' {
+		line := make([]byte, n-1)
+		copy(line, chunk[:n-2])
+		line[n-2] = '\n'
+		return line
+	}
+	return chunk
 }
@@ -1,7 +1,10 @@
 package observation_test
 
 import (
+	"encoding/csv"
+	stderrors "errors"
 	"io"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -11,13 +14,27 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-var exampleCsvHeader = "observation,some,other,headers"
-var exampleCsvLine = "153223,,Person,,Count,,,,,,,,,,K04000001,,,,,,,,,,,,,,,,,,,,,Sex,Sex,,All categories: Sex,All categories: Sex,,,,Age,Age,,All categories: Age 16 and over,All categories: Age 16 and over,,,,Residence Type,Residence Type,,All categories: Residence Type,All categories: Residence Type,,,"
+var exampleCsvHeader = "V4_1,Data_Marking,mmm-yy,time,uk-only,geography,cpih1dim1aggid,aggregate"
+var exampleCsvLine = "117.8,,Jan-96,Jan-96,K02000001,United Kingdom,cpih1dim1A0,CPIH (overall index)"
 
 func TestEmptyInput(t *testing.T) {
 	Convey("Given a reader with no content", t, func() {
 		reader := strings.NewReader("")
-		observationReader := observation.NewCSVReader(reader)
+
+		Convey("When a new CSV reader is created", func() {
+			observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+
+			Convey("Then a missing header error is returned", func() {
+				So(err, ShouldEqual, observation.ErrMissingHeader)
+				So(observationReader, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a reader with only a header row", t, func() {
+		reader := strings.NewReader(exampleCsvHeader + "\n")
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
 
 		Convey("When read is called", func() {
 			_, err := observationReader.Read()
@@ -32,7 +49,8 @@ func TestEmptyInput(t *testing.T) {
 func TestValidInput(t *testing.T) {
 	Convey("Given a reader with two rows of data", t, func() {
 		reader := strings.NewReader(exampleCsvHeader + "\n" + exampleCsvLine + "\n" + exampleCsvLine)
-		observationReader := observation.NewCSVReader(reader)
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
 
 		Convey("When read is called", func() {
 			observation1, err1 := observationReader.Read()
@@ -63,7 +81,8 @@ func TestValidInput(t *testing.T) {
 func TestDiscardHeaderRow(t *testing.T) {
 	Convey("Given some input with a header row and data row", t, func() {
 		reader := strings.NewReader(exampleCsvHeader + "\n" + exampleCsvLine)
-		observationReader := observation.NewCSVReader(reader)
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
 
 		Convey("When read is called the second row is returned", func() {
 			observation1, err1 := observationReader.Read()
@@ -85,13 +104,27 @@ func TestDiscardHeaderRow(t *testing.T) {
 	})
 }
 
+func TestInvalidHeader(t *testing.T) {
+	Convey("Given a reader with a header row that is not in the V4 layout", t, func() {
+		reader := strings.NewReader("observation,some,other,headers\n" + exampleCsvLine)
+
+		Convey("When a new CSV reader is created", func() {
+			observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+
+			Convey("Then a header error is returned", func() {
+				So(observationReader, ShouldBeNil)
+				So(err, ShouldHaveSameTypeAs, &observation.HeaderError{})
+			})
+		})
+	})
+}
+
 func TestErrorResponse(t *testing.T) {
 	Convey("Given a reader that returns an error that is not EOF", t, func() {
 		expectedError := errors.New("The world has ended")
-		observationReader := observation.NewCSVReader(observationtest.NewIOReader(expectedError))
 
-		Convey("When read is called", func() {
-			_, err := observationReader.Read()
+		Convey("When a new CSV reader is created", func() {
+			_, err := observation.NewCSVReader(observationtest.NewIOReader(expectedError), observation.BadRowPolicyFail)
 
 			Convey("Then the expected error is returned", func() {
 				So(err, ShouldEqual, expectedError)
@@ -99,3 +132,272 @@ func TestErrorResponse(t *testing.T) {
 		})
 	})
 }
+
+func TestQuotedInput(t *testing.T) {
+	Convey("Given a reader with quoted fields containing separators, escaped quotes and line breaks", t, func() {
+		multiLineRow := "117.8,,Jan-96,Jan-96,K02000001,United Kingdom,cpih1dim1A0,\"CPIH, \"\"overall\"\"\nindex\""
+		escapedRow := "117.9,,Feb-96,Feb-96,K02000001,United Kingdom,cpih1dim1A0,\"a \"\"quoted\"\" label\""
+		reader := strings.NewReader(exampleCsvHeader + "\r\n" + multiLineRow + "\r\n" + escapedRow + "\r\n")
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called", func() {
+			observation1, err1 := observationReader.Read()
+			observation2, err2 := observationReader.Read()
+			_, err3 := observationReader.Read()
+
+			Convey("Then each logical record is returned as a single observation", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(err3, ShouldEqual, io.EOF)
+			})
+
+			Convey("Then the rows contain the original record text and sequential row indexes", func() {
+				So(observation1.Row, ShouldEqual, multiLineRow)
+				So(observation1.RowIndex, ShouldEqual, 1)
+				So(observation2.Row, ShouldEqual, escapedRow)
+				So(observation2.RowIndex, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestCarriageReturns(t *testing.T) {
+	inputs := []string{
+		"a,b\r\nc,d\r\n",
+		"a,\"\"\r",
+		"a,\"b\r\"",
+		"a,\"b\r\nc\"\r\n",
+		"a,b\rc\n",
+		"a,b\r",
+		"\r\n\r\na,b\n",
+		"a,\"b\"\rc\n",
+		"a,\"b\r",
+	}
+
+	Convey("Given inputs with carriage returns inside and at the end of fields and lines", t, func() {
+		for _, input := range inputs {
+			expected, expectedErr := csv.NewReader(strings.NewReader(input)).ReadAll()
+
+			Convey("When the records are read from "+strconv.Quote(input), func() {
+				records, err := observation.ReadFields(input)
+
+				Convey("Then the fields and any error match encoding/csv", func() {
+					if expectedErr != nil {
+						So(err, ShouldNotBeNil)
+						So(stderrors.Is(err, stderrors.Unwrap(expectedErr)), ShouldBeTrue)
+						return
+					}
+					So(err, ShouldBeNil)
+					So(records, ShouldResemble, expected)
+				})
+			})
+		}
+	})
+}
+
+func TestLongInput(t *testing.T) {
+	Convey("Given a reader with a row longer than the default scanner buffer", t, func() {
+		longRow := exampleCsvLine + strings.Repeat("a", 100*1024)
+		reader := strings.NewReader(exampleCsvHeader + "\n" + longRow)
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called", func() {
+			observation1, err := observationReader.Read()
+
+			Convey("Then the full row is returned", func() {
+				So(err, ShouldBeNil)
+				So(observation1.Row, ShouldEqual, longRow)
+			})
+		})
+	})
+}
+
+func TestInvalidQuoting(t *testing.T) {
+	Convey("Given a reader with an unterminated quoted field", t, func() {
+		reader := strings.NewReader(exampleCsvHeader + "\n1,\"unterminated\n")
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called", func() {
+			_, err := observationReader.Read()
+
+			Convey("Then a quote parse error is returned", func() {
+				So(err, ShouldHaveSameTypeAs, &csv.ParseError{})
+				So(stderrors.Is(err, csv.ErrQuote), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given a reader with a bare quote in a non-quoted field", t, func() {
+		reader := strings.NewReader(exampleCsvHeader + "\n1,bare\"quote\n")
+		observationReader, err := observation.NewCSVReader(reader, observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called", func() {
+			_, err := observationReader.Read()
+
+			Convey("Then a bare quote parse error is returned", func() {
+				So(stderrors.Is(err, csv.ErrBareQuote), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestBadRowPolicy(t *testing.T) {
+	badRow := "117.8,,Jan-96"
+	input := exampleCsvHeader + "\n" + exampleCsvLine + "\n" + badRow + "\n" + exampleCsvLine
+
+	Convey("Given a reader with a bad row and the fail policy", t, func() {
+		observationReader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called for each row", func() {
+			_, err1 := observationReader.Read()
+			observation2, err2 := observationReader.Read()
+
+			Convey("Then a row error is returned with the row index of the bad row", func() {
+				So(err1, ShouldBeNil)
+				So(observation2, ShouldBeNil)
+				So(err2, ShouldResemble, &observation.RowError{RowIndex: 2, Expected: 8, Actual: 3})
+				So(observationReader.BadRowCount(), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a reader with a bad row and the skip policy", t, func() {
+		observationReader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicySkip)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called for each row", func() {
+			observation1, err1 := observationReader.Read()
+			observation2, err2 := observationReader.Read()
+			_, err3 := observationReader.Read()
+
+			Convey("Then the bad row is skipped and the original row indexes are kept", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(err3, ShouldEqual, io.EOF)
+				So(observation1.RowIndex, ShouldEqual, 1)
+				So(observation2.RowIndex, ShouldEqual, 3)
+				So(observationReader.BadRowCount(), ShouldEqual, 1)
+				So(observationReader.BadRowIndexes(), ShouldResemble, []int64{2})
+			})
+		})
+	})
+
+	Convey("Given a reader with a bad row and the pass policy", t, func() {
+		observationReader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyPass)
+		So(err, ShouldBeNil)
+
+		Convey("When read is called for each row", func() {
+			_, err1 := observationReader.Read()
+			observation2, err2 := observationReader.Read()
+			_, err3 := observationReader.Read()
+
+			Convey("Then the bad row is returned as an observation", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(err3, ShouldBeNil)
+				So(observation2.Row, ShouldEqual, badRow)
+				So(observation2.RowIndex, ShouldEqual, 2)
+				So(observationReader.BadRowCount(), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestSelection(t *testing.T) {
+	badRow := "117.8,,Jan-96"
+	input := exampleCsvHeader + "\n" + exampleCsvLine + "\n" + badRow
+	for i := 3; i <= 10; i++ {
+		input += "\n" + exampleCsvLine
+	}
+
+	Convey("Given a reader with ten rows, where the second row is bad", t, func() {
+		observationReader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		Convey("When a row range after the bad row is selected", func() {
+			So(observationReader.Select(observation.Selection{FirstRow: 4, LastRow: 6}), ShouldBeNil)
+
+			Convey("Then only the rows in the range are read, with their original row indexes", func() {
+				So(readRowIndexes(observationReader), ShouldResemble, []int64{4, 5, 6})
+			})
+		})
+
+		Convey("When a sample of one in every three rows is selected", func() {
+			So(observationReader.Select(observation.Selection{FirstRow: 3, SampleEvery: 3}), ShouldBeNil)
+
+			Convey("Then every third row from the first row is read", func() {
+				So(readRowIndexes(observationReader), ShouldResemble, []int64{3, 6, 9})
+			})
+		})
+
+		Convey("When a limited sample is selected", func() {
+			So(observationReader.Select(observation.Selection{FirstRow: 3, SampleEvery: 2, Limit: 2}), ShouldBeNil)
+
+			Convey("Then reading stops once the limit is reached", func() {
+				So(readRowIndexes(observationReader), ShouldResemble, []int64{3, 5})
+			})
+		})
+
+		Convey("When the first rows are selected and the reader resumes after the first of them", func() {
+			So(observationReader.Select(observation.Selection{FirstRow: 3, Limit: 3}), ShouldBeNil)
+			observationReader.ResumeAfter(3)
+
+			Convey("Then the rows already extracted count towards the limit", func() {
+				So(readRowIndexes(observationReader), ShouldResemble, []int64{4, 5})
+			})
+		})
+
+		Convey("When the first three rows are selected", func() {
+			So(observationReader.Select(observation.Selection{Limit: 3}), ShouldBeNil)
+			_, err1 := observationReader.Read()
+			_, err2 := observationReader.Read()
+
+			Convey("Then the bad row policy is applied to it", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldResemble, &observation.RowError{RowIndex: 2, Expected: 8, Actual: 3})
+			})
+		})
+
+		Convey("When an invalid selection is selected", func() {
+			err := observationReader.Select(observation.Selection{FirstRow: 5, LastRow: 4})
+
+			Convey("Then an invalid selection error is returned", func() {
+				So(stderrors.Is(err, observation.ErrInvalidSelection), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestSelectionValidate(t *testing.T) {
+	Convey("Given some selections", t, func() {
+		Convey("Then selections without negative values, and with the last row after the first, are valid", func() {
+			So(observation.Selection{}.Validate(), ShouldBeNil)
+			So(observation.Selection{FirstRow: 2, LastRow: 2, Limit: 1, SampleEvery: 10}.Validate(), ShouldBeNil)
+			So(observation.Selection{FirstRow: 20}.Validate(), ShouldBeNil)
+		})
+
+		Convey("Then selections with negative values are invalid", func() {
+			So(stderrors.Is(observation.Selection{FirstRow: -1}.Validate(), observation.ErrInvalidSelection), ShouldBeTrue)
+			So(stderrors.Is(observation.Selection{Limit: -1}.Validate(), observation.ErrInvalidSelection), ShouldBeTrue)
+			So(stderrors.Is(observation.Selection{SampleEvery: -1}.Validate(), observation.ErrInvalidSelection), ShouldBeTrue)
+		})
+	})
+}
+
+// readRowIndexes reads the remaining observations, returning their row indexes.
+func readRowIndexes(observationReader *observation.CSVReader) []int64 {
+	var rowIndexes []int64
+	for {
+		observation, err := observationReader.Read()
+		if err == io.EOF {
+			return rowIndexes
+		}
+		So(err, ShouldBeNil)
+		rowIndexes = append(rowIndexes, observation.RowIndex)
+	}
+}
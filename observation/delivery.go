@@ -0,0 +1,69 @@
+package observation
+
+import (
+	"context"
+	"fmt"
+)
+
+// ConfirmedSink is a Sink that confirms the delivery of each message. Messages for an instance are written through
+// a Delivery, so that the messages acknowledged can be checked against the messages emitted.
+type ConfirmedSink interface {
+	Sink
+	NewDelivery() Delivery
+}
+
+// Delivery dependency that writes the messages for an instance to a ConfirmedSink
+type Delivery interface {
+	Write(ctx context.Context, message []byte) error
+	// Wait blocks until every message written has been acknowledged or has failed, and returns the number of
+	// messages acknowledged. The error is the cause of the first failed message, or the context's error if it
+	// is done first.
+	Wait(ctx context.Context) (acknowledged int64, err error)
+}
+
+// DeliveryError is returned by WriteAll when the number of messages acknowledged by a ConfirmedSink does not match
+// the number of messages emitted.
+type DeliveryError struct {
+	Emitted      int64
+	Acknowledged int64
+	Err          error
+}
+
+// Error returns a description of the delivery failure.
+func (err *DeliveryError) Error() string {
+	return fmt.Sprintf("only %d of %d observation messages were acknowledged: %v", err.Acknowledged, err.Emitted, err.Err)
+}
+
+// Unwrap returns the cause of the first failed message.
+func (err *DeliveryError) Unwrap() error {
+	return err.Err
+}
+
+// confirmation counts the messages emitted through a delivery, so that they can be confirmed.
+type confirmation struct {
+	delivery Delivery
+	emitted  int64
+}
+
+// Write writes the message through the delivery, counting it as emitted.
+func (confirmation *confirmation) Write(ctx context.Context, message []byte) error {
+	if err := confirmation.delivery.Write(ctx, message); err != nil {
+		return err
+	}
+	confirmation.emitted++
+	return nil
+}
+
+// confirm waits for every message emitted to be acknowledged, and returns a *DeliveryError if any were not.
+// There is nothing to confirm for a nil confirmation.
+func (confirmation *confirmation) confirm(ctx context.Context) error {
+	if confirmation == nil {
+		return nil
+	}
+
+	acknowledged, err := confirmation.delivery.Wait(ctx)
+	if err == nil && acknowledged == confirmation.emitted {
+		return nil
+	}
+	return &DeliveryError{Emitted: confirmation.emitted, Acknowledged: acknowledged, Err: err}
+}
@@ -0,0 +1,24 @@
+package observation
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ReadFields returns the fields of each record in the input, so that the parser can be compared with encoding/csv.
+func ReadFields(input string) ([][]string, error) {
+	reader := &CSVReader{reader: bufio.NewReader(strings.NewReader(input))}
+
+	var records [][]string
+	for {
+		_, fields, err := reader.readRecord()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, fields)
+	}
+}
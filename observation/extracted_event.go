@@ -6,3 +6,11 @@ type ExtractedEvent struct {
 	Row        string `avro:"row"`
 	InstanceID string `avro:"instance_id"`
 }
+
+// ExtractedBatchEvent is the data that is output for a batch of consecutive observations extracted. RowIndex is the
+// index of the first row, and each following row has the next index.
+type ExtractedBatchEvent struct {
+	RowIndex   int64    `avro:"row_index"`
+	Rows       []string `avro:"rows"`
+	InstanceID string   `avro:"instance_id"`
+}
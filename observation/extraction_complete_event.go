@@ -0,0 +1,76 @@
+package observation
+
+import "github.com/ONSdigital/dp-observation-extractor/schema"
+
+// Possible statuses of a completed extraction
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// ExtractionCompleteEvent is the data that is output once extraction for an instance has finished.
+// ByteCount is the total size of the extracted rows, and DurationMS is the time taken in milliseconds. BadRowCount
+// is the number of rows that did not have the number of columns defined by the header, and BadRowIndexes holds the
+// indexes of up to MaxBadRowIndexes of them.
+type ExtractionCompleteEvent struct {
+	InstanceID    string  `avro:"instance_id"`
+	RowCount      int64   `avro:"row_count"`
+	ByteCount     int64   `avro:"byte_count"`
+	DurationMS    int64   `avro:"duration_ms"`
+	Status        string  `avro:"status"`
+	BadRowCount   int64   `avro:"bad_row_count"`
+	BadRowIndexes []int64 `avro:"bad_row_indexes"`
+}
+
+// MarshalExtractionComplete encodes the event with the latest version of its schema.
+func MarshalExtractionComplete(event ExtractionCompleteEvent) ([]byte, error) {
+	badRowIndexes := event.BadRowIndexes
+	if badRowIndexes == nil {
+		badRowIndexes = []int64{}
+	}
+	return schema.ExtractionCompleteEventVersions.Encode(schema.Record{
+		"instance_id":     event.InstanceID,
+		"row_count":       event.RowCount,
+		"byte_count":      event.ByteCount,
+		"duration_ms":     event.DurationMS,
+		"status":          event.Status,
+		"bad_row_count":   event.BadRowCount,
+		"bad_row_indexes": badRowIndexes,
+	})
+}
+
+// UnmarshalExtractionComplete decodes an event written with any version of its schema.
+func UnmarshalExtractionComplete(message []byte) (*ExtractionCompleteEvent, error) {
+	record, _, err := schema.ExtractionCompleteEventVersions.Decode(message)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &ExtractionCompleteEvent{
+		InstanceID:  stringField(record, "instance_id"),
+		RowCount:    longField(record, "row_count"),
+		ByteCount:   longField(record, "byte_count"),
+		DurationMS:  longField(record, "duration_ms"),
+		Status:      stringField(record, "status"),
+		BadRowCount: longField(record, "bad_row_count"),
+	}
+	badRowIndexes, _ := record["bad_row_indexes"].([]interface{})
+	for _, rowIndex := range badRowIndexes {
+		if value, ok := rowIndex.(int64); ok {
+			event.BadRowIndexes = append(event.BadRowIndexes, value)
+		}
+	}
+	return event, nil
+}
+
+// stringField returns the string value of a field, or an empty string if it is missing.
+func stringField(record schema.Record, name string) string {
+	value, _ := record[name].(string)
+	return value
+}
+
+// longField returns the long value of a field, or zero if it is missing.
+func longField(record schema.Record, name string) int64 {
+	value, _ := record[name].(int64)
+	return value
+}
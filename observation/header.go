@@ -0,0 +1,98 @@
+package observation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	v4Prefix = "V4_"
+	// byteOrderMark is written at the start of files by some editors, such as Excel when saving as UTF-8 CSV
+	byteOrderMark = "\uFEFF"
+)
+
+// ErrMissingHeader is returned when the input does not contain a header row.
+var ErrMissingHeader = errors.New("csv file has no header row")
+
+// Header describes the layout of a V4 file, as defined by its header row. A V4 header has a first column
+// of the form V4_<n>, where n is the number of data marking columns that follow the observation column, and
+// then a code list column and label column for each dimension.
+type Header struct {
+	DataMarkings int
+	Dimensions   []Dimension
+}
+
+// Dimension represents the pair of columns for a single dimension in a V4 file.
+type Dimension struct {
+	CodeList string
+	Name     string
+}
+
+// ColumnCount returns the number of columns expected in each row of the file.
+func (header *Header) ColumnCount() int {
+	return 1 + header.DataMarkings + 2*len(header.Dimensions)
+}
+
+// HeaderError is returned when the header row of a file does not match the V4 layout. Value holds the contents of the
+// column at fault for logging, but is left out of the error message, which is served by the jobs api and sent in
+// error reports, as the file may not be a V4 file at all.
+type HeaderError struct {
+	Column int
+	Value  string
+	Reason string
+}
+
+// Error returns a description of the invalid header, including the 1-based column at fault where known.
+func (err *HeaderError) Error() string {
+	if err.Column == 0 {
+		return fmt.Sprintf("invalid V4 header: %s", err.Reason)
+	}
+	return fmt.Sprintf("invalid V4 header: column %d: %s", err.Column, err.Reason)
+}
+
+// ParseHeader validates the given header fields against the V4 layout and returns the resulting Header. A UTF-8 byte
+// order mark at the start of the first field is ignored.
+func ParseHeader(fields []string) (*Header, error) {
+	if len(fields) == 0 {
+		return nil, &HeaderError{Reason: "no columns"}
+	}
+
+	first := strings.TrimSpace(strings.TrimPrefix(fields[0], byteOrderMark))
+	if len(first) <= len(v4Prefix) || !strings.EqualFold(first[:len(v4Prefix)], v4Prefix) {
+		return nil, &HeaderError{Column: 1, Value: fields[0], Reason: "first column must be of the form V4_<n>"}
+	}
+
+	dataMarkings, err := strconv.Atoi(first[len(v4Prefix):])
+	if err != nil || dataMarkings < 0 {
+		return nil, &HeaderError{Column: 1, Value: fields[0], Reason: "number of data marking columns must be a non-negative integer"}
+	}
+
+	dimensionColumns := len(fields) - 1 - dataMarkings
+	if dimensionColumns <= 0 {
+		return nil, &HeaderError{Reason: fmt.Sprintf("expected at least one dimension after %d data marking columns, got %d columns", dataMarkings, len(fields))}
+	}
+	if dimensionColumns%2 != 0 {
+		return nil, &HeaderError{Reason: fmt.Sprintf("dimension columns must be code and label pairs, got %d dimension columns", dimensionColumns)}
+	}
+
+	header := &Header{
+		DataMarkings: dataMarkings,
+		Dimensions:   make([]Dimension, 0, dimensionColumns/2),
+	}
+
+	for i := 1 + dataMarkings; i < len(fields); i += 2 {
+		for _, column := range []int{i, i + 1} {
+			if strings.TrimSpace(fields[column]) == "" {
+				return nil, &HeaderError{Column: column + 1, Value: fields[column], Reason: "dimension column name must not be empty"}
+			}
+		}
+		header.Dimensions = append(header.Dimensions, Dimension{
+			CodeList: fields[i],
+			Name:     fields[i+1],
+		})
+	}
+
+	return header, nil
+}
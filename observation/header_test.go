@@ -0,0 +1,122 @@
+package observation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseHeader(t *testing.T) {
+	Convey("Given a valid V4 header with one data marking column and three dimensions", t, func() {
+		fields := strings.Split(exampleCsvHeader, ",")
+
+		Convey("When ParseHeader is called", func() {
+			header, err := observation.ParseHeader(fields)
+
+			Convey("Then the header is returned with the expected layout", func() {
+				So(err, ShouldBeNil)
+				So(header.DataMarkings, ShouldEqual, 1)
+				So(header.Dimensions, ShouldResemble, []observation.Dimension{
+					{CodeList: "mmm-yy", Name: "time"},
+					{CodeList: "uk-only", Name: "geography"},
+					{CodeList: "cpih1dim1aggid", Name: "aggregate"},
+				})
+				So(header.ColumnCount(), ShouldEqual, 8)
+			})
+		})
+	})
+
+	Convey("Given a valid V4 header with a lower case prefix and no data marking columns", t, func() {
+		fields := []string{"v4_0", "mmm-yy", "time"}
+
+		Convey("When ParseHeader is called", func() {
+			header, err := observation.ParseHeader(fields)
+
+			Convey("Then the header is returned with the expected layout", func() {
+				So(err, ShouldBeNil)
+				So(header.DataMarkings, ShouldEqual, 0)
+				So(header.ColumnCount(), ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given a valid V4 header starting with a UTF-8 byte order mark", t, func() {
+		fields := strings.Split("\xef\xbb\xbfV4_0,time,time", ",")
+
+		Convey("When ParseHeader is called", func() {
+			header, err := observation.ParseHeader(fields)
+
+			Convey("Then the byte order mark is ignored and the header is accepted", func() {
+				So(err, ShouldBeNil)
+				So(header.DataMarkings, ShouldEqual, 0)
+				So(header.Dimensions, ShouldResemble, []observation.Dimension{{CodeList: "time", Name: "time"}})
+			})
+		})
+
+		Convey("When a CSV reader is created for a file with the header", func() {
+			_, err := observation.NewCSVReader(strings.NewReader("\xef\xbb\xbfV4_0,time,time\n1,Jan-96,Jan-96\n"), observation.BadRowPolicyFail)
+
+			Convey("Then the header is accepted", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given invalid V4 headers", t, func() {
+		testCases := []struct {
+			name     string
+			fields   []string
+			expected *observation.HeaderError
+		}{
+			{
+				name:     "no columns",
+				fields:   []string{},
+				expected: &observation.HeaderError{Reason: "no columns"},
+			},
+			{
+				name:     "first column without the V4 prefix",
+				fields:   []string{"observation", "mmm-yy", "time"},
+				expected: &observation.HeaderError{Column: 1, Value: "observation", Reason: "first column must be of the form V4_<n>"},
+			},
+			{
+				name:     "non-numeric data marking count",
+				fields:   []string{"V4_x", "mmm-yy", "time"},
+				expected: &observation.HeaderError{Column: 1, Value: "V4_x", Reason: "number of data marking columns must be a non-negative integer"},
+			},
+			{
+				name:     "no dimension columns",
+				fields:   []string{"V4_1", "Data_Marking"},
+				expected: &observation.HeaderError{Reason: "expected at least one dimension after 1 data marking columns, got 2 columns"},
+			},
+			{
+				name:     "unpaired dimension column",
+				fields:   []string{"V4_0", "mmm-yy", "time", "uk-only"},
+				expected: &observation.HeaderError{Reason: "dimension columns must be code and label pairs, got 3 dimension columns"},
+			},
+			{
+				name:     "empty dimension column",
+				fields:   []string{"V4_0", "mmm-yy", ""},
+				expected: &observation.HeaderError{Column: 3, Value: "", Reason: "dimension column name must not be empty"},
+			},
+		}
+
+		for _, tc := range testCases {
+			Convey("When ParseHeader is called with "+tc.name, func() {
+				header, err := observation.ParseHeader(tc.fields)
+
+				Convey("Then the expected header error is returned", func() {
+					So(header, ShouldBeNil)
+					So(err, ShouldResemble, tc.expected)
+				})
+
+				if tc.expected.Value != "" {
+					Convey("And the contents of the column are not included in the error message", func() {
+						So(err.Error(), ShouldNotContainSubstring, tc.expected.Value)
+					})
+				}
+			})
+		}
+	})
+}
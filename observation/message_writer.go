@@ -2,15 +2,27 @@ package observation
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
 
 	kafka "github.com/ONSdigital/dp-kafka/v2"
+	"github.com/ONSdigital/dp-observation-extractor/checkpoint"
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
 	"github.com/ONSdigital/dp-observation-extractor/schema"
 	"github.com/ONSdigital/log.go/v2/log"
 )
 
 // MessageWriter writes observations as messages
 type MessageWriter struct {
-	messageProducer MessageProducer
+	sink               Sink
+	completeProducer   MessageProducer
+	checkpoints        checkpoint.Store
+	checkpointInterval int64
+	batchSize          int
+	batchMaxBytes      int64
+	jobs               JobTracker
 }
 
 // MessageProducer dependency that writes messages
@@ -18,37 +30,447 @@ type MessageProducer interface {
 	Channels() *kafka.ProducerChannels
 }
 
-// NewMessageWriter returns a new observation message writer.
-func NewMessageWriter(messageProducer MessageProducer) *MessageWriter {
+// JobTracker dependency that records the progress of the job extracting each instance
+type JobTracker interface {
+	SetRowsEmitted(jobID string, rows int64)
+}
+
+// Extraction identifies the observations being written by WriteAll.
+type Extraction struct {
+	InstanceID string
+	// FileURL is the file that the observations are read from, which checkpoints are only resumed for.
+	FileURL string
+	// JobID is the job that progress is recorded against, or empty if the extraction has no job.
+	JobID string
+	// Partial is true if only a selection of the rows is being extracted. A partial extraction does not finish the
+	// instance, so no extraction complete event is sent, and the instance's checkpoint is not used or changed.
+	Partial bool
+}
+
+// Sink dependency that observation extracted event messages are written to
+type Sink interface {
+	Write(ctx context.Context, message []byte) error
+}
+
+// NewMessageWriter returns a new observation message writer. Observations are written to the sink, and
+// an extraction complete event is sent to the completeProducer for each instance. If completeProducer is nil then
+// no extraction complete events are sent. A checkpoint is saved to the checkpoints store every checkpointInterval
+// rows, or checkpointing is disabled if checkpoints is nil.
+//
+// If batchSize is greater than 1, consecutive observations are sent together as observation extracted batch events
+// of up to batchSize rows, with the rows in each batch totalling no more than batchMaxBytes (unless a single row is
+// larger). Otherwise each observation is sent as an observation extracted event.
+//
+// The number of rows emitted for each extraction with a job is recorded in jobs as messages are sent, unless jobs is
+// nil.
+func NewMessageWriter(sink Sink, completeProducer MessageProducer, checkpoints checkpoint.Store, checkpointInterval int64, batchSize int, batchMaxBytes int64, jobs JobTracker) *MessageWriter {
 	return &MessageWriter{
-		messageProducer: messageProducer,
+		sink:               sink,
+		completeProducer:   completeProducer,
+		checkpoints:        checkpoints,
+		checkpointInterval: checkpointInterval,
+		batchSize:          batchSize,
+		batchMaxBytes:      batchMaxBytes,
+		jobs:               jobs,
+	}
+}
+
+// ReadError is returned by WriteAll when the observation reader fails for any reason other than reaching the end of the input.
+type ReadError struct {
+	RowsWritten int64
+	Err         error
+}
+
+// Error returns a description of the read failure.
+func (err *ReadError) Error() string {
+	return fmt.Sprintf("failed to read observation after %d rows written: %v", err.RowsWritten, err.Err)
+}
+
+// Unwrap returns the underlying read error.
+func (err *ReadError) Unwrap() error {
+	return err.Err
+}
+
+// MarshalError is returned by WriteAll when an observation could not be marshalled into an extracted event message.
+type MarshalError struct {
+	RowIndex int64
+	Err      error
+}
+
+// Error returns a description of the marshal failure.
+func (err *MarshalError) Error() string {
+	return fmt.Sprintf("failed to marshal observation extracted event for row %d: %v", err.RowIndex, err.Err)
+}
+
+// Unwrap returns the underlying marshal error.
+func (err *MarshalError) Unwrap() error {
+	return err.Err
+}
+
+// Permanent returns true, as the observation will fail to marshal however many times it is written.
+func (err *MarshalError) Permanent() bool {
+	return true
+}
+
+// permanentError is implemented by errors that will occur however many times the same file is extracted.
+type permanentError interface {
+	Permanent() bool
+}
+
+// isPermanent returns true if the error will occur however many times the same file is extracted.
+func isPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent) && permanent.Permanent()
+}
+
+// WriteError is returned by WriteAll when an observation extracted event could not be written to the sink.
+type WriteError struct {
+	RowIndex int64
+	Err      error
+}
+
+// Error returns a description of the write failure.
+func (err *WriteError) Error() string {
+	return fmt.Sprintf("failed to write observation extracted event for row %d: %v", err.RowIndex, err.Err)
+}
+
+// Unwrap returns the underlying write error.
+func (err *WriteError) Unwrap() error {
+	return err.Err
+}
+
+// NotResumableError is returned by WriteAll when it fails after writing rows that would be written again if the
+// extraction were retried, as there is no checkpoint to carry on from. It is permanent, so that the rows are not
+// duplicated by retrying the extraction.
+type NotResumableError struct {
+	RowsWritten int64
+	Err         error
+}
+
+// Error returns a description of the failure.
+func (err *NotResumableError) Error() string {
+	return fmt.Sprintf("%v, with %d rows written that cannot be resumed from", err.Err, err.RowsWritten)
+}
+
+// Unwrap returns the error that the extraction failed with.
+func (err *NotResumableError) Unwrap() error {
+	return err.Err
+}
+
+// Permanent returns true, as retrying the extraction would write the rows again.
+func (err *NotResumableError) Permanent() bool {
+	return true
+}
+
+// CancelledError is returned by WriteAll when the context is done before every observation has been written.
+type CancelledError struct {
+	RowsWritten int64
+	Err         error
+}
+
+// Error returns a description of the cancellation.
+func (err *CancelledError) Error() string {
+	return fmt.Sprintf("extraction cancelled after %d rows written: %v", err.RowsWritten, err.Err)
+}
+
+// Unwrap returns the context's error.
+func (err *CancelledError) Unwrap() error {
+	return err.Err
+}
+
+// WriteAll observations as messages from the given observation reader. A nil error is only returned once the
+// reader has reached the end of its input, otherwise a *ReadError, *MarshalError, *WriteError or *DeliveryError is
+// returned. Once finished, an extraction complete event is sent with the final status of the instance, including the
+// number and indexes of any bad rows if the reader is a BadRowReader.
+//
+// The context is checked between rows. If it is done first, a *CancelledError is returned and no extraction complete
+// event is sent, as the instance has not finished and is left to be extracted again.
+//
+// If the sink is a ConfirmedSink, the instance only completes once every message emitted has been acknowledged.
+//
+// If a checkpoint store has been provided, progress is saved periodically and extraction of a ResumableReader
+// carries on from the last checkpoint for the instance, if it was saved for the same file. The checkpoint is removed
+// once extraction has completed, or has failed with an error that extracting the file again would not avoid.
+// When the sink is a ConfirmedSink, progress is only saved once the messages it includes have been acknowledged.
+// Otherwise, a failure once rows have been written is returned as a *NotResumableError, as extracting the file again
+// would write them again.
+//
+// A partial extraction is written without an extraction complete event or checkpoints, leaving those of the full
+// extraction of the instance untouched.
+func (messageWriter MessageWriter) WriteAll(ctx context.Context, reader Reader, extraction Extraction) error {
+	start := time.Now()
+	instanceID := extraction.InstanceID
+
+	if extraction.Partial {
+		messageWriter.completeProducer = nil
+		messageWriter.checkpoints = nil
+	}
+
+	progress := messageWriter.resume(ctx, reader, extraction)
+
+	var confirmed *confirmation
+	if confirmedSink, ok := messageWriter.sink.(ConfirmedSink); ok {
+		confirmed = &confirmation{delivery: confirmedSink.NewDelivery()}
+	}
+
+	err := messageWriter.writeObservations(ctx, reader, extraction, progress, confirmed)
+	if err != nil && ctx.Err() != nil {
+		return messageWriter.cancel(ctx, instanceID, progress, confirmed)
+	}
+
+	confirmErr := confirmed.confirm(ctx)
+	if confirmErr != nil {
+		log.Error(ctx, "observation messages were not all acknowledged", confirmErr, log.Data{"instanceID": instanceID})
+		if err == nil {
+			err = confirmErr
+		}
+	}
+	if err != nil && progress.RowsWritten > 0 && !isPermanent(err) && !messageWriter.resumable(reader) {
+		err = &NotResumableError{RowsWritten: progress.RowsWritten, Err: err}
+	}
+
+	completeEvent := ExtractionCompleteEvent{
+		InstanceID: instanceID,
+		RowCount:   progress.RowsWritten,
+		ByteCount:  progress.BytesWritten,
+		DurationMS: time.Since(start).Milliseconds(),
+		Status:     StatusCompleted,
+	}
+	if badRows, ok := reader.(BadRowReader); ok && badRows.BadRowCount() > 0 {
+		completeEvent.BadRowCount = badRows.BadRowCount()
+		completeEvent.BadRowIndexes = badRows.BadRowIndexes()
+		log.Warn(ctx, "rows with an unexpected number of columns were read", log.Data{
+			"instanceID":      instanceID,
+			"bad_row_count":   completeEvent.BadRowCount,
+			"bad_row_indexes": completeEvent.BadRowIndexes,
+		})
 	}
+	if err != nil {
+		completeEvent.Status = StatusFailed
+		switch {
+		case isPermanent(err):
+			messageWriter.clearCheckpoint(ctx, instanceID)
+		case confirmErr == nil:
+			messageWriter.saveCheckpoint(ctx, instanceID, progress)
+		}
+	}
+	metrics.ExtractionDuration.WithLabelValues(completeEvent.Status).Observe(time.Since(start).Seconds())
+
+	completeErr := messageWriter.writeComplete(ctx, completeEvent)
+	if err != nil {
+		return err
+	}
+	if completeErr != nil {
+		return completeErr
+	}
+
+	messageWriter.clearCheckpoint(ctx, instanceID)
+	return nil
+}
+
+// cancel returns a *CancelledError for an instance whose context is done, saving its progress so that extraction
+// can carry on from where it stopped. When the sink is a ConfirmedSink, the messages in flight cannot be confirmed once
+// the context is done, so the last confirmed checkpoint is kept instead.
+func (messageWriter MessageWriter) cancel(ctx context.Context, instanceID string, progress *checkpoint.Checkpoint, confirmed *confirmation) error {
+	log.Info(ctx, "extraction cancelled", log.Data{"instanceID": instanceID, "rows_written": progress.RowsWritten})
+
+	if confirmed == nil {
+		messageWriter.saveCheckpoint(context.WithoutCancel(ctx), instanceID, progress)
+	}
+	return &CancelledError{RowsWritten: progress.RowsWritten, Err: ctx.Err()}
+}
+
+// resumable returns true if extraction of the reader can carry on from a checkpoint if it is retried.
+func (messageWriter MessageWriter) resumable(reader Reader) bool {
+	_, ok := reader.(ResumableReader)
+	return ok && messageWriter.checkpoints != nil
+}
+
+// resume returns the progress previously saved for the instance, and makes the reader skip the rows that have already
+// been written. Progress starts from zero if there is no checkpoint store, no checkpoint, the checkpoint was saved for
+// a different file or the reader is not resumable.
+func (messageWriter MessageWriter) resume(ctx context.Context, reader Reader, extraction Extraction) *checkpoint.Checkpoint {
+	progress := &checkpoint.Checkpoint{FileURL: extraction.FileURL}
+	if messageWriter.checkpoints == nil {
+		return progress
+	}
+
+	instanceID := extraction.InstanceID
+	logData := log.Data{"instanceID": instanceID}
+	resumable, ok := reader.(ResumableReader)
+	if !ok {
+		log.Warn(ctx, "observation reader is not resumable, extracting from the first row", logData)
+		return progress
+	}
+
+	saved, err := messageWriter.checkpoints.Get(ctx, instanceID)
+	if err != nil {
+		log.Warn(ctx, "failed to get checkpoint, extracting from the first row", log.FormatErrors([]error{err}), logData)
+		return progress
+	}
+	if saved == nil {
+		return progress
+	}
+	if saved.FileURL != extraction.FileURL {
+		logData["checkpoint"] = saved
+		logData["url"] = extraction.FileURL
+		log.Info(ctx, "checkpoint was saved for a different file, extracting from the first row", logData)
+		return progress
+	}
+
+	logData["checkpoint"] = saved
+	log.Info(ctx, "resuming extraction from checkpoint", logData)
+	resumable.ResumeAfter(saved.RowIndex)
+	return saved
 }
 
-// WriteAll observations as messages from the given observation reader.
-func (messageWriter MessageWriter) WriteAll(ctx context.Context, reader Reader, instanceID string) {
-	observation, readErr := reader.Read()
+// writeObservations sends a message for each observation, or batch of observations, from the given reader, updating
+// the given progress as each message is sent. If confirmed is not nil, messages are written through its delivery, and
+// are confirmed before each checkpoint is saved. The context's error is returned if it is done before the next row.
+func (messageWriter MessageWriter) writeObservations(ctx context.Context, reader Reader, extraction Extraction, progress *checkpoint.Checkpoint, confirmed *confirmation) error {
+	instanceID := extraction.InstanceID
+	logData := log.Data{"instanceID": instanceID}
+	pending := &batch{}
+	checkpointed := progress.RowsWritten
+
+	var out Sink = messageWriter.sink
+	if confirmed != nil {
+		out = confirmed
+	}
+
+	send := func() error {
+		if len(pending.rows) == 0 {
+			return nil
+		}
+		if err := messageWriter.send(ctx, out, instanceID, pending); err != nil {
+			return err
+		}
+
+		metrics.RowsExtracted.Add(float64(len(pending.rows)))
+		progress.RowIndex = pending.lastRowIndex()
+		progress.RowsWritten += int64(len(pending.rows))
+		progress.BytesWritten += pending.bytes
+		pending.reset()
+
+		if messageWriter.jobs != nil && extraction.JobID != "" {
+			messageWriter.jobs.SetRowsEmitted(extraction.JobID, progress.RowsWritten)
+		}
+
+		if messageWriter.checkpointInterval > 0 && progress.RowsWritten-checkpointed >= messageWriter.checkpointInterval {
+			if err := confirmed.confirm(ctx); err != nil {
+				return err
+			}
+			messageWriter.saveCheckpoint(ctx, instanceID, progress)
+			checkpointed = progress.RowsWritten
+		}
+		return nil
+	}
 
-	for readErr == nil {
-		extractedEvent := ExtractedEvent{
-			InstanceID: instanceID,
-			Row:        observation.Row,
-			RowIndex:   observation.RowIndex,
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		bytes, err := schema.ObservationExtractedEvent.Marshal(extractedEvent)
+		observation, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			log.Error(ctx, "", err, log.Data{
-				"schema": "failed to marshal observation extracted event",
-				"event":  extractedEvent})
+			// send the rows already read, so that progress includes every row before the failure
+			if sendErr := send(); sendErr != nil {
+				return sendErr
+			}
+			logData["rows_written"] = progress.RowsWritten
+			log.Error(ctx, "failed to read observation", err, logData)
+			return &ReadError{RowsWritten: progress.RowsWritten, Err: err}
+		}
+
+		if !pending.accepts(observation, messageWriter.batchMaxBytes) {
+			if err = send(); err != nil {
+				return err
+			}
+		}
+
+		pending.add(observation)
+		if len(pending.rows) >= messageWriter.batchSize {
+			if err = send(); err != nil {
+				return err
+			}
 		}
+	}
+
+	if err := send(); err != nil {
+		return err
+	}
+
+	logData["rows_written"] = progress.RowsWritten
+	log.Info(ctx, "all observations extracted", logData)
+	return nil
+}
+
+// send marshals the batch of observations and writes it to the given sink.
+func (messageWriter MessageWriter) send(ctx context.Context, out Sink, instanceID string, pending *batch) error {
+	bytes, err := pending.marshal(instanceID, messageWriter.batchSize > 1)
+	if err != nil {
+		log.Error(ctx, "failed to marshal observation extracted event", err, log.Data{
+			"instanceID": instanceID,
+			"row_index":  pending.rowIndex})
+		return &MarshalError{RowIndex: pending.rowIndex, Err: err}
+	}
 
-		messageWriter.messageProducer.Channels().Output <- bytes
+	if err = out.Write(ctx, bytes); err != nil {
+		log.Error(ctx, "failed to write observation extracted event", err, log.Data{
+			"instanceID": instanceID,
+			"row_index":  pending.rowIndex})
+		return &WriteError{RowIndex: pending.rowIndex, Err: err}
+	}
+	return nil
+}
+
+// saveCheckpoint stores the given progress for the instance, if a checkpoint store has been provided. Failing to
+// save a checkpoint does not stop extraction, so errors are only logged.
+func (messageWriter MessageWriter) saveCheckpoint(ctx context.Context, instanceID string, progress *checkpoint.Checkpoint) {
+	if messageWriter.checkpoints == nil || progress.RowIndex == 0 {
+		return
+	}
 
-		observation, readErr = reader.Read()
+	if err := messageWriter.checkpoints.Set(ctx, instanceID, *progress); err != nil {
+		log.Warn(ctx, "failed to save checkpoint", log.FormatErrors([]error{err}), log.Data{"instanceID": instanceID, "checkpoint": progress})
+	}
+}
+
+// clearCheckpoint removes the checkpoint for the instance, if a checkpoint store has been provided.
+func (messageWriter MessageWriter) clearCheckpoint(ctx context.Context, instanceID string) {
+	if messageWriter.checkpoints == nil {
+		return
 	}
 
-	log.Info(ctx, "all observations extracted", log.Data{"instanceID": instanceID})
+	if err := messageWriter.checkpoints.Delete(ctx, instanceID); err != nil {
+		log.Warn(ctx, "failed to clear checkpoint", log.FormatErrors([]error{err}), log.Data{"instanceID": instanceID})
+	}
+}
+
+// writeComplete sends the given extraction complete event, if a producer has been provided for them. The context's
+// error is returned if it is done before the producer takes the event.
+func (messageWriter MessageWriter) writeComplete(ctx context.Context, completeEvent ExtractionCompleteEvent) error {
+	if messageWriter.completeProducer == nil {
+		return nil
+	}
+
+	bytes, err := MarshalExtractionComplete(completeEvent)
+	if err != nil {
+		log.Error(ctx, "failed to marshal extraction complete event", err, log.Data{"event": completeEvent})
+		return err
+	}
+
+	select {
+	case messageWriter.completeProducer.Channels().Output <- bytes:
+	case <-ctx.Done():
+		log.Info(ctx, "extraction complete event not sent as the context is done", log.Data{"event": completeEvent})
+		return ctx.Err()
+	}
+	log.Info(ctx, "extraction complete event sent", log.Data{"event": completeEvent})
+	return nil
 }
 
 // Marshal converts the given observationExtractedEvent to a []byte.
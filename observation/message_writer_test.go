@@ -2,16 +2,31 @@ package observation_test
 
 import (
 	"context"
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	kafka "github.com/ONSdigital/dp-kafka/v2"
 	kafkatest "github.com/ONSdigital/dp-kafka/v2/kafkatest"
+	"github.com/ONSdigital/dp-observation-extractor/checkpoint"
+	"github.com/ONSdigital/dp-observation-extractor/checkpoint/checkpointtest"
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
 	"github.com/ONSdigital/dp-observation-extractor/observation"
 	"github.com/ONSdigital/dp-observation-extractor/observation/observationtest"
 	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-var ctx = context.Background()
+var (
+	ctx                = context.Background()
+	errConnectionReset = errors.New("connection reset")
+)
 
 const (
 	expectedInstanceID = "123abc"
@@ -29,20 +44,578 @@ func TestMessageWriter_WriteAll(t *testing.T) {
 
 		// mock schema producer contains the output channel to capture messages sent.
 		mockMessageProducer := kafkatest.NewMessageProducer(true)
+		mockCompleteProducer := newBufferedMessageProducer()
 
-		observationMessageWriter := observation.NewMessageWriter(mockMessageProducer)
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), mockCompleteProducer, nil, 0, 1, 0, nil)
 
 		Convey("When write all is called on the observation schema writer", func() {
+			errChan := make(chan error, 1)
 			go func() {
-				observationMessageWriter.WriteAll(ctx, mockObservationReader, expectedInstanceID)
+				errChan <- observationMessageWriter.WriteAll(ctx, mockObservationReader, observation.Extraction{InstanceID: expectedInstanceID})
 			}()
 
 			Convey("The schema producer has the observation on its output channel", func() {
 				messageBytes := <-mockMessageProducer.Channels().Output
+				So(<-errChan, ShouldBeNil)
 				err := mockMessageProducer.Close(ctx)
 				So(err, ShouldBeNil)
 				observationEvent := Unmarshal(messageBytes)
 				So(observationEvent.InstanceID, ShouldEqual, expectedEvent.InstanceID)
+
+				Convey("And a completed extraction complete event is sent", func() {
+					completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+					So(completeEvent.InstanceID, ShouldEqual, expectedInstanceID)
+					So(completeEvent.RowCount, ShouldEqual, 1)
+					So(completeEvent.ByteCount, ShouldEqual, len(expectedObservation.Row))
+					So(completeEvent.Status, ShouldEqual, observation.StatusCompleted)
+				})
+			})
+		})
+	})
+
+	Convey("Given an observation reader that fails with an error other than EOF", t, func() {
+		readErr := errors.New("connection reset")
+		expectedObservations := []*observation.Observation{{Row: "the,row,content"}}
+		mockObservationReader := observationtest.NewReader(expectedObservations, readErr)
+
+		mockMessageProducer := kafkatest.NewMessageProducer(true)
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), mockCompleteProducer, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called on the observation schema writer", func() {
+			err := observationMessageWriter.WriteAll(ctx, mockObservationReader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then a read error wrapping the reader error is returned", func() {
+				So(err, ShouldResemble, &observation.ReadError{RowsWritten: 0, Err: readErr})
+				So(errors.Is(err, readErr), ShouldBeTrue)
+			})
+
+			Convey("And no messages are sent to the producer", func() {
+				So(len(mockMessageProducer.Channels().Output), ShouldEqual, 0)
+				So(mockMessageProducer.Close(ctx), ShouldBeNil)
+			})
+
+			Convey("And a failed extraction complete event is sent", func() {
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.InstanceID, ShouldEqual, expectedInstanceID)
+				So(completeEvent.RowCount, ShouldEqual, 0)
+				So(completeEvent.Status, ShouldEqual, observation.StatusFailed)
+			})
+		})
+	})
+	Convey("Given an observation reader that fails with a transient error after rows have been written, and no checkpoint store", t, func() {
+		input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96,Feb-96\n"
+		reader, err := observation.NewCSVReader(io.MultiReader(strings.NewReader(input), iotest.ErrReader(errConnectionReset)), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		memory := sink.NewMemory()
+		observationMessageWriter := observation.NewMessageWriter(memory, nil, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then a permanent error is returned, as retrying would send the rows again", func() {
+				var notResumable *observation.NotResumableError
+				So(errors.As(err, &notResumable), ShouldBeTrue)
+				So(notResumable.RowsWritten, ShouldEqual, 2)
+				So(notResumable.Permanent(), ShouldBeTrue)
+				var readErr *observation.ReadError
+				So(errors.As(err, &readErr), ShouldBeTrue)
+				So(errors.Is(err, errConnectionReset), ShouldBeTrue)
+				So(memory.Messages(), ShouldHaveLength, 2)
+			})
+		})
+	})
+}
+
+func TestMessageWriter_WriteAllWithBadRows(t *testing.T) {
+	Convey("Given a file with bad rows and a reader that skips them", t, func() {
+		input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96\n3,Mar-96,Mar-96\n4\n"
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicySkip)
+		So(err, ShouldBeNil)
+
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewMemory(), mockCompleteProducer, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldBeNil)
+
+			Convey("Then the extraction complete event reports the number and indexes of the bad rows", func() {
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.Status, ShouldEqual, observation.StatusCompleted)
+				So(completeEvent.RowCount, ShouldEqual, 2)
+				So(completeEvent.BadRowCount, ShouldEqual, 2)
+				So(completeEvent.BadRowIndexes, ShouldResemble, []int64{2, 4})
+			})
+		})
+	})
+}
+
+func TestMessageWriter_WriteAllToSink(t *testing.T) {
+	input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96,Feb-96\n"
+
+	Convey("Given an in-memory sink", t, func() {
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(memory, nil, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then a message is written to the sink for each row", func() {
+				So(err, ShouldBeNil)
+				messages := memory.Messages()
+				So(messages, ShouldHaveLength, 2)
+				So(Unmarshal(messages[0]).Row, ShouldEqual, "1,Jan-96,Jan-96")
+				So(Unmarshal(messages[1]).RowIndex, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given an in-memory sink and a job in progress for the instance", t, func() {
+		registry := jobs.NewRegistry(10)
+		jobID, err := registry.Start("", expectedInstanceID, "file:///data.csv", "", false)
+		So(err, ShouldBeNil)
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(sink.NewMemory(), nil, nil, 0, 1, 0, registry)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID, JobID: jobID})
+			So(err, ShouldBeNil)
+
+			Convey("Then the rows emitted are recorded for the job", func() {
+				job, ok := registry.GetByID(jobID)
+				So(ok, ShouldBeTrue)
+				So(job.RowsEmitted, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a sink that fails to write", t, func() {
+		writeErr := errors.New("disk full")
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(failingSink{err: writeErr}, mockCompleteProducer, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then a write error wrapping the sink error is returned", func() {
+				So(err, ShouldResemble, &observation.WriteError{RowIndex: 1, Err: writeErr})
+				So(errors.Is(err, writeErr), ShouldBeTrue)
+			})
+
+			Convey("And a failed extraction complete event is sent", func() {
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.RowCount, ShouldEqual, 0)
+				So(completeEvent.Status, ShouldEqual, observation.StatusFailed)
+			})
+		})
+	})
+}
+
+func TestMessageWriter_WriteAllInBatches(t *testing.T) {
+	input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96,Feb-96\n3,Mar-96,Mar-96\n4,Apr-96,Apr-96\n5,May-96,May-96\n"
+
+	Convey("Given a message writer with a batch size of 2", t, func() {
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(memory, mockCompleteProducer, nil, 0, 2, 1000, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldBeNil)
+
+			Convey("Then the rows are sent in batches, with the last batch holding the remaining row", func() {
+				batches := unmarshalBatches(memory.Messages())
+				So(batches, ShouldResemble, []observation.ExtractedBatchEvent{
+					{InstanceID: expectedInstanceID, RowIndex: 1, Rows: []string{"1,Jan-96,Jan-96", "2,Feb-96,Feb-96"}},
+					{InstanceID: expectedInstanceID, RowIndex: 3, Rows: []string{"3,Mar-96,Mar-96", "4,Apr-96,Apr-96"}},
+					{InstanceID: expectedInstanceID, RowIndex: 5, Rows: []string{"5,May-96,May-96"}},
+				})
+			})
+
+			Convey("And the extraction complete event counts every row", func() {
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.RowCount, ShouldEqual, 5)
+				So(completeEvent.ByteCount, ShouldEqual, 75)
+			})
+		})
+	})
+
+	Convey("Given a message writer with a batch max bytes that fits two rows", t, func() {
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(memory, nil, nil, 0, 10, 30, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldBeNil)
+
+			Convey("Then a new batch is started before the rows would total more than the max bytes", func() {
+				batches := unmarshalBatches(memory.Messages())
+				So(batches, ShouldHaveLength, 3)
+				So(batches[0].Rows, ShouldHaveLength, 2)
+				So(batches[1].RowIndex, ShouldEqual, 3)
+				So(batches[2].Rows, ShouldResemble, []string{"5,May-96,May-96"})
+			})
+		})
+	})
+
+	Convey("Given rows that are skipped by the bad row policy", t, func() {
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader("V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96\n3,Mar-96,Mar-96\n4,Apr-96,Apr-96\n"), observation.BadRowPolicySkip)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(memory, nil, nil, 0, 10, 1000, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldBeNil)
+
+			Convey("Then a new batch is started after the gap, so that the original row indexes are kept", func() {
+				batches := unmarshalBatches(memory.Messages())
+				So(batches, ShouldResemble, []observation.ExtractedBatchEvent{
+					{InstanceID: expectedInstanceID, RowIndex: 1, Rows: []string{"1,Jan-96,Jan-96"}},
+					{InstanceID: expectedInstanceID, RowIndex: 3, Rows: []string{"3,Mar-96,Mar-96", "4,Apr-96,Apr-96"}},
+				})
+			})
+		})
+	})
+
+	Convey("Given a message writer with batches and checkpoints", t, func() {
+		checkpoints := checkpointtest.NewStore()
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(io.MultiReader(strings.NewReader(input), iotest.ErrReader(errConnectionReset)), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(memory, nil, checkpoints, 3, 2, 1000, nil)
+
+		Convey("When write all is called and the reader fails part way through", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldNotBeNil)
+
+			Convey("Then the rows read before the failure are sent", func() {
+				So(unmarshalBatches(memory.Messages()), ShouldHaveLength, 3)
+			})
+
+			Convey("Then checkpoints are saved once a batch takes the rows past each interval", func() {
+				So(checkpoints.History, ShouldResemble, []checkpoint.Checkpoint{
+					{RowIndex: 4, RowsWritten: 4, BytesWritten: 60},
+					{RowIndex: 5, RowsWritten: 5, BytesWritten: 75},
+				})
+			})
+		})
+	})
+}
+
+func TestMessageWriter_WriteAllWithCheckpoints(t *testing.T) {
+	input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96,Feb-96\n3,Mar-96,Mar-96\n"
+
+	Convey("Given a checkpoint store without a checkpoint for the instance", t, func() {
+		checkpoints := checkpointtest.NewStore()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockMessageProducer := newBufferedMessageProducer()
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), mockCompleteProducer, checkpoints, 2, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldBeNil)
+
+			Convey("Then a checkpoint is saved every interval", func() {
+				So(checkpoints.History, ShouldResemble, []checkpoint.Checkpoint{
+					{RowIndex: 2, RowsWritten: 2, BytesWritten: 30},
+				})
+			})
+
+			Convey("Then the checkpoint is cleared once extraction has completed", func() {
+				So(checkpoints.Deleted, ShouldResemble, []string{expectedInstanceID})
+				cp, err := checkpoints.Get(ctx, expectedInstanceID)
+				So(err, ShouldBeNil)
+				So(cp, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a checkpoint store with a checkpoint for the instance", t, func() {
+		checkpoints := checkpointtest.NewStore()
+		err := checkpoints.Set(ctx, expectedInstanceID, checkpoint.Checkpoint{RowIndex: 2, RowsWritten: 2, BytesWritten: 30})
+		So(err, ShouldBeNil)
+
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockMessageProducer := newBufferedMessageProducer()
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), mockCompleteProducer, checkpoints, 2, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldBeNil)
+
+			Convey("Then only the rows after the checkpoint are sent", func() {
+				So(len(mockMessageProducer.Channels().Output), ShouldEqual, 1)
+				extracted := Unmarshal(<-mockMessageProducer.Channels().Output)
+				So(extracted.RowIndex, ShouldEqual, 3)
+			})
+
+			Convey("Then the extraction complete event includes the rows written before the checkpoint", func() {
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.RowCount, ShouldEqual, 3)
+				So(completeEvent.ByteCount, ShouldEqual, 45)
+			})
+		})
+	})
+
+	Convey("Given a checkpoint store with a checkpoint for the instance and a partial extraction", t, func() {
+		saved := checkpoint.Checkpoint{RowIndex: 2, RowsWritten: 2, BytesWritten: 30}
+		checkpoints := checkpointtest.NewStore()
+		So(checkpoints.Set(ctx, expectedInstanceID, saved), ShouldBeNil)
+
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockMessageProducer := newBufferedMessageProducer()
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), mockCompleteProducer, checkpoints, 2, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID, Partial: true})
+			So(err, ShouldBeNil)
+
+			Convey("Then every row is sent without resuming from the checkpoint", func() {
+				So(len(mockMessageProducer.Channels().Output), ShouldEqual, 3)
+			})
+
+			Convey("Then no extraction complete event is sent", func() {
+				So(len(mockCompleteProducer.Channels().Output), ShouldEqual, 0)
+			})
+
+			Convey("Then the checkpoint for the full extraction is left unchanged", func() {
+				So(checkpoints.History, ShouldResemble, []checkpoint.Checkpoint{saved})
+				So(checkpoints.Deleted, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a checkpoint store and a reader that fails part way through", t, func() {
+		checkpoints := checkpointtest.NewStore()
+		reader, err := observation.NewCSVReader(io.MultiReader(strings.NewReader(input), iotest.ErrReader(errConnectionReset)), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockMessageProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), nil, checkpoints, 10, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(err, ShouldNotBeNil)
+
+			Convey("Then the last row sent is saved as a checkpoint", func() {
+				cp, err := checkpoints.Get(ctx, expectedInstanceID)
+				So(err, ShouldBeNil)
+				So(*cp, ShouldResemble, checkpoint.Checkpoint{RowIndex: 3, RowsWritten: 3, BytesWritten: 45})
+				So(checkpoints.Deleted, ShouldBeEmpty)
+			})
+
+			Convey("And the error can be retried, as extraction can carry on from the checkpoint", func() {
+				var notResumable *observation.NotResumableError
+				So(errors.As(err, &notResumable), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a checkpoint store with a checkpoint for the instance from another file", t, func() {
+		checkpoints := checkpointtest.NewStore()
+		err := checkpoints.Set(ctx, expectedInstanceID, checkpoint.Checkpoint{FileURL: "s3://bucket/old.csv", RowIndex: 2, RowsWritten: 2, BytesWritten: 30})
+		So(err, ShouldBeNil)
+
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockMessageProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), nil, checkpoints, 2, 1, 0, nil)
+
+		Convey("When write all is called for a different file", func() {
+			extraction := observation.Extraction{InstanceID: expectedInstanceID, FileURL: "s3://bucket/new.csv"}
+			err := observationMessageWriter.WriteAll(ctx, reader, extraction)
+			So(err, ShouldBeNil)
+
+			Convey("Then the checkpoint is ignored and every row is sent", func() {
+				So(len(mockMessageProducer.Channels().Output), ShouldEqual, 3)
+			})
+
+			Convey("Then checkpoints are saved with the url of the file", func() {
+				So(checkpoints.History[1:], ShouldResemble, []checkpoint.Checkpoint{
+					{FileURL: "s3://bucket/new.csv", RowIndex: 2, RowsWritten: 2, BytesWritten: 30},
+				})
+			})
+		})
+	})
+
+	Convey("Given a checkpoint store and a file with a bad row part way through", t, func() {
+		checkpoints := checkpointtest.NewStore()
+		reader, err := observation.NewCSVReader(strings.NewReader(input+"4,Apr-96\n"), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockMessageProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(sink.NewKafka(mockMessageProducer), nil, checkpoints, 2, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then a permanent error is returned", func() {
+				var rowErr *observation.RowError
+				So(errors.As(err, &rowErr), ShouldBeTrue)
+				So(rowErr.Permanent(), ShouldBeTrue)
+			})
+
+			Convey("Then the checkpoint is cleared, as extracting the file again would fail at the same row", func() {
+				cp, err := checkpoints.Get(ctx, expectedInstanceID)
+				So(err, ShouldBeNil)
+				So(cp, ShouldBeNil)
+				So(checkpoints.Deleted, ShouldResemble, []string{expectedInstanceID})
+			})
+		})
+	})
+}
+
+func TestMessageWriter_WriteAllConfirmed(t *testing.T) {
+	input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96,Feb-96\n3,Mar-96,Mar-96\n"
+
+	Convey("Given a confirmed sink that acknowledges every message", t, func() {
+		producer := mocks.NewAsyncProducer(t, newSaramaConfig())
+		for i := 0; i < 3; i++ {
+			producer.ExpectInputAndSucceed()
+		}
+		ackedKafka := sink.NewAckedKafka(producer, "observation-extracted", 10, 0)
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(ackedKafka, mockCompleteProducer, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(ackedKafka.Close(), ShouldBeNil)
+
+			Convey("Then the instance completes", func() {
+				So(err, ShouldBeNil)
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.RowCount, ShouldEqual, 3)
+				So(completeEvent.Status, ShouldEqual, observation.StatusCompleted)
+			})
+		})
+	})
+
+	Convey("Given a confirmed sink that fails to deliver a message, and a checkpoint store", t, func() {
+		produceErr := errors.New("not enough replicas")
+		producer := mocks.NewAsyncProducer(t, newSaramaConfig())
+		producer.ExpectInputAndSucceed()
+		producer.ExpectInputAndFail(produceErr)
+		producer.ExpectInputAndSucceed()
+		ackedKafka := sink.NewAckedKafka(producer, "observation-extracted", 10, 0)
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		checkpoints := checkpointtest.NewStore()
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(ackedKafka, mockCompleteProducer, checkpoints, 10, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(ctx, reader, observation.Extraction{InstanceID: expectedInstanceID})
+			So(ackedKafka.Close(), ShouldBeNil)
+
+			Convey("Then a delivery error is returned with the messages emitted and acknowledged", func() {
+				So(err, ShouldResemble, &observation.DeliveryError{Emitted: 3, Acknowledged: 2, Err: produceErr})
+				So(errors.Is(err, produceErr), ShouldBeTrue)
+			})
+
+			Convey("And a failed extraction complete event is sent", func() {
+				completeEvent := unmarshalComplete(<-mockCompleteProducer.Channels().Output)
+				So(completeEvent.Status, ShouldEqual, observation.StatusFailed)
+			})
+
+			Convey("And no checkpoint is saved", func() {
+				So(checkpoints.History, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestMessageWriter_WriteAllCancelled(t *testing.T) {
+	input := "V4_0,mmm-yy,time\n1,Jan-96,Jan-96\n2,Feb-96,Feb-96\n3,Mar-96,Mar-96\n"
+
+	Convey("Given a checkpoint store and a sink whose context is cancelled while writing the second row", t, func() {
+		cancellable, cancel := context.WithCancel(ctx)
+		defer cancel()
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+
+		checkpoints := checkpointtest.NewStore()
+		mockCompleteProducer := newBufferedMessageProducer()
+		observationMessageWriter := observation.NewMessageWriter(&cancellingSink{memory: memory, cancel: cancel, after: 1}, mockCompleteProducer, checkpoints, 10, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(cancellable, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then a cancelled error is returned with the number of rows sent", func() {
+				So(err, ShouldResemble, &observation.CancelledError{RowsWritten: 1, Err: context.Canceled})
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+				So(memory.Messages(), ShouldHaveLength, 1)
+			})
+
+			Convey("And the rows sent are saved as a checkpoint", func() {
+				cp, err := checkpoints.Get(ctx, expectedInstanceID)
+				So(err, ShouldBeNil)
+				So(*cp, ShouldResemble, checkpoint.Checkpoint{RowIndex: 1, RowsWritten: 1, BytesWritten: 15})
+				So(checkpoints.Deleted, ShouldBeEmpty)
+			})
+
+			Convey("And no extraction complete event is sent", func() {
+				So(mockCompleteProducer.Channels().Output, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a context that has already been cancelled", t, func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(memory, nil, nil, 0, 1, 0, nil)
+
+		Convey("When write all is called", func() {
+			err := observationMessageWriter.WriteAll(cancelled, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then no rows are sent and a cancelled error is returned", func() {
+				So(err, ShouldResemble, &observation.CancelledError{RowsWritten: 0, Err: context.Canceled})
+				So(memory.Messages(), ShouldBeEmpty)
+			})
+		})
+	})
+	Convey("Given an extraction complete producer that never takes the event", t, func() {
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		memory := sink.NewMemory()
+		reader, err := observation.NewCSVReader(strings.NewReader(input), observation.BadRowPolicyFail)
+		So(err, ShouldBeNil)
+		observationMessageWriter := observation.NewMessageWriter(memory, kafkatest.NewMessageProducer(true), nil, 0, 1, 0, nil)
+
+		Convey("When write all is called and the context is done while sending the event", func() {
+			err := observationMessageWriter.WriteAll(timeout, reader, observation.Extraction{InstanceID: expectedInstanceID})
+
+			Convey("Then the rows are sent and the context's error is returned rather than blocking", func() {
+				So(memory.Messages(), ShouldHaveLength, 3)
+				So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
 			})
 		})
 	})
@@ -73,3 +646,61 @@ func Unmarshal(bytes []byte) *observation.ExtractedEvent {
 	So(err, ShouldBeNil)
 	return event
 }
+
+// unmarshalBatches converts observation extracted batch event messages into events.
+func unmarshalBatches(messages [][]byte) []observation.ExtractedBatchEvent {
+	batches := make([]observation.ExtractedBatchEvent, 0, len(messages))
+	for _, message := range messages {
+		batch, err := observation.UnmarshalBatch(message)
+		So(err, ShouldBeNil)
+		batches = append(batches, *batch)
+	}
+	return batches
+}
+
+// unmarshalComplete converts extraction complete event bytes into an event instance.
+func unmarshalComplete(bytes []byte) *observation.ExtractionCompleteEvent {
+	event, err := observation.UnmarshalExtractionComplete(bytes)
+	So(err, ShouldBeNil)
+	return event
+}
+
+// newSaramaConfig returns a config for mock sarama producers that return successes.
+func newSaramaConfig() *sarama.Config {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	return config
+}
+
+// newBufferedMessageProducer returns a mock producer with a buffered output channel, so that writes do not block.
+func newBufferedMessageProducer() *kafkatest.MessageProducer {
+	pChannels := kafka.CreateProducerChannels()
+	pChannels.Output = make(chan []byte, 10)
+	return kafkatest.NewMessageProducerWithChannels(pChannels, true)
+}
+
+// failingSink is a sink that fails every write with the given error.
+type failingSink struct {
+	err error
+}
+
+func (sink failingSink) Write(ctx context.Context, message []byte) error {
+	return sink.err
+}
+
+// cancellingSink is a sink that writes the given number of messages to memory, and then cancels the context and
+// fails with its error.
+type cancellingSink struct {
+	memory *sink.Memory
+	cancel context.CancelFunc
+	after  int
+}
+
+func (sink *cancellingSink) Write(ctx context.Context, message []byte) error {
+	if sink.after == 0 {
+		sink.cancel()
+		return ctx.Err()
+	}
+	sink.after--
+	return sink.memory.Write(ctx, message)
+}
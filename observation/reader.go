@@ -4,3 +4,16 @@ package observation
 type Reader interface {
 	Read() (*Observation, error)
 }
+
+// ResumableReader is a Reader that can skip observations which have already been extracted.
+type ResumableReader interface {
+	Reader
+	ResumeAfter(rowIndex int64)
+}
+
+// BadRowReader is a Reader that keeps track of the rows that did not have the number of columns defined by the header.
+type BadRowReader interface {
+	Reader
+	BadRowCount() int64
+	BadRowIndexes() []int64
+}
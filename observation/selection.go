@@ -0,0 +1,56 @@
+package observation
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Selection chooses which rows of a file are extracted, for debugging and smoke tests. Rows are chosen by their row
+// index, where the first row after the header is 1, so the observations extracted keep their original row indexes.
+// The zero value selects every row.
+type Selection struct {
+	// FirstRow is the index of the first row to extract, or zero to start from the first row.
+	FirstRow int64 `json:"first_row,omitempty"`
+	// LastRow is the index of the last row to extract, or zero to extract to the end of the file.
+	LastRow int64 `json:"last_row,omitempty"`
+	// Limit is the most rows to extract, or zero for no limit. It is applied after the row range and sample.
+	Limit int64 `json:"limit,omitempty"`
+	// SampleEvery extracts one row in every SampleEvery rows, starting from the first row extracted, if greater
+	// than one.
+	SampleEvery int64 `json:"sample_every,omitempty"`
+}
+
+// ErrInvalidSelection is wrapped by the error returned when a selection is not valid.
+var ErrInvalidSelection = errors.New("invalid row selection")
+
+// Validate returns an error wrapping ErrInvalidSelection if any of the selection's values are negative, or its last
+// row comes before its first row.
+func (selection Selection) Validate() error {
+	if selection.FirstRow < 0 || selection.LastRow < 0 || selection.Limit < 0 || selection.SampleEvery < 0 {
+		return fmt.Errorf("%w: values must not be negative", ErrInvalidSelection)
+	}
+	if selection.LastRow != 0 && selection.LastRow < selection.FirstRow {
+		return fmt.Errorf("%w: last row %d is before first row %d", ErrInvalidSelection, selection.LastRow, selection.FirstRow)
+	}
+	return nil
+}
+
+// IsZero returns true if the selection selects every row.
+func (selection Selection) IsZero() bool {
+	return selection == Selection{}
+}
+
+// selects returns true if the row with the given index is in the row range and sample, ignoring the limit.
+func (selection Selection) selects(rowIndex int64) bool {
+	firstRow := max(selection.FirstRow, 1)
+	if rowIndex < firstRow {
+		return false
+	}
+	return selection.SampleEvery <= 1 || (rowIndex-firstRow)%selection.SampleEvery == 0
+}
+
+// isPast returns true if no row after the one with the given index can be selected, given the number of rows that
+// have already been selected.
+func (selection Selection) isPast(rowIndex, selected int64) bool {
+	return (selection.LastRow != 0 && rowIndex > selection.LastRow) || (selection.Limit != 0 && selected >= selection.Limit)
+}
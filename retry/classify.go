@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	vault "github.com/ONSdigital/dp-vault"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// permanentErrorCodes are S3 error codes that will not succeed however many times the request is retried.
+var permanentErrorCodes = map[string]bool{
+	"AccessDenied":       true,
+	"InvalidBucketName":  true,
+	"InvalidObjectState": true,
+	"NoSuchBucket":       true,
+	"NoSuchKey":          true,
+	"NotFound":           true,
+}
+
+// retryableErrorCodes are S3 error codes for server side failures, in addition to the throttling and timeout codes
+// recognised by the AWS SDK.
+var retryableErrorCodes = map[string]bool{
+	"InternalError":      true,
+	"ServiceUnavailable": true,
+}
+
+// IsRetryable returns true if the given error from S3 or Vault is transient, such as throttling, a 5xx response,
+// a timeout or a dropped connection, and so the request may succeed if it is made again. Errors that are not
+// recognised as transient are treated as permanent.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || isPermanent(err) {
+		return false
+	}
+
+	if awsretry.IsErrorRetryables(awsretry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary ||
+		awsretry.IsErrorTimeouts(awsretry.DefaultTimeouts).IsErrorTimeout(err) == aws.TrueTernary {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && retryableErrorCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	var responseErr *vaultapi.ResponseError
+	if errors.As(err, &responseErr) {
+		return isRetryableStatus(responseErr.StatusCode)
+	}
+
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.HTTPStatusCode())
+	}
+
+	// Other network errors, such as failing to resolve a host or a TLS handshake being rejected, are not transient.
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// httpStatusError is implemented by errors for unsuccessful HTTP responses.
+type httpStatusError interface {
+	HTTPStatusCode() int
+}
+
+// isRetryableStatus returns true for HTTP status codes of responses to requests that may succeed if made again.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// isPermanent returns true for errors that are known to fail on every attempt.
+func isPermanent(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && permanentErrorCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	var changedErr *ChangedError
+	if errors.As(err, &changedErr) {
+		return true
+	}
+
+	var invalidByte hex.InvalidByteError
+	return errors.As(err, &invalidByte) || errors.Is(err, hex.ErrLength) || errors.Is(err, vault.ErrKeyNotFound)
+}
@@ -0,0 +1,74 @@
+package retry_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	vault "github.com/ONSdigital/dp-vault"
+	"github.com/aws/smithy-go"
+	vaultapi "github.com/hashicorp/vault/api"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIsRetryable(t *testing.T) {
+	_, hexErr := hex.DecodeString("not-hex")
+
+	Convey("Given errors from S3 and Vault", t, func() {
+		cases := []struct {
+			err       error
+			retryable bool
+		}{
+			{nil, false},
+			{&smithy.GenericAPIError{Code: "SlowDown"}, true},
+			{&smithy.GenericAPIError{Code: "InternalError"}, true},
+			{&smithy.GenericAPIError{Code: "RequestTimeout"}, true},
+			{&smithy.GenericAPIError{Code: "NoSuchKey"}, false},
+			{&smithy.GenericAPIError{Code: "AccessDenied"}, false},
+			{fmt.Errorf("error getting object from s3: %w", &smithy.GenericAPIError{Code: "NoSuchKey"}), false},
+			{&vaultapi.ResponseError{StatusCode: http.StatusServiceUnavailable}, true},
+			{&vaultapi.ResponseError{StatusCode: http.StatusTooManyRequests}, true},
+			{&vaultapi.ResponseError{StatusCode: http.StatusForbidden}, false},
+			{&statusError{http.StatusBadGateway}, true},
+			{&statusError{http.StatusNotFound}, false},
+			{vault.ErrKeyNotFound, false},
+			{hexErr, false},
+			{io.ErrUnexpectedEOF, true},
+			{context.DeadlineExceeded, true},
+			{context.Canceled, false},
+			{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+			{&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+			{&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "bucket.invalid", IsNotFound: true}}, false},
+			{&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}, false},
+			{&retry.ChangedError{Version: "v1", Err: errors.New("precondition failed")}, false},
+			{errors.New("unknown error"), false},
+		}
+
+		Convey("Then transient errors are retryable and all others are permanent", func() {
+			for _, c := range cases {
+				So(retry.IsRetryable(c.err), ShouldEqual, c.retryable)
+			}
+		})
+	})
+}
+
+// statusError is an error for an unsuccessful HTTP response.
+type statusError struct {
+	statusCode int
+}
+
+func (err *statusError) Error() string {
+	return http.StatusText(err.statusCode)
+}
+
+func (err *statusError) HTTPStatusCode() int {
+	return err.statusCode
+}
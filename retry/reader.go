@@ -0,0 +1,146 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Opener opens a stream of data from the start, such as an object in S3, returning the version of the data opened,
+// such as its ETag, if it has one. When version is not empty the stream is being reopened, and should only be opened
+// if it is still that version, returning a ChangedError otherwise.
+type Opener func(ctx context.Context, version string) (body io.ReadCloser, openedVersion string, err error)
+
+// ChangedError is returned when a stream is reopened after a failed read but is no longer the version that was
+// first opened, so reading cannot carry on from where it failed.
+type ChangedError struct {
+	Version string
+	Err     error
+}
+
+func (err *ChangedError) Error() string {
+	return fmt.Sprintf("stream changed since version %s was opened: %v", err.Version, err.Err)
+}
+
+func (err *ChangedError) Unwrap() error {
+	return err.Err
+}
+
+// Permanent returns true, as reopening the stream again will not bring back the version that was first read.
+func (err *ChangedError) Permanent() bool {
+	return true
+}
+
+// Reader reads a stream that is reopened if a read fails with a retryable error part of the way through. The stream
+// is read again from the start, discarding the bytes already returned, as encrypted objects cannot be fetched by range.
+// It is only read again if it is the same version as when it was first opened.
+type Reader struct {
+	ctx         context.Context
+	policy      Policy
+	isRetryable func(error) bool
+	open        Opener
+	body        io.ReadCloser
+	version     string
+	offset      int64
+	reopens     int
+}
+
+// NewReader opens the stream using the given Opener, retrying according to the policy if opening fails.
+func NewReader(ctx context.Context, policy Policy, isRetryable func(error) bool, open Opener) (*Reader, error) {
+	reader := &Reader{
+		ctx:         ctx,
+		policy:      policy,
+		isRetryable: isRetryable,
+		open:        open,
+	}
+
+	err := Do(ctx, policy, isRetryable, func() (err error) {
+		reader.body, reader.version, err = open(ctx, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// Read reads from the stream, reopening it if a read fails with a retryable error. The stream may be reopened up to
+// one less than the maximum number of attempts in a row before any further data is read.
+func (reader *Reader) Read(p []byte) (int, error) {
+	for {
+		n, err := reader.body.Read(p)
+		reader.offset += int64(n)
+		if n > 0 {
+			reader.reopens = 0
+		}
+
+		if err == nil || err == io.EOF || !reader.isRetryable(err) {
+			return n, err
+		}
+
+		if reopenErr := reader.reopen(err); reopenErr != nil {
+			return n, reopenErr
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// reopen closes the stream that failed with the given cause, then opens it again and skips to the current offset. A
+// ChangedError is returned if the stream is no longer the version that was first opened, in case the opener could not
+// make opening it conditional on the version.
+func (reader *Reader) reopen(cause error) error {
+	reader.reopens++
+	if reader.reopens >= reader.policy.MaxAttempts {
+		return cause
+	}
+
+	reader.body.Close()
+
+	delay := reader.policy.Delay(reader.reopens)
+	log.Warn(reader.ctx, "reopening stream after transient read error", log.FormatErrors([]error{cause}), log.Data{
+		"offset": reader.offset,
+		"delay":  delay.String(),
+	})
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-timer.C:
+	case <-reader.ctx.Done():
+		timer.Stop()
+		return interrupted(reader.ctx, cause)
+	}
+
+	return Do(reader.ctx, reader.policy, reader.isRetryable, func() error {
+		body, version, err := reader.open(reader.ctx, reader.version)
+		if err != nil {
+			return err
+		}
+		if version != reader.version {
+			body.Close()
+			return &ChangedError{Version: reader.version, Err: fmt.Errorf("version %s opened instead", version)}
+		}
+
+		if _, err = io.CopyN(io.Discard, body, reader.offset); err != nil {
+			body.Close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		reader.body = body
+		return nil
+	})
+}
+
+// Close closes the underlying stream.
+func (reader *Reader) Close() error {
+	return reader.body.Close()
+}
@@ -0,0 +1,138 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const content = "the quick brown fox jumps over the lazy dog"
+
+// failingReader returns an error once it has read the given number of bytes.
+type failingReader struct {
+	io.Reader
+	remaining int
+	err       error
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	if reader.remaining == 0 {
+		return 0, reader.err
+	}
+	if len(p) > reader.remaining {
+		p = p[:reader.remaining]
+	}
+	n, err := reader.Reader.Read(p)
+	reader.remaining -= n
+	return n, err
+}
+
+func TestReader(t *testing.T) {
+	policy := retry.Policy{MaxAttempts: 3}
+
+	Convey("Given a stream that fails with a transient error part of the way through the first time it is read", t, func() {
+		var versions []string
+		open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+			versions = append(versions, version)
+			if len(versions) == 1 {
+				return io.NopCloser(&failingReader{Reader: strings.NewReader(content), remaining: 10, err: errTransient}), "v1", nil
+			}
+			return io.NopCloser(strings.NewReader(content)), "v1", nil
+		}
+
+		Convey("When the stream is read", func() {
+			reader, err := retry.NewReader(ctx, policy, isTransient, open)
+			So(err, ShouldBeNil)
+			b, err := io.ReadAll(reader)
+
+			Convey("Then the stream is reopened and read to the end without repeating any bytes", func() {
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, content)
+				So(versions, ShouldResemble, []string{"", "v1"})
+			})
+		})
+	})
+
+	Convey("Given a stream that changes after failing with a transient error part of the way through", t, func() {
+		opens := 0
+		open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+			opens++
+			if opens == 1 {
+				return io.NopCloser(&failingReader{Reader: strings.NewReader(content), remaining: 10, err: errTransient}), "v1", nil
+			}
+			return io.NopCloser(strings.NewReader(content)), "v2", nil
+		}
+
+		Convey("When the stream is read", func() {
+			reader, err := retry.NewReader(ctx, policy, isTransient, open)
+			So(err, ShouldBeNil)
+			_, err = io.ReadAll(reader)
+
+			Convey("Then a permanent ChangedError is returned without reading the new version", func() {
+				var changedErr *retry.ChangedError
+				So(errors.As(err, &changedErr), ShouldBeTrue)
+				So(changedErr.Version, ShouldEqual, "v1")
+				So(changedErr.Permanent(), ShouldBeTrue)
+				So(opens, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a stream that always fails with a transient error part of the way through", t, func() {
+		opens := 0
+		open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+			opens++
+			return io.NopCloser(&failingReader{Reader: strings.NewReader(content), remaining: 10, err: errTransient}), "", nil
+		}
+
+		Convey("When the stream is read", func() {
+			reader, err := retry.NewReader(ctx, policy, isTransient, open)
+			So(err, ShouldBeNil)
+			_, err = io.ReadAll(reader)
+
+			Convey("Then the error is returned once the stream has been opened the maximum number of times", func() {
+				So(err, ShouldEqual, errTransient)
+				So(opens, ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given a stream that fails with a permanent error", t, func() {
+		opens := 0
+		open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+			opens++
+			return io.NopCloser(&failingReader{Reader: strings.NewReader(content), remaining: 10, err: errPermanent}), "", nil
+		}
+
+		Convey("When the stream is read", func() {
+			reader, err := retry.NewReader(ctx, policy, isTransient, open)
+			So(err, ShouldBeNil)
+			_, err = io.ReadAll(reader)
+
+			Convey("Then the error is returned without reopening the stream", func() {
+				So(err, ShouldEqual, errPermanent)
+				So(opens, ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a stream that cannot be opened", t, func() {
+		open := func(ctx context.Context, version string) (io.ReadCloser, string, error) {
+			return nil, "", errPermanent
+		}
+
+		Convey("When a reader is created", func() {
+			reader, err := retry.NewReader(ctx, policy, isTransient, open)
+
+			Convey("Then the error is returned", func() {
+				So(err, ShouldEqual, errPermanent)
+				So(reader, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Policy describes how many times an operation is attempted and how long to wait between attempts. The delay
+// doubles after each failed attempt, starting at BaseDelay and capped at MaxDelay. Jitter is the fraction of each
+// delay, between 0 and 1, that is randomised so that retries from many instances are spread out.
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// Delay returns the time to wait after the given failed attempt, where the first attempt is 1.
+func (policy Policy) Delay(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	if policy.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * policy.Jitter
+		delay = time.Duration(float64(delay) - spread + 2*spread*rand.Float64())
+	}
+	return delay
+}
+
+// Do calls op until it succeeds, returns an error that isRetryable does not accept, or the maximum number of attempts
+// has been made. The error from the last attempt is returned. Waiting between attempts stops early if ctx is done, in
+// which case the error returned wraps both the context's error and the error from the last attempt.
+func Do(ctx context.Context, policy Policy, isRetryable func(error) bool, op func() error) error {
+	attempt := 0
+	for {
+		attempt++
+		err := op()
+		if err == nil || attempt >= policy.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		delay := policy.Delay(attempt)
+		log.Warn(ctx, "retrying after transient error", log.FormatErrors([]error{err}), log.Data{"attempt": attempt, "delay": delay.String()})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return interrupted(ctx, err)
+		}
+	}
+}
+
+// interrupted returns the error for an operation that failed with err, and whose wait to be retried was interrupted
+// by ctx being done. Both errors are wrapped, so that the operation is recognised as cancelled rather than failed.
+func interrupted(ctx context.Context, err error) error {
+	return fmt.Errorf("%w while waiting to retry after error: %w", ctx.Err(), err)
+}
@@ -0,0 +1,124 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	ctx          = context.Background()
+	errTransient = errors.New("transient error")
+	errPermanent = errors.New("permanent error")
+)
+
+func isTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	Convey("Given a policy without jitter", t, func() {
+		policy := retry.Policy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+		Convey("Then the delay doubles after each attempt until it reaches the maximum delay", func() {
+			So(policy.Delay(1), ShouldEqual, 100*time.Millisecond)
+			So(policy.Delay(2), ShouldEqual, 200*time.Millisecond)
+			So(policy.Delay(3), ShouldEqual, 400*time.Millisecond)
+			So(policy.Delay(4), ShouldEqual, 800*time.Millisecond)
+			So(policy.Delay(5), ShouldEqual, time.Second)
+			So(policy.Delay(50), ShouldEqual, time.Second)
+		})
+	})
+
+	Convey("Given a policy with jitter", t, func() {
+		policy := retry.Policy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+
+		Convey("Then the delay is within the jitter fraction of the exponential delay", func() {
+			for i := 0; i < 100; i++ {
+				So(policy.Delay(2), ShouldBeBetweenOrEqual, 100*time.Millisecond, 300*time.Millisecond)
+			}
+		})
+	})
+}
+
+func TestDo(t *testing.T) {
+	policy := retry.Policy{MaxAttempts: 3}
+
+	Convey("Given an operation that fails with a transient error and then succeeds", t, func() {
+		calls := 0
+		op := func() error {
+			calls++
+			if calls == 1 {
+				return errTransient
+			}
+			return nil
+		}
+
+		Convey("When Do is called", func() {
+			err := retry.Do(ctx, policy, isTransient, op)
+
+			Convey("Then the operation is retried and no error is returned", func() {
+				So(err, ShouldBeNil)
+				So(calls, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given an operation that always fails with a transient error", t, func() {
+		calls := 0
+		op := func() error {
+			calls++
+			return errTransient
+		}
+
+		Convey("When Do is called", func() {
+			err := retry.Do(ctx, policy, isTransient, op)
+
+			Convey("Then the error is returned after the maximum number of attempts", func() {
+				So(err, ShouldEqual, errTransient)
+				So(calls, ShouldEqual, 3)
+			})
+		})
+	})
+
+	Convey("Given an operation that fails with a permanent error", t, func() {
+		calls := 0
+		op := func() error {
+			calls++
+			return errPermanent
+		}
+
+		Convey("When Do is called", func() {
+			err := retry.Do(ctx, policy, isTransient, op)
+
+			Convey("Then the error is returned without retrying", func() {
+				So(err, ShouldEqual, errPermanent)
+				So(calls, ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a cancelled context and a long delay between attempts", t, func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		calls := 0
+		op := func() error {
+			calls++
+			return errTransient
+		}
+
+		Convey("When Do is called", func() {
+			err := retry.Do(cancelled, retry.Policy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}, isTransient, op)
+
+			Convey("Then an error wrapping both the context's error and the last error is returned without waiting to retry", func() {
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+				So(errors.Is(err, errTransient), ShouldBeTrue)
+				So(calls, ShouldEqual, 1)
+			})
+		})
+	})
+}
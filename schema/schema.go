@@ -4,7 +4,7 @@ import (
 	"github.com/ONSdigital/go-ns/avro"
 )
 
-var dimensionsInsertedEvent = `{
+var dimensionsInsertedEventV1 = `{
   "type": "record",
   "name": "dimensions-inserted",
   "namespace": "",
@@ -14,11 +14,44 @@ var dimensionsInsertedEvent = `{
   ]
 }`
 
-// DimensionsInsertedEvent the Avro schema for dimensionsInsertedEvent messages.
-var DimensionsInsertedEvent = &avro.Schema{
-	Definition: dimensionsInsertedEvent,
+var dimensionsInsertedEventV2 = `{
+  "type": "record",
+  "name": "dimensions-inserted",
+  "namespace": "",
+  "fields": [
+    {"name": "file_url", "type": "string"},
+    {"name": "instance_id", "type": "string"},
+    {"name": "job_id", "type": ["null", "string"], "default": null},
+    {"name": "dataset_id", "type": ["null", "string"], "default": null},
+    {"name": "edition", "type": ["null", "string"], "default": null},
+    {"name": "version", "type": ["null", "string"], "default": null},
+    {"name": "trace_id", "type": ["null", "string"], "default": null},
+    {"name": "extraction_options", "type": ["null", {
+      "type": "record",
+      "name": "extraction-options",
+      "fields": [
+        {"name": "first_row", "type": "long", "default": 0},
+        {"name": "last_row", "type": "long", "default": 0},
+        {"name": "limit", "type": "long", "default": 0},
+        {"name": "sample_every", "type": "long", "default": 0}
+      ]
+    }], "default": null}
+  ]
+}`
+
+// DimensionsInsertedEventVersions are the versions of the Avro schema for dimensionsInsertedEvent messages. Version 2
+// added the optional job, dataset and trace fields and the extraction options.
+var DimensionsInsertedEventVersions = &VersionedSchema{
+	Versions: []*avro.Schema{
+		{Definition: dimensionsInsertedEventV1},
+		{Definition: dimensionsInsertedEventV2},
+	},
 }
 
+// DimensionsInsertedEvent the latest Avro schema for dimensionsInsertedEvent messages. Messages should be read with
+// DimensionsInsertedEventVersions, so that those written with older versions can be read.
+var DimensionsInsertedEvent = DimensionsInsertedEventVersions.Latest()
+
 var observationExtractedEvent = `{
   "type": "record",
   "name": "observation-extracted",
@@ -33,3 +66,54 @@ var observationExtractedEvent = `{
 var ObservationExtractedEvent = &avro.Schema{
 	Definition: observationExtractedEvent,
 }
+
+var observationExtractedBatchEvent = `{
+  "type": "record",
+  "name": "observation-extracted-batch",
+  "fields": [
+    {"name": "instance_id", "type": "string"},
+    {"name": "row_index", "type": "long"},
+    {"name": "rows", "type": {"type": "array", "items": "string"}}
+  ]
+}`
+
+// ObservationExtractedBatchEvent is the Avro schema for a batch of consecutive observations extracted. The row_index
+// is the index of the first row in the batch.
+var ObservationExtractedBatchEvent = &avro.Schema{
+	Definition: observationExtractedBatchEvent,
+}
+
+var extractionCompleteEventV1 = `{
+  "type": "record",
+  "name": "observations-extraction-complete",
+  "fields": [
+    {"name": "instance_id", "type": "string"},
+    {"name": "row_count", "type": "long"},
+    {"name": "byte_count", "type": "long"},
+    {"name": "duration_ms", "type": "long"},
+    {"name": "status", "type": "string"}
+  ]
+}`
+
+var extractionCompleteEventV2 = `{
+  "type": "record",
+  "name": "observations-extraction-complete",
+  "fields": [
+    {"name": "instance_id", "type": "string"},
+    {"name": "row_count", "type": "long"},
+    {"name": "byte_count", "type": "long"},
+    {"name": "duration_ms", "type": "long"},
+    {"name": "status", "type": "string"},
+    {"name": "bad_row_count", "type": "long", "default": 0},
+    {"name": "bad_row_indexes", "type": {"type": "array", "items": "long"}, "default": []}
+  ]
+}`
+
+// ExtractionCompleteEventVersions are the versions of the Avro schema for the event sent once extraction for an
+// instance has finished. Version 2 added the number of bad rows and the indexes of the first of them.
+var ExtractionCompleteEventVersions = &VersionedSchema{
+	Versions: []*avro.Schema{
+		{Definition: extractionCompleteEventV1},
+		{Definition: extractionCompleteEventV2},
+	},
+}
@@ -0,0 +1,258 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ONSdigital/go-ns/avro"
+	goavro "github.com/go-avro/avro"
+)
+
+// ErrNoMatchingVersion is returned when a message cannot be read with any version of a schema.
+var ErrNoMatchingVersion = errors.New("message does not match any version of the schema")
+
+// Record is a decoded Avro record, mapping field names to values. Nested records are also Records, null values are
+// nil, and longs are int64.
+type Record map[string]interface{}
+
+// VersionedSchema is an Avro schema that has evolved over time. Each version only adds fields with defaults to the end
+// of the previous version, so that messages written with any version can be read by readers of any other version.
+type VersionedSchema struct {
+	// Versions of the schema, oldest first. Version 1 is the first.
+	Versions []*avro.Schema
+}
+
+// Latest returns the newest version of the schema.
+func (schema *VersionedSchema) Latest() *avro.Schema {
+	return schema.Versions[len(schema.Versions)-1]
+}
+
+// Version returns the given version of the schema, where version 1 is the first.
+func (schema *VersionedSchema) Version(version int) (*avro.Schema, error) {
+	if version < 1 || version > len(schema.Versions) {
+		return nil, fmt.Errorf("schema has no version %d", version)
+	}
+	return schema.Versions[version-1], nil
+}
+
+// Decode reads a message written with any version of the schema, resolving it against the latest version. The
+// version the message was written with is found by reading it with each version, newest first, until one reads the
+// whole message. This relies on each version adding fields to the end of the previous one, so that it needs more
+// bytes. The writer's version is returned with the record.
+func (schema *VersionedSchema) Decode(message []byte) (Record, int, error) {
+	for version := len(schema.Versions); version > 0; version-- {
+		record, err := Resolve(schema.Versions[version-1], schema.Latest(), message)
+		if err == nil {
+			return record, version, nil
+		}
+	}
+	return nil, 0, ErrNoMatchingVersion
+}
+
+// Encode writes the record with the latest version of the schema. Fields missing from the record are written with
+// their default values.
+func (schema *VersionedSchema) Encode(record Record) ([]byte, error) {
+	avroSchema, err := goavro.ParseSchema(schema.Latest().Definition)
+	if err != nil {
+		return nil, err
+	}
+
+	genericRecord, err := toGenericRecord(record, avroSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := goavro.NewGenericDatumWriter()
+	writer.SetSchema(avroSchema)
+
+	buffer := new(bytes.Buffer)
+	if err = writer.Write(genericRecord, goavro.NewBinaryEncoder(buffer)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Resolve reads a message written with the writer schema as a record of the reader schema, following Avro's schema
+// resolution rules for records: fields are matched by name, writer fields that the reader does not have are ignored,
+// and reader fields that the writer does not have are given their default values. An error is returned if the message
+// is not exactly one record of the writer schema.
+func Resolve(writer, reader *avro.Schema, message []byte) (Record, error) {
+	writerSchema, err := goavro.ParseSchema(writer.Definition)
+	if err != nil {
+		return nil, err
+	}
+	readerSchema, err := goavro.ParseSchema(reader.Definition)
+	if err != nil {
+		return nil, err
+	}
+
+	datumReader := goavro.NewGenericDatumReader()
+	datumReader.SetSchema(writerSchema)
+
+	remaining := bytes.NewReader(message)
+	decoded := goavro.NewGenericRecord(writerSchema)
+	if err = datumReader.Read(decoded, goavro.NewBinaryDecoderReader(remaining)); err != nil {
+		return nil, err
+	}
+	if remaining.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes left after reading message", remaining.Len())
+	}
+
+	return resolveRecord(decoded, readerSchema)
+}
+
+// resolveRecord returns the fields of the reader schema from the decoded record, using defaults for any it lacks.
+func resolveRecord(decoded *goavro.GenericRecord, reader goavro.Schema) (Record, error) {
+	recordSchema, ok := reader.(*goavro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("reader schema %s is not a record", reader.GetName())
+	}
+
+	written := make(map[string]interface{})
+	if writerSchema, ok := decoded.Schema().(*goavro.RecordSchema); ok {
+		for _, field := range writerSchema.Fields {
+			written[field.Name] = decoded.Get(field.Name)
+		}
+	}
+
+	record := make(Record, len(recordSchema.Fields))
+	for _, field := range recordSchema.Fields {
+		value, ok := written[field.Name]
+		if !ok {
+			var err error
+			if value, err = defaultValue(field.Default, field.Type); err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			record[field.Name] = value
+			continue
+		}
+
+		value, err := resolveValue(value, field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		record[field.Name] = value
+	}
+	return record, nil
+}
+
+// resolveValue returns a decoded value as a value of the reader schema, resolving any nested records.
+func resolveValue(value interface{}, reader goavro.Schema) (interface{}, error) {
+	nested, ok := value.(*goavro.GenericRecord)
+	if !ok {
+		return value, nil
+	}
+	if recordSchema := findRecordSchema(reader); recordSchema != nil {
+		return resolveRecord(nested, recordSchema)
+	}
+	return nil, fmt.Errorf("record cannot be read as %s", reader.GetName())
+}
+
+// defaultValue converts the JSON default of a field to a value of the field's schema. The default of a union is a
+// value of its first type.
+func defaultValue(value interface{}, fieldSchema goavro.Schema) (interface{}, error) {
+	if union, ok := fieldSchema.(*goavro.UnionSchema); ok {
+		return defaultValue(value, union.Types[0])
+	}
+
+	switch fieldSchema.Type() {
+	case goavro.Null:
+		return nil, nil
+	case goavro.Long, goavro.Int:
+		// go-avro converts the defaults of fields to the field's type, but those inside record defaults are float64
+		var number int64
+		switch typed := value.(type) {
+		case int64:
+			number = typed
+		case int32:
+			number = int64(typed)
+		case float64:
+			number = int64(typed)
+		default:
+			return nil, errors.New("missing numeric default")
+		}
+		if fieldSchema.Type() == goavro.Int {
+			return int32(number), nil
+		}
+		return number, nil
+	case goavro.String, goavro.Boolean:
+		if value == nil {
+			return nil, errors.New("missing default")
+		}
+		return value, nil
+	case goavro.Array:
+		items, ok := value.([]interface{})
+		if !ok || len(items) != 0 {
+			return nil, errors.New("only empty array defaults are supported")
+		}
+		return items, nil
+	case goavro.Record:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing record default")
+		}
+		record := make(Record, len(fields))
+		for _, field := range fieldSchema.(*goavro.RecordSchema).Fields {
+			fieldValue, ok := fields[field.Name]
+			if !ok {
+				fieldValue = field.Default
+			}
+			converted, err := defaultValue(fieldValue, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			record[field.Name] = converted
+		}
+		return record, nil
+	default:
+		return nil, fmt.Errorf("defaults of type %s are not supported", fieldSchema.GetName())
+	}
+}
+
+// toGenericRecord converts a record to a go-avro record of the given schema, using defaults for any missing fields.
+func toGenericRecord(record Record, schema goavro.Schema) (*goavro.GenericRecord, error) {
+	recordSchema, ok := schema.(*goavro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("schema %s is not a record", schema.GetName())
+	}
+
+	genericRecord := goavro.NewGenericRecord(recordSchema)
+	for _, field := range recordSchema.Fields {
+		value, ok := record[field.Name]
+		if !ok {
+			var err error
+			if value, err = defaultValue(field.Default, field.Type); err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+
+		if nested, ok := value.(Record); ok {
+			nestedSchema := findRecordSchema(field.Type)
+			if nestedSchema == nil {
+				return nil, fmt.Errorf("field %s is not a record", field.Name)
+			}
+			var err error
+			if value, err = toGenericRecord(nested, nestedSchema); err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		genericRecord.Set(field.Name, value)
+	}
+	return genericRecord, nil
+}
+
+// findRecordSchema returns the schema if it is a record, or the first record in it if it is a union.
+func findRecordSchema(schema goavro.Schema) goavro.Schema {
+	switch typed := schema.(type) {
+	case *goavro.RecordSchema:
+		return typed
+	case *goavro.UnionSchema:
+		for _, unionType := range typed.Types {
+			if unionType.Type() == goavro.Record {
+				return unionType
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package schema_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/ONSdigital/go-ns/avro"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	recordV1 = &avro.Schema{Definition: `{
+  "type": "record",
+  "name": "example",
+  "fields": [
+    {"name": "id", "type": "string"}
+  ]
+}`}
+
+	recordV2 = &avro.Schema{Definition: `{
+  "type": "record",
+  "name": "example",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "label", "type": ["null", "string"], "default": null},
+    {"name": "count", "type": "long", "default": 7},
+    {"name": "options", "type": ["null", {
+      "type": "record",
+      "name": "example-options",
+      "fields": [{"name": "size", "type": "long", "default": 0}]
+    }], "default": null},
+    {"name": "tags", "type": {"type": "array", "items": "long"}, "default": []}
+  ]
+}`}
+)
+
+// exampleV1 is the fields of recordV1, as written by an old producer
+type exampleV1 struct {
+	ID string `avro:"id"`
+}
+
+func TestVersionedSchema(t *testing.T) {
+	versioned := &schema.VersionedSchema{Versions: []*avro.Schema{recordV1, recordV2}}
+
+	Convey("Given a message written with the first version of the schema", t, func() {
+		message, err := recordV1.Marshal(exampleV1{ID: "1234"})
+		So(err, ShouldBeNil)
+
+		Convey("When it is decoded", func() {
+			record, version, err := versioned.Decode(message)
+
+			Convey("Then the fields added in the second version have their defaults", func() {
+				So(err, ShouldBeNil)
+				So(version, ShouldEqual, 1)
+				So(record, ShouldResemble, schema.Record{"id": "1234", "label": nil, "count": int64(7), "options": nil, "tags": []interface{}{}})
+			})
+		})
+	})
+
+	Convey("Given a message written with the latest version of the schema", t, func() {
+		message, err := versioned.Encode(schema.Record{
+			"id":      "1234",
+			"label":   "example",
+			"options": schema.Record{"size": int64(3)},
+			"tags":    []int64{4, 5},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When it is decoded", func() {
+			record, version, err := versioned.Decode(message)
+
+			Convey("Then every field is read, with defaults for those that were not set", func() {
+				So(err, ShouldBeNil)
+				So(version, ShouldEqual, 2)
+				So(record, ShouldResemble, schema.Record{
+					"id":      "1234",
+					"label":   "example",
+					"count":   int64(7),
+					"options": schema.Record{"size": int64(3)},
+					"tags":    []interface{}{int64(4), int64(5)},
+				})
+			})
+		})
+
+		Convey("When it is resolved against the first version, as an old reader would", func() {
+			record, err := schema.Resolve(recordV2, recordV1, message)
+
+			Convey("Then the fields the old reader does not know are ignored", func() {
+				So(err, ShouldBeNil)
+				So(record, ShouldResemble, schema.Record{"id": "1234"})
+			})
+		})
+
+		Convey("When it is resolved as if it was written with the first version", func() {
+			_, err := schema.Resolve(recordV1, recordV2, message)
+
+			Convey("Then an error is returned, as the message is longer than a record of that version", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a message that is not a record of any version", t, func() {
+		message := []byte{0x7f}
+
+		Convey("When it is decoded", func() {
+			_, _, err := versioned.Decode(message)
+
+			Convey("Then ErrNoMatchingVersion is returned", func() {
+				So(errors.Is(err, schema.ErrNoMatchingVersion), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given the versioned schema", t, func() {
+		Convey("Then each version can be got by number", func() {
+			So(versioned.Latest(), ShouldEqual, recordV2)
+			first, err := versioned.Version(1)
+			So(err, ShouldBeNil)
+			So(first, ShouldEqual, recordV1)
+			_, err = versioned.Version(3)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
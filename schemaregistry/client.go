@@ -0,0 +1,187 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+)
+
+// ContentType is the media type of schema registry requests and responses.
+const ContentType = "application/vnd.schemaregistry.v1+json"
+
+// maxResponseBytes limits how much of a response is read, as schemas are small.
+const maxResponseBytes = 1024 * 1024
+
+// HTTPClient is the subset of http.Client used to call the schema registry
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ResponseError is returned when the schema registry responds with an unsuccessful status.
+type ResponseError struct {
+	StatusCode int
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+// Error returns a description of the unsuccessful response.
+func (err *ResponseError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("schema registry responded with status %d", err.StatusCode)
+	}
+	return fmt.Sprintf("schema registry responded with status %d: %s", err.StatusCode, err.Message)
+}
+
+// HTTPStatusCode returns the status code of the unsuccessful response, so that 5xx responses are retried.
+func (err *ResponseError) HTTPStatusCode() int {
+	return err.StatusCode
+}
+
+// schemaRequest is the body of a request to register a schema
+type schemaRequest struct {
+	Schema string `json:"schema"`
+}
+
+// schemaResponse is the body of responses that describe a schema
+type schemaResponse struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+// subjectSchema identifies a schema registered under a subject
+type subjectSchema struct {
+	subject    string
+	definition string
+}
+
+// Client registers and looks up schemas in a schema registry. Schemas never change once registered, so every result
+// is cached and the registry is only called once for each schema.
+type Client struct {
+	url         string
+	httpClient  HTTPClient
+	retryPolicy retry.Policy
+
+	mutex       sync.RWMutex
+	ids         map[subjectSchema]int
+	definitions map[int]string
+}
+
+// NewClient returns a new Client for the schema registry at the given URL. Transient failures are retried according
+// to the given retry.Policy.
+func NewClient(registryURL string, httpClient HTTPClient, retryPolicy retry.Policy) *Client {
+	return &Client{
+		url:         strings.TrimSuffix(registryURL, "/"),
+		httpClient:  httpClient,
+		retryPolicy: retryPolicy,
+		ids:         make(map[subjectSchema]int),
+		definitions: make(map[int]string),
+	}
+}
+
+// Register registers the schema definition under the subject if it is not already, and returns its ID.
+func (client *Client) Register(ctx context.Context, subject, definition string) (int, error) {
+	key := subjectSchema{subject: subject, definition: definition}
+
+	client.mutex.RLock()
+	id, ok := client.ids[key]
+	client.mutex.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(schemaRequest{Schema: definition})
+	if err != nil {
+		return 0, err
+	}
+
+	var response schemaResponse
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err = client.do(ctx, http.MethodPost, path, body, &response); err != nil {
+		return 0, fmt.Errorf("failed to register schema for subject %s: %w", subject, err)
+	}
+
+	client.mutex.Lock()
+	client.ids[key] = response.ID
+	client.definitions[response.ID] = definition
+	client.mutex.Unlock()
+
+	return response.ID, nil
+}
+
+// GetSchema returns the definition of the schema with the given ID.
+func (client *Client) GetSchema(ctx context.Context, id int) (string, error) {
+	client.mutex.RLock()
+	definition, ok := client.definitions[id]
+	client.mutex.RUnlock()
+	if ok {
+		return definition, nil
+	}
+
+	var response schemaResponse
+	if err := client.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &response); err != nil {
+		return "", fmt.Errorf("failed to get schema %d: %w", id, err)
+	}
+
+	client.mutex.Lock()
+	client.definitions[id] = response.Schema
+	client.mutex.Unlock()
+
+	return response.Schema, nil
+}
+
+// Checker reports whether the schema registry can be reached.
+func (client *Client) Checker(ctx context.Context, state *healthcheck.CheckState) error {
+	var subjects []string
+	if err := client.call(ctx, http.MethodGet, "/subjects", nil, &subjects); err != nil {
+		return state.Update(healthcheck.StatusCritical, err.Error(), 0)
+	}
+	return state.Update(healthcheck.StatusOK, "schema registry is reachable", 0)
+}
+
+// do makes a request to the schema registry, retrying transient failures, and decodes the response into result.
+func (client *Client) do(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	return retry.Do(ctx, client.retryPolicy, retry.IsRetryable, func() error {
+		return client.call(ctx, method, path, body, result)
+	})
+}
+
+// call makes a single request to the schema registry and decodes the response into result.
+func (client *Client) call(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, client.url+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", ContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", ContentType)
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	limited := io.LimitReader(resp.Body, maxResponseBytes)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		responseErr := &ResponseError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(limited).Decode(responseErr)
+		return responseErr
+	}
+	return json.NewDecoder(limited).Decode(result)
+}
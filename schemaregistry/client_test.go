@@ -0,0 +1,111 @@
+package schemaregistry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry/schemaregistrytest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const definition = `{"type": "record", "name": "example", "fields": [{"name": "id", "type": "string"}]}`
+
+var (
+	ctx         = context.Background()
+	retryPolicy = retry.Policy{MaxAttempts: 1}
+)
+
+func TestClient_Register(t *testing.T) {
+	Convey("Given a client for a schema registry", t, func() {
+		registry := schemaregistrytest.NewRegistry()
+		defer registry.Close()
+		client := schemaregistry.NewClient(registry.URL+"/", http.DefaultClient, retryPolicy)
+
+		Convey("When a schema is registered twice", func() {
+			first, err := client.Register(ctx, "observation-extracted-value", definition)
+			So(err, ShouldBeNil)
+			second, err := client.Register(ctx, "observation-extracted-value", definition)
+			So(err, ShouldBeNil)
+
+			Convey("Then the same ID is returned, and the registry is only called once", func() {
+				So(first, ShouldEqual, 1)
+				So(second, ShouldEqual, first)
+				So(registry.Requests, ShouldResemble, []string{"POST /subjects/observation-extracted-value/versions"})
+			})
+
+			Convey("And the schema can be got by its ID without calling the registry", func() {
+				got, err := client.GetSchema(ctx, first)
+				So(err, ShouldBeNil)
+				So(got, ShouldEqual, definition)
+				So(registry.RequestCount(), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestClient_GetSchema(t *testing.T) {
+	Convey("Given a schema registered by another producer", t, func() {
+		registry := schemaregistrytest.NewRegistry()
+		defer registry.Close()
+		id := registry.Add("dimensions-inserted-value", definition)
+		client := schemaregistry.NewClient(registry.URL, http.DefaultClient, retryPolicy)
+
+		Convey("When the schema is got by its ID twice", func() {
+			first, err := client.GetSchema(ctx, id)
+			So(err, ShouldBeNil)
+			second, err := client.GetSchema(ctx, id)
+			So(err, ShouldBeNil)
+
+			Convey("Then its definition is returned, and the registry is only called once", func() {
+				So(first, ShouldEqual, definition)
+				So(second, ShouldEqual, definition)
+				So(registry.Requests, ShouldResemble, []string{"GET /schemas/ids/1"})
+			})
+		})
+
+		Convey("When a schema that does not exist is got", func() {
+			_, err := client.GetSchema(ctx, id+1)
+
+			Convey("Then the registry's error is returned", func() {
+				var responseErr *schemaregistry.ResponseError
+				So(errors.As(err, &responseErr), ShouldBeTrue)
+				So(responseErr.StatusCode, ShouldEqual, http.StatusNotFound)
+				So(responseErr.ErrorCode, ShouldEqual, 40403)
+				So(retry.IsRetryable(err), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestClient_Checker(t *testing.T) {
+	Convey("Given a client for a schema registry that is running", t, func() {
+		registry := schemaregistrytest.NewRegistry()
+		client := schemaregistry.NewClient(registry.URL, http.DefaultClient, retryPolicy)
+
+		Convey("When the checker is called", func() {
+			state := healthcheck.NewCheckState("Schema Registry")
+			So(client.Checker(ctx, state), ShouldBeNil)
+
+			Convey("Then the state is OK", func() {
+				So(state.Status(), ShouldEqual, healthcheck.StatusOK)
+			})
+		})
+
+		Convey("When the registry stops and the checker is called", func() {
+			registry.Close()
+			state := healthcheck.NewCheckState("Schema Registry")
+			So(client.Checker(ctx, state), ShouldBeNil)
+
+			Convey("Then the state is critical", func() {
+				So(state.Status(), ShouldEqual, healthcheck.StatusCritical)
+			})
+		})
+
+		Reset(registry.Close)
+	})
+}
@@ -0,0 +1,120 @@
+package schemaregistrytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+)
+
+// Registry is an in-process schema registry, serving the subset of the schema registry API used by
+// schemaregistry.Client. Each request is counted, so that tests can check what was cached.
+type Registry struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	schemas  []string
+	subjects map[string][]int
+	Requests []string
+}
+
+// NewRegistry starts a new in-process schema registry. Close must be called when it is no longer needed.
+func NewRegistry() *Registry {
+	registry := &Registry{subjects: make(map[string][]int)}
+	registry.Server = httptest.NewServer(http.HandlerFunc(registry.serveHTTP))
+	return registry
+}
+
+// Add registers the schema definition under the subject, as another producer would, and returns its ID.
+func (registry *Registry) Add(subject, definition string) int {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return registry.add(subject, definition)
+}
+
+// RequestCount returns the number of requests that have been made to the registry.
+func (registry *Registry) RequestCount() int {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return len(registry.Requests)
+}
+
+// add registers the schema definition under the subject, reusing the ID of an identical schema. The caller must hold
+// the lock.
+func (registry *Registry) add(subject, definition string) int {
+	id := 0
+	for i, existing := range registry.schemas {
+		if existing == definition {
+			id = i + 1
+			break
+		}
+	}
+	if id == 0 {
+		registry.schemas = append(registry.schemas, definition)
+		id = len(registry.schemas)
+	}
+
+	for _, existing := range registry.subjects[subject] {
+		if existing == id {
+			return id
+		}
+	}
+	registry.subjects[subject] = append(registry.subjects[subject], id)
+	return id
+}
+
+// serveHTTP handles requests to register schemas, get schemas by ID and list subjects.
+func (registry *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.Requests = append(registry.Requests, req.Method+" "+req.URL.Path)
+	w.Header().Set("Content-Type", schemaregistry.ContentType)
+
+	path := strings.Trim(req.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case req.Method == http.MethodGet && path == "subjects":
+		subjects := make([]string, 0, len(registry.subjects))
+		for subject := range registry.subjects {
+			subjects = append(subjects, subject)
+		}
+		writeJSON(w, http.StatusOK, subjects)
+
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		var body struct {
+			Schema string `json:"schema"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Schema == "" {
+			writeError(w, http.StatusUnprocessableEntity, 42201, "invalid schema")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"id": registry.add(parts[1], body.Schema)})
+
+	case req.Method == http.MethodGet && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		id, err := strconv.Atoi(parts[2])
+		if err != nil || id < 1 || id > len(registry.schemas) {
+			writeError(w, http.StatusNotFound, 40403, "schema not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"schema": registry.schemas[id-1]})
+
+	default:
+		writeError(w, http.StatusNotFound, 404, "not found")
+	}
+}
+
+// writeError writes an error response in the schema registry's format.
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]interface{}{"error_code": code, "message": message})
+}
+
+// writeJSON writes the body as JSON with the given status.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
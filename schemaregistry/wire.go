@@ -0,0 +1,44 @@
+// Package schemaregistry reads and writes messages in the Confluent Schema Registry wire format, and looks up and
+// registers their Avro schemas in a schema registry.
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// MagicByte is the first byte of every message in the wire format.
+const MagicByte byte = 0
+
+// headerLength is the length of the magic byte and schema ID that start every message in the wire format
+const headerLength = 5
+
+// ErrNotWireFormat is returned when a message is decoded that is not in the wire format.
+var ErrNotWireFormat = errors.New("message is not in the schema registry wire format")
+
+// Header returns the magic byte and schema ID that start each message written with the schema.
+func Header(schemaID int) []byte {
+	header := make([]byte, headerLength)
+	header[0] = MagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(schemaID)) //nolint:gosec // schema IDs are positive 32 bit integers
+	return header
+}
+
+// Encode returns the Avro payload written with the schema in the wire format.
+func Encode(schemaID int, payload []byte) []byte {
+	return append(Header(schemaID), payload...)
+}
+
+// IsWireFormat returns true if the message starts with the magic byte and is long enough to have a schema ID.
+func IsWireFormat(message []byte) bool {
+	return len(message) >= headerLength && message[0] == MagicByte
+}
+
+// Decode returns the ID of the schema the message was written with, and its Avro payload. ErrNotWireFormat is
+// returned if the message is not in the wire format.
+func Decode(message []byte) (schemaID int, payload []byte, err error) {
+	if !IsWireFormat(message) {
+		return 0, nil, ErrNotWireFormat
+	}
+	return int(binary.BigEndian.Uint32(message[1:headerLength])), message[headerLength:], nil
+}
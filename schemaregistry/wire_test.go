@@ -0,0 +1,43 @@
+package schemaregistry_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWireFormat(t *testing.T) {
+	Convey("Given a payload encoded in the wire format", t, func() {
+		message := schemaregistry.Encode(258, []byte("payload"))
+
+		Convey("Then it starts with the magic byte and the big endian schema ID", func() {
+			So(message[:5], ShouldResemble, []byte{0, 0, 0, 1, 2})
+			So(schemaregistry.IsWireFormat(message), ShouldBeTrue)
+		})
+
+		Convey("When it is decoded", func() {
+			schemaID, payload, err := schemaregistry.Decode(message)
+
+			Convey("Then the schema ID and payload are returned", func() {
+				So(err, ShouldBeNil)
+				So(schemaID, ShouldEqual, 258)
+				So(string(payload), ShouldEqual, "payload")
+			})
+		})
+	})
+
+	Convey("Given messages that are not in the wire format", t, func() {
+		messages := [][]byte{nil, {0, 0, 1}, {2, 0, 0, 0, 1, 'x'}}
+
+		Convey("When they are decoded", func() {
+			Convey("Then ErrNotWireFormat is returned", func() {
+				for _, message := range messages {
+					_, _, err := schemaregistry.Decode(message)
+					So(schemaregistry.IsWireFormat(message), ShouldBeFalse)
+					So(err, ShouldEqual, schemaregistry.ErrNotWireFormat)
+				}
+			})
+		})
+	})
+}
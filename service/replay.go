@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/ONSdigital/dp-observation-extractor/config"
+	"github.com/ONSdigital/dp-observation-extractor/deadletter"
+	"github.com/ONSdigital/dp-observation-extractor/initialise"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// ReplayDeadLetters consumes messages from the dead letter topic and sends the original messages back to the file
+// consumer topic, until a signal is received.
+func ReplayDeadLetters(ctx context.Context, config *config.Config, serviceList initialise.ExternalServiceList, signals chan os.Signal) error {
+	// Kafka Dead Letter Consumer
+	kafkaConsumer, err := serviceList.GetDeadLetterConsumer(ctx, &config.KafkaConfig)
+	if err != nil {
+		return err
+	}
+
+	// Kafka Replay Producer, sending to the topic the dead letter messages were originally consumed from
+	kafkaReplayProducer, err := serviceList.GetConfirmedProducer(ctx, &config.KafkaConfig, config.KafkaConfig.FileConsumerTopic, initialise.Replay)
+	if err != nil {
+		return err
+	}
+
+	kafkaConsumer.Channels().LogErrors(ctx, "kafka dead letter consumer error")
+
+	retryPolicy := retry.Policy{
+		BaseDelay: config.RetryBaseDelay,
+		MaxDelay:  config.RetryMaxDelay,
+		Jitter:    config.RetryJitter,
+	}
+	replayer := deadletter.NewReplayer(kafkaReplayProducer, config.KafkaConfig.FileConsumerTopic, retryPolicy)
+	replayer.Consume(ctx, kafkaConsumer)
+
+	log.Info(ctx, "replaying dead letter messages", log.Data{
+		"from": config.KafkaConfig.DeadLetterProducerTopic,
+		"to":   config.KafkaConfig.FileConsumerTopic,
+	})
+
+	// When a signal is received, shutdown gracefully
+	<-signals
+	log.Info(ctx, "os signal received, stopping dead letter replay")
+
+	ctx, cancel := context.WithTimeout(ctx, config.GracefulShutdownTimeout)
+	defer cancel()
+	anyError := false
+
+	if serviceList.DeadLetterConsumer {
+		if err = kafkaConsumer.StopListeningToConsumer(ctx); err != nil {
+			anyError = true
+			log.Error(ctx, "bad kafka dead letter consumer listen stop", err)
+		}
+	}
+
+	if err = replayer.Close(ctx); err != nil {
+		anyError = true
+		log.Error(ctx, "bad dead letter replayer stop", err)
+	}
+
+	if serviceList.DeadLetterConsumer {
+		if err = kafkaConsumer.Close(ctx); err != nil {
+			anyError = true
+			log.Error(ctx, "bad kafka dead letter consumer stop", err)
+		}
+	}
+
+	if serviceList.ReplayProducer {
+		if err = kafkaReplayProducer.Close(); err != nil {
+			anyError = true
+			log.Error(ctx, "bad kafka replay producer stop", err)
+		}
+	}
+
+	if anyError {
+		return errors.New("failed to shutdown dead letter replay gracefully")
+	}
+
+	log.Info(ctx, "dead letter replay stopped")
+	return nil
+}
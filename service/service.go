@@ -4,14 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/ONSdigital/dp-healthcheck/healthcheck"
 	kafka "github.com/ONSdigital/dp-kafka/v2"
+	"github.com/ONSdigital/dp-observation-extractor/admin"
+	"github.com/ONSdigital/dp-observation-extractor/checkpoint"
 	"github.com/ONSdigital/dp-observation-extractor/config"
+	"github.com/ONSdigital/dp-observation-extractor/deadletter"
 	"github.com/ONSdigital/dp-observation-extractor/event"
 	"github.com/ONSdigital/dp-observation-extractor/initialise"
+	"github.com/ONSdigital/dp-observation-extractor/jobs"
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
 	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/retry"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
 	"github.com/ONSdigital/dp-reporter-client/reporter"
 	vault "github.com/ONSdigital/dp-vault"
 	"github.com/ONSdigital/go-ns/server"
@@ -33,8 +43,21 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 		return err
 	}
 
-	// Kafka Observation Producer
-	kafkaObservationProducer, err := serviceList.GetProducer(ctx, &config.KafkaConfig, config.KafkaConfig.ObservationProducerTopic, initialise.Observation)
+	retryPolicy := retry.Policy{
+		MaxAttempts: config.RetryMaxAttempts,
+		BaseDelay:   config.RetryBaseDelay,
+		MaxDelay:    config.RetryMaxDelay,
+		Jitter:      config.RetryJitter,
+	}
+
+	// Schema registry client, if enabled
+	var schemaRegistry *schemaregistry.Client
+	if config.SchemaRegistryURL != "" {
+		schemaRegistry = schemaregistry.NewClient(config.SchemaRegistryURL, http.DefaultClient, retryPolicy)
+	}
+
+	// Sink that observations are written to, with a Kafka Observation Producer if observations are sent to kafka
+	observationSink, observationChecker, err := getObservationSink(ctx, config, &serviceList, schemaRegistry)
 	if err != nil {
 		return err
 	}
@@ -45,7 +68,32 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 		return err
 	}
 
-	observationWriter := observation.NewMessageWriter(kafkaObservationProducer)
+	// Kafka Extraction Complete Producer
+	kafkaCompleteProducer, err := serviceList.GetProducer(ctx, &config.KafkaConfig, config.KafkaConfig.ExtractionCompleteTopic, initialise.ExtractionComplete)
+	if err != nil {
+		return err
+	}
+
+	// Kafka Dead Letter Producer
+	kafkaDeadLetterProducer, err := serviceList.GetConfirmedProducer(ctx, &config.KafkaConfig, config.KafkaConfig.DeadLetterProducerTopic, initialise.DeadLetter)
+	if err != nil {
+		return err
+	}
+
+	// Checkpoint store, if enabled
+	var checkpoints checkpoint.Store
+	if config.CheckpointDir != "" {
+		checkpoints, err = checkpoint.NewFileStore(config.CheckpointDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Registry of the jobs in progress and recently finished, served by the admin api
+	jobRegistry := jobs.NewRegistry(config.JobHistorySize)
+
+	observationWriter := observation.NewMessageWriter(observationSink, kafkaCompleteProducer, checkpoints, config.CheckpointInterval,
+		config.ObservationBatchSize, config.ObservationBatchMaxBytes, jobRegistry)
 
 	// Vault Client
 	var vaultClient event.VaultClient
@@ -56,27 +104,55 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 		}
 	}
 
+	// Event consumer, which can be paused through the admin api
+	deadLetterWriter := deadletter.NewWriter(kafkaDeadLetterProducer, config.KafkaConfig.DeadLetterProducerTopic, config.KafkaConfig.FileConsumerTopic)
+	var schemas event.SchemaRegistry
+	if schemaRegistry != nil {
+		schemas = schemaRegistry
+	}
+	eventRetryPolicy := retryPolicy
+	eventRetryPolicy.MaxAttempts = config.EventMaxAttempts
+	eventConsumer := event.NewConsumer(config.KafkaConfig.NumWorkers, eventRetryPolicy, deadLetterWriter, schemas)
+
+	// S3 client registry, creating clients for buckets not in BUCKET_NAMES that the policy allows
+	bucketPolicy := event.BucketPolicy{Mode: config.BucketPolicy, Buckets: config.BucketPolicyList}
+	if bucketPolicy.Mode == event.BucketAllowList {
+		bucketPolicy.Buckets = append(bucketPolicy.Buckets, config.BucketNames...)
+	}
+	s3Registry := event.NewS3ClientRegistry(s3Clients, bucketPolicy, initialise.NewS3ClientFunc(*awsConfig, config.LocalstackHost))
+
 	// Create healthcheck object with versionInfo
 	hc, err := serviceList.GetHealthChecker(ctx, buildTime, gitCommit, version, config)
 	if err != nil {
 		return err
 	}
 
-	err = registerCheckers(ctx, hc, kafkaConsumer, kafkaObservationProducer, kafkaErrorProducer, vaultClient, s3Clients)
+	err = registerCheckers(ctx, hc, kafkaConsumer, eventConsumer, observationChecker, kafkaErrorProducer, kafkaCompleteProducer, kafkaDeadLetterProducer, vaultClient, schemaRegistry, s3Clients, s3Registry)
 	if err != nil {
 		return err
 	}
 
-	httpServer := startHealthCheck(ctx, hc, config.BindAddr, errorChannel)
+	// URL policy for the files that events refer to
+	urlPolicy, err := getURLPolicy(config)
+	if err != nil {
+		return err
+	}
+
+	// File sources for each enabled file url scheme
+	sources := getFileSources(config.FileSources, event.NewS3Source(s3Registry, vaultClient, config.VaultPath, retryPolicy), urlPolicy, retryPolicy)
+
+	eventHandler := event.NewCSVHandler(sources, urlPolicy, observationWriter, observation.BadRowPolicy(config.BadRowPolicy), jobRegistry)
 
-	eventHandler := event.NewCSVHandler(awsConfig, s3Clients, vaultClient, observationWriter, config.VaultPath)
+	// Extractor for the extractions requested through the admin api
+	extractor := admin.NewExtractor(eventHandler, jobRegistry)
+
+	httpServer := startHealthCheck(ctx, hc, jobRegistry, eventConsumer, extractor, config.AdminAuthToken, config.BindAddr, errorChannel)
 
 	errorReporter, err := reporter.NewImportErrorReporter(kafkaErrorProducer, log.Namespace)
 	if err != nil {
 		return err
 	}
 
-	eventConsumer := event.NewConsumer()
 	eventConsumer.Consume(ctx, kafkaConsumer, eventHandler, errorReporter)
 
 	shutdownGracefully := func() error {
@@ -113,6 +189,14 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 			log.Info(ctx, "event consumer stopped")
 		}
 
+		// Cancel the extractions requested through the admin api
+		if err = extractor.Close(ctx); err != nil {
+			anyError = true
+			log.Error(ctx, "bad extractor stop", err)
+		} else {
+			log.Info(ctx, "extractor stopped")
+		}
+
 		// Close Kafka consumer
 		if serviceList.Consumer {
 			if err = kafkaConsumer.Close(ctx); err != nil {
@@ -133,13 +217,31 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 			}
 		}
 
-		// Close Observation Kafka producer
-		if serviceList.ObservationProducer {
-			if err = kafkaObservationProducer.Close(ctx); err != nil {
+		// Close observation sink, waiting for kafka to acknowledge any messages in flight, or completing any files it has written
+		if err = observationSink.Close(); err != nil {
+			anyError = true
+			log.Error(ctx, "bad observation sink stop", err, log.Data{"sink": config.OutputSink})
+		} else {
+			log.Info(ctx, "observation sink stopped", log.Data{"sink": config.OutputSink})
+		}
+
+		// Close Extraction Complete Kafka producer
+		if serviceList.CompleteProducer {
+			if err = kafkaCompleteProducer.Close(ctx); err != nil {
+				anyError = true
+				log.Error(ctx, "bad kafka extraction complete producer stop", err, log.Data{"topic": config.KafkaConfig.ExtractionCompleteTopic})
+			} else {
+				log.Info(ctx, "kafka extraction complete producer stopped", log.Data{"topic": config.KafkaConfig.ExtractionCompleteTopic})
+			}
+		}
+
+		// Close Dead Letter Kafka producer
+		if serviceList.DeadLetterProducer {
+			if err = kafkaDeadLetterProducer.Close(); err != nil {
 				anyError = true
-				log.Error(ctx, "bad kafka observation producer stop", err, log.Data{"topic": config.KafkaConfig.ObservationProducerTopic})
+				log.Error(ctx, "bad kafka dead letter producer stop", err, log.Data{"topic": config.KafkaConfig.DeadLetterProducerTopic})
 			} else {
-				log.Info(ctx, "kafka observation producer stopped", log.Data{"topic": config.KafkaConfig.ObservationProducerTopic})
+				log.Info(ctx, "kafka dead letter producer stopped", log.Data{"topic": config.KafkaConfig.DeadLetterProducerTopic})
 			}
 		}
 
@@ -159,8 +261,8 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 
 	// Log non-fatal errors in separate go routines
 	kafkaConsumer.Channels().LogErrors(ctx, "kafka consumer error")
-	kafkaObservationProducer.Channels().LogErrors(ctx, "kafka observation producer error")
-	kafkaErrorProducer.Channels().LogErrors(ctx, "kafka error producer error")
+	logProducerErrors(ctx, kafkaErrorProducer, config.KafkaConfig.ErrorProducerTopic, "kafka error producer error")
+	logProducerErrors(ctx, kafkaCompleteProducer, config.KafkaConfig.ExtractionCompleteTopic, "kafka extraction complete producer error")
 	go func() {
 		for err := range errorChannel {
 			log.Error(ctx, "error channel", err)
@@ -174,10 +276,83 @@ func Run(ctx context.Context, config *config.Config, serviceList initialise.Exte
 	return shutdownGracefully()
 }
 
-// StartHealthCheck sets up the Handler, starts the healthcheck and the http server that serves health endpoint
-func startHealthCheck(ctx context.Context, hc *healthcheck.HealthCheck, bindAddr string, errorChannel chan error) *server.Server {
+// getObservationSink returns the sink that observations are written to, as chosen by the configuration. A kafka
+// observation producer is only created if observations are sent to kafka, in which case its health checker is also
+// returned. If there is a schema registry, the schema of the observations is registered under the topic's value
+// subject and the observations are sent in the schema registry wire format.
+func getObservationSink(ctx context.Context, cfg *config.Config, serviceList *initialise.ExternalServiceList, schemaRegistry *schemaregistry.Client) (sink.Sink, healthcheck.Checker, error) {
+	messageType := sink.ExtractedEvents
+	if cfg.ObservationBatchSize > 1 {
+		messageType = sink.ExtractedBatchEvents
+	}
+
+	switch cfg.OutputSink {
+	case config.OutputSinkFile:
+		observationSink, err := sink.NewRollingFile(cfg.OutputDir, cfg.OutputFormat, cfg.OutputFileMaxBytes, messageType)
+		return observationSink, nil, err
+	case config.OutputSinkStdout:
+		observationSink, err := sink.NewStdout(cfg.OutputFormat, messageType)
+		return observationSink, nil, err
+	default:
+		schemaID := 0
+		if schemaRegistry != nil {
+			subject := cfg.KafkaConfig.ObservationProducerTopic + "-value"
+			var err error
+			if schemaID, err = schemaRegistry.Register(ctx, subject, messageType.Schema().Definition); err != nil {
+				return nil, nil, err
+			}
+			log.Info(ctx, "registered observation schema", log.Data{"subject": subject, "schema_id": schemaID})
+		}
+
+		kafkaObservationProducer, err := serviceList.GetAckedProducer(ctx, &cfg.KafkaConfig, cfg.KafkaConfig.ObservationProducerTopic, cfg.ObservationMaxInFlight, schemaID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return kafkaObservationProducer, kafkaObservationProducer.Checker, nil
+	}
+}
+
+// getFileSources returns the file sources for the given file url schemes. Files downloaded over HTTP are only
+// redirected to URLs that the url policy allows.
+func getFileSources(schemes []string, s3Source event.FileSource, urlPolicy urlpolicy.Policy, retryPolicy retry.Policy) map[string]event.FileSource {
+	sources := make(map[string]event.FileSource, len(schemes))
+	for _, scheme := range schemes {
+		switch scheme {
+		case event.SchemeS3:
+			sources[scheme] = s3Source
+		case event.SchemeFile:
+			sources[scheme] = event.NewLocalSource()
+		case event.SchemeHTTP, event.SchemeHTTPS:
+			sources[scheme] = event.NewHTTPSource(event.NewHTTPClient(urlPolicy), retryPolicy)
+		}
+	}
+	return sources
+}
+
+// getURLPolicy returns the url policy described by the configuration
+func getURLPolicy(config *config.Config) (policy urlpolicy.Policy, err error) {
+	if policy.Allow, err = urlpolicy.ParseRules(config.URLAllowRules); err != nil {
+		return policy, err
+	}
+	if policy.Deny, err = urlpolicy.ParseRules(config.URLDenyRules); err != nil {
+		return policy, err
+	}
+	policy.MaxObjectSize = config.MaxObjectSize
+	return policy, nil
+}
+
+// StartHealthCheck sets up the Handler, starts the healthcheck and the http server that serves health endpoint,
+// along with the metrics, the jobs admin api and the admin endpoints authenticated with adminToken
+func startHealthCheck(ctx context.Context, hc *healthcheck.HealthCheck, jobRegistry *jobs.Registry, pauser admin.Pauser, extractor *admin.Extractor, adminToken, bindAddr string, errorChannel chan error) *server.Server {
 	router := mux.NewRouter()
 	router.Path("/health").HandlerFunc(hc.Handler)
+	router.Path("/metrics").Handler(metrics.Handler())
+	router.Path("/jobs").Methods(http.MethodGet).HandlerFunc(jobRegistry.ListHandler)
+	router.Path("/jobs/{" + jobs.InstanceIDVar + "}").Methods(http.MethodGet).HandlerFunc(jobRegistry.GetHandler)
+	router.Path("/admin/pause").Methods(http.MethodPost).HandlerFunc(admin.RequireToken(adminToken, admin.PauseHandler(pauser)))
+	router.Path("/admin/resume").Methods(http.MethodPost).HandlerFunc(admin.RequireToken(adminToken, admin.ResumeHandler(pauser)))
+	router.Path("/extractions").Methods(http.MethodPost).HandlerFunc(admin.RequireToken(adminToken, extractor.Handler))
+	router.Path("/extractions/{" + jobs.IDVar + "}").Methods(http.MethodGet).HandlerFunc(jobRegistry.GetByIDHandler)
 	hc.Start(ctx)
 
 	httpServer := server.New(bindAddr, router)
@@ -193,13 +368,34 @@ func startHealthCheck(ctx context.Context, hc *healthcheck.HealthCheck, bindAddr
 	return httpServer
 }
 
+// logProducerErrors creates a go-routine that logs and counts each error from the producer, until it is closed.
+func logProducerErrors(ctx context.Context, producer *kafka.Producer, topic, errMsg string) {
+	channels := producer.Channels()
+	go func() {
+		for {
+			select {
+			case err := <-channels.Errors:
+				metrics.ProducerErrors.WithLabelValues(topic).Inc()
+				log.Error(ctx, errMsg, err, log.Data{"topic": topic})
+			case <-channels.Closer:
+				return
+			}
+		}
+	}()
+}
+
 // RegisterCheckers adds the checkers for the provided clients to the healthcheck object.
 func registerCheckers(ctx context.Context, hc *healthcheck.HealthCheck,
 	kafkaConsumer *kafka.ConsumerGroup,
-	kafkaObservationProducer *kafka.Producer,
+	eventConsumer *event.Consumer,
+	observationChecker healthcheck.Checker,
 	kafkaErrorProducer *kafka.Producer,
+	kafkaCompleteProducer *kafka.Producer,
+	kafkaDeadLetterProducer *initialise.ConfirmedProducer,
 	vaultClient event.VaultClient,
-	s3Clients map[string]event.S3Client) (err error) {
+	schemaRegistry *schemaregistry.Client,
+	s3Clients map[string]event.S3Client,
+	s3Registry *event.S3ClientRegistry) (err error) {
 	hasErrors := false
 
 	if err = hc.AddCheck("Kafka Consumer", kafkaConsumer.Checker); err != nil {
@@ -207,9 +403,16 @@ func registerCheckers(ctx context.Context, hc *healthcheck.HealthCheck,
 		log.Error(ctx, "error adding check for kafka consumer checker", err)
 	}
 
-	if err = hc.AddCheck("Kafka Observation Producer", kafkaObservationProducer.Checker); err != nil {
+	if err = hc.AddCheck("Event Consumer", eventConsumer.Checker); err != nil {
 		hasErrors = true
-		log.Error(ctx, "error adding check for kafka observation producer checker", err)
+		log.Error(ctx, "error adding check for event consumer checker", err)
+	}
+
+	if observationChecker != nil {
+		if err = hc.AddCheck("Kafka Observation Producer", observationChecker); err != nil {
+			hasErrors = true
+			log.Error(ctx, "error adding check for kafka observation producer checker", err)
+		}
 	}
 
 	if err = hc.AddCheck("Kafka Error Producer", kafkaErrorProducer.Checker); err != nil {
@@ -217,6 +420,16 @@ func registerCheckers(ctx context.Context, hc *healthcheck.HealthCheck,
 		log.Error(ctx, "error adding check for kafka error producer checker", err)
 	}
 
+	if err = hc.AddCheck("Kafka Extraction Complete Producer", kafkaCompleteProducer.Checker); err != nil {
+		hasErrors = true
+		log.Error(ctx, "error adding check for kafka extraction complete producer checker", err)
+	}
+
+	if err = hc.AddCheck("Kafka Dead Letter Producer", kafkaDeadLetterProducer.Checker); err != nil {
+		hasErrors = true
+		log.Error(ctx, "error adding check for kafka dead letter producer checker", err)
+	}
+
 	if vaultClient != nil {
 		if err = hc.AddCheck("Vault", vaultClient.Checker); err != nil {
 			hasErrors = true
@@ -224,6 +437,13 @@ func registerCheckers(ctx context.Context, hc *healthcheck.HealthCheck,
 		}
 	}
 
+	if schemaRegistry != nil {
+		if err = hc.AddCheck("Schema Registry", schemaRegistry.Checker); err != nil {
+			hasErrors = true
+			log.Error(ctx, "error adding check for schema registry checker", err)
+		}
+	}
+
 	for bucketName, s3 := range s3Clients {
 		if err := hc.AddCheck(fmt.Sprintf("S3 bucket %s", bucketName), s3.Checker); err != nil {
 			hasErrors = true
@@ -231,6 +451,11 @@ func registerCheckers(ctx context.Context, hc *healthcheck.HealthCheck,
 		}
 	}
 
+	if err = hc.AddCheck("S3 buckets from events", s3Registry.Checker); err != nil {
+		hasErrors = true
+		log.Error(ctx, "error adding check for s3 buckets from events", err)
+	}
+
 	if hasErrors {
 		return errors.New("Error(s) registering checkers for healthcheck")
 	}
@@ -0,0 +1,179 @@
+package sink
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ONSdigital/dp-observation-extractor/metrics"
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+var _ observation.ConfirmedSink = (*AckedKafka)(nil)
+
+// AckedKafka is a sink that sends messages to kafka and confirms that each one has been acknowledged. The number of
+// messages sent but not yet acknowledged is limited, so that writes wait when kafka falls behind.
+type AckedKafka struct {
+	producer sarama.AsyncProducer
+	topic    string
+	schemaID int
+	inFlight chan struct{}
+	done     chan struct{}
+}
+
+// NewAckedKafka returns a sink that sends messages to the topic through the given producer, with at most maxInFlight
+// messages waiting to be acknowledged. The producer must be configured to return both successes and errors. If
+// schemaID is not zero, each message is sent in the schema registry wire format with that schema ID.
+func NewAckedKafka(producer sarama.AsyncProducer, topic string, maxInFlight, schemaID int) *AckedKafka {
+	sink := &AckedKafka{
+		producer: producer,
+		topic:    topic,
+		inFlight: make(chan struct{}, maxInFlight),
+		done:     make(chan struct{}),
+		schemaID: schemaID,
+	}
+	go sink.acknowledge()
+	return sink
+}
+
+// Write sends the message without tracking its delivery. Failures are only logged.
+func (sink *AckedKafka) Write(ctx context.Context, message []byte) error {
+	return sink.send(ctx, message, nil)
+}
+
+// NewDelivery returns a Delivery that tracks the acknowledgement of the messages written through it.
+func (sink *AckedKafka) NewDelivery() observation.Delivery {
+	return &Delivery{sink: sink, changed: make(chan struct{})}
+}
+
+// Close sends any buffered messages, waits for them to be acknowledged and then closes the producer.
+func (sink *AckedKafka) Close() error {
+	sink.producer.AsyncClose()
+	<-sink.done
+	return nil
+}
+
+// send waits for a message to be allowed in flight, and then sends it to the producer with the delivery, if any,
+// as its metadata.
+func (sink *AckedKafka) send(ctx context.Context, message []byte, delivery *Delivery) error {
+	select {
+	case sink.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if sink.schemaID != 0 {
+		message = schemaregistry.Encode(sink.schemaID, message)
+	}
+
+	producerMessage := &sarama.ProducerMessage{Topic: sink.topic, Value: sarama.ByteEncoder(message)}
+	if delivery != nil {
+		producerMessage.Metadata = delivery
+	}
+
+	select {
+	case sink.producer.Input() <- producerMessage:
+		return nil
+	case <-ctx.Done():
+		<-sink.inFlight
+		return ctx.Err()
+	}
+}
+
+// acknowledge resolves the delivery of each message acknowledged or failed by the producer, until the producer
+// has been closed.
+func (sink *AckedKafka) acknowledge() {
+	defer close(sink.done)
+
+	successes, errors := sink.producer.Successes(), sink.producer.Errors()
+	for successes != nil || errors != nil {
+		select {
+		case message, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			sink.resolve(message, nil)
+		case producerErr, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			metrics.ProducerErrors.WithLabelValues(sink.topic).Inc()
+			log.Error(context.Background(), "kafka observation producer error", producerErr.Err, log.Data{"topic": sink.topic})
+			sink.resolve(producerErr.Msg, producerErr.Err)
+		}
+	}
+}
+
+// resolve frees the in-flight slot of the message, and records its outcome against its delivery.
+func (sink *AckedKafka) resolve(message *sarama.ProducerMessage, err error) {
+	<-sink.inFlight
+	if delivery, ok := message.Metadata.(*Delivery); ok {
+		delivery.resolve(err)
+	}
+}
+
+// Delivery tracks the acknowledgement of the messages written through it to an AckedKafka sink.
+type Delivery struct {
+	sink         *AckedKafka
+	mutex        sync.Mutex
+	sent         int64
+	acknowledged int64
+	failed       int64
+	err          error
+	changed      chan struct{}
+}
+
+// Write sends the message, tracking its delivery.
+func (delivery *Delivery) Write(ctx context.Context, message []byte) error {
+	if err := delivery.sink.send(ctx, message, delivery); err != nil {
+		return err
+	}
+
+	delivery.mutex.Lock()
+	delivery.sent++
+	delivery.mutex.Unlock()
+	return nil
+}
+
+// Wait blocks until every message sent has been acknowledged or has failed, and returns the number acknowledged
+// along with the cause of the first failure. The context's error is returned if it is done first.
+func (delivery *Delivery) Wait(ctx context.Context) (int64, error) {
+	for {
+		delivery.mutex.Lock()
+		acknowledged, err, changed := delivery.acknowledged, delivery.err, delivery.changed
+		finished := delivery.acknowledged+delivery.failed >= delivery.sent
+		delivery.mutex.Unlock()
+
+		if finished {
+			return acknowledged, err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return acknowledged, ctx.Err()
+		}
+	}
+}
+
+// resolve records the outcome of a message, waking anything waiting for the delivery.
+func (delivery *Delivery) resolve(err error) {
+	delivery.mutex.Lock()
+	defer delivery.mutex.Unlock()
+
+	if err != nil {
+		delivery.failed++
+		if delivery.err == nil {
+			delivery.err = err
+		}
+	} else {
+		delivery.acknowledged++
+	}
+
+	close(delivery.changed)
+	delivery.changed = make(chan struct{})
+}
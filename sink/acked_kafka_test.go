@@ -0,0 +1,143 @@
+package sink_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/schemaregistry"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const topic = "observation-extracted"
+
+func TestAckedKafka(t *testing.T) {
+	Convey("Given an acked kafka sink whose producer acknowledges every message", t, func() {
+		producer := mocks.NewAsyncProducer(t, newSaramaConfig())
+		producer.ExpectInputAndSucceed()
+		producer.ExpectInputAndSucceed()
+		ackedKafka := sink.NewAckedKafka(producer, topic, 10, 0)
+
+		Convey("When messages are written through a delivery", func() {
+			delivery := ackedKafka.NewDelivery()
+			So(delivery.Write(ctx, []byte("one")), ShouldBeNil)
+			So(delivery.Write(ctx, []byte("two")), ShouldBeNil)
+
+			Convey("Then waiting for the delivery returns the number of messages acknowledged", func() {
+				acknowledged, err := delivery.Wait(ctx)
+				So(err, ShouldBeNil)
+				So(acknowledged, ShouldEqual, 2)
+				So(ackedKafka.Close(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given an acked kafka sink whose producer fails a message", t, func() {
+		produceErr := errors.New("not enough replicas")
+		producer := mocks.NewAsyncProducer(t, newSaramaConfig())
+		producer.ExpectInputAndSucceed()
+		producer.ExpectInputAndFail(produceErr)
+		ackedKafka := sink.NewAckedKafka(producer, topic, 10, 0)
+
+		Convey("When messages are written through a delivery", func() {
+			delivery := ackedKafka.NewDelivery()
+			So(delivery.Write(ctx, []byte("one")), ShouldBeNil)
+			So(delivery.Write(ctx, []byte("two")), ShouldBeNil)
+
+			Convey("Then waiting for the delivery returns the producer error and the number acknowledged", func() {
+				acknowledged, err := delivery.Wait(ctx)
+				So(err, ShouldEqual, produceErr)
+				So(acknowledged, ShouldEqual, 1)
+				So(ackedKafka.Close(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given an acked kafka sink with a message in flight that has not been acknowledged", t, func() {
+		producer := newPendingProducer()
+		ackedKafka := sink.NewAckedKafka(producer, topic, 1, 0)
+		So(ackedKafka.Write(ctx, []byte("one")), ShouldBeNil)
+		first := <-producer.input
+
+		Convey("When another message is written with a context that is cancelled", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			err := ackedKafka.Write(cancelled, []byte("two"))
+
+			Convey("Then the write waits for the message in flight, returning the context's error", func() {
+				So(err, ShouldEqual, context.Canceled)
+				So(producer.input, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the message in flight is acknowledged", func() {
+			producer.successes <- first
+
+			Convey("Then another message can be written", func() {
+				So(ackedKafka.Write(ctx, []byte("two")), ShouldBeNil)
+				So(string((<-producer.input).Value.(sarama.ByteEncoder)), ShouldEqual, "two")
+			})
+		})
+	})
+
+	Convey("Given an acked kafka sink with a schema ID", t, func() {
+		producer := newPendingProducer()
+		ackedKafka := sink.NewAckedKafka(producer, topic, 1, 42)
+
+		Convey("When a message is written", func() {
+			So(ackedKafka.Write(ctx, []byte("one")), ShouldBeNil)
+			sent := <-producer.input
+
+			Convey("Then it is sent in the schema registry wire format with the schema ID", func() {
+				schemaID, payload, err := schemaregistry.Decode(sent.Value.(sarama.ByteEncoder))
+				So(err, ShouldBeNil)
+				So(schemaID, ShouldEqual, 42)
+				So(string(payload), ShouldEqual, "one")
+				producer.successes <- sent
+				So(ackedKafka.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func newSaramaConfig() *sarama.Config {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	return config
+}
+
+// pendingProducer is an AsyncProducer that keeps each message sent until the test acknowledges it.
+type pendingProducer struct {
+	sarama.AsyncProducer
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newPendingProducer() *pendingProducer {
+	return &pendingProducer{
+		input:     make(chan *sarama.ProducerMessage, 1),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (producer *pendingProducer) Input() chan<- *sarama.ProducerMessage {
+	return producer.input
+}
+
+func (producer *pendingProducer) Successes() <-chan *sarama.ProducerMessage {
+	return producer.successes
+}
+
+func (producer *pendingProducer) Errors() <-chan *sarama.ProducerError {
+	return producer.errors
+}
+
+func (producer *pendingProducer) AsyncClose() {
+	close(producer.successes)
+	close(producer.errors)
+}
@@ -0,0 +1,126 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/go-avro/avro"
+)
+
+// containerBlockSize is the number of messages in each block of an Avro object container file.
+const containerBlockSize = 1000
+
+// encoder writes messages to an output in a particular format.
+type encoder interface {
+	encode(message []byte) error
+	// close writes anything that has been buffered, and completes the output for formats that need it.
+	close() error
+}
+
+// newEncoder returns an encoder that writes messages of the given type to the output in the given format.
+func newEncoder(output io.Writer, format string, messageType *MessageType) (encoder, error) {
+	buffered := bufio.NewWriter(output)
+
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonEncoder{output: buffered, messageType: messageType}, nil
+	case FormatRaw:
+		return &rawEncoder{output: buffered}, nil
+	case FormatAvro:
+		return newContainerEncoder(buffered, messageType)
+	default:
+		return nil, &UnsupportedFormatError{Format: format}
+	}
+}
+
+// ndjsonEncoder writes a line of JSON for each message.
+type ndjsonEncoder struct {
+	output      *bufio.Writer
+	messageType *MessageType
+}
+
+func (encoder *ndjsonEncoder) encode(message []byte) error {
+	event, err := encoder.messageType.toJSON(message)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = encoder.output.Write(append(line, '\n'))
+	return err
+}
+
+func (encoder *ndjsonEncoder) close() error {
+	return encoder.output.Flush()
+}
+
+// rawEncoder writes the messages as they are, one after another.
+type rawEncoder struct {
+	output *bufio.Writer
+}
+
+func (encoder *rawEncoder) encode(message []byte) error {
+	_, err := encoder.output.Write(message)
+	return err
+}
+
+func (encoder *rawEncoder) close() error {
+	return encoder.output.Flush()
+}
+
+// containerEncoder writes the messages to an Avro object container file. The messages are already Avro encoded,
+// so they are written to the blocks of the file as they are.
+type containerEncoder struct {
+	output *bufio.Writer
+	writer *avro.DataFileWriter
+	count  int
+}
+
+func newContainerEncoder(output *bufio.Writer, messageType *MessageType) (*containerEncoder, error) {
+	containerSchema, err := avro.ParseSchema(messageType.schema.Definition)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := avro.NewDataFileWriter(output, containerSchema, rawDatumWriter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &containerEncoder{output: output, writer: writer}, nil
+}
+
+func (encoder *containerEncoder) encode(message []byte) error {
+	if err := encoder.writer.Write(message); err != nil {
+		return err
+	}
+
+	encoder.count++
+	if encoder.count < containerBlockSize {
+		return nil
+	}
+
+	encoder.count = 0
+	return encoder.writer.Flush()
+}
+
+// close writes the last block. The writer is not closed, as that writes an empty block which some readers reject.
+func (encoder *containerEncoder) close() error {
+	if err := encoder.writer.Flush(); err != nil {
+		return err
+	}
+	return encoder.output.Flush()
+}
+
+// rawDatumWriter writes datums that have already been Avro encoded.
+type rawDatumWriter struct{}
+
+func (rawDatumWriter) Write(obj interface{}, enc avro.Encoder) error {
+	enc.WriteRaw(obj.([]byte))
+	return nil
+}
@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RollingFile is a sink that writes messages to files in a local directory, starting a new file once the current
+// one has reached a maximum size.
+type RollingFile struct {
+	mutex    sync.Mutex
+	dir      string
+	format   string
+	maxBytes int64
+	messages *MessageType
+	prefix   string
+	sequence int
+	current  *Writer
+	written  int64
+}
+
+// NewRollingFile returns a sink that writes messages of the given type to files in the given directory, in the given
+// format. A new file is started once messages totalling at least maxBytes have been written to the current one, or
+// never if maxBytes is 0. The size of each file depends on the format, so it is only roughly limited by maxBytes.
+func NewRollingFile(dir, format string, maxBytes int64, messageType *MessageType) (*RollingFile, error) {
+	if _, err := newEncoder(io.Discard, format, messageType); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &RollingFile{
+		dir:      dir,
+		format:   format,
+		maxBytes: maxBytes,
+		messages: messageType,
+		prefix:   "observations-" + time.Now().UTC().Format("20060102T150405"),
+	}, nil
+}
+
+// Write writes the message to the current file, creating it if needed.
+func (sink *RollingFile) Write(ctx context.Context, message []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.current == nil {
+		if err := sink.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := sink.current.Write(ctx, message); err != nil {
+		return err
+	}
+
+	sink.written += int64(len(message))
+	if sink.maxBytes > 0 && sink.written >= sink.maxBytes {
+		return sink.closeCurrent()
+	}
+	return nil
+}
+
+// Close completes and closes the current file.
+func (sink *RollingFile) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return sink.closeCurrent()
+}
+
+// open creates the next file in the sequence.
+func (sink *RollingFile) open() error {
+	sink.sequence++
+	name := filepath.Join(sink.dir, fmt.Sprintf("%s-%04d.%s", sink.prefix, sink.sequence, sink.format))
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer, err := NewWriter(file, sink.format, sink.messages)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	writer.closer = file
+
+	sink.current = writer
+	sink.written = 0
+	return nil
+}
+
+// closeCurrent closes the current file, if there is one.
+func (sink *RollingFile) closeCurrent() error {
+	if sink.current == nil {
+		return nil
+	}
+
+	err := sink.current.Close()
+	sink.current = nil
+	return err
+}
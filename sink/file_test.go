@@ -0,0 +1,76 @@
+package sink_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRollingFile(t *testing.T) {
+	Convey("Given a rolling file sink with a maximum size smaller than each message", t, func() {
+		dir := filepath.Join(t.TempDir(), "observations")
+		rollingFile, err := sink.NewRollingFile(dir, sink.FormatRaw, 1, sink.ExtractedEvents)
+		So(err, ShouldBeNil)
+
+		Convey("When messages are written to it", func() {
+			messages := marshalEvents("1,Jan-96,Jan-96", "2,Feb-96,Feb-96", "3,Mar-96,Mar-96")
+			writeAll(rollingFile, messages)
+
+			Convey("Then each message is written to a new file, in order", func() {
+				files, err := filepath.Glob(filepath.Join(dir, "observations-*.raw"))
+				So(err, ShouldBeNil)
+				So(files, ShouldHaveLength, 3)
+
+				for i, file := range files {
+					content, err := os.ReadFile(file)
+					So(err, ShouldBeNil)
+					So(content, ShouldResemble, messages[i])
+				}
+			})
+		})
+	})
+
+	Convey("Given a rolling file sink for avro with no maximum size", t, func() {
+		dir := t.TempDir()
+		rollingFile, err := sink.NewRollingFile(dir, sink.FormatAvro, 0, sink.ExtractedEvents)
+		So(err, ShouldBeNil)
+
+		Convey("When messages are written to it", func() {
+			writeAll(rollingFile, marshalEvents("1,Jan-96,Jan-96", "2,Feb-96,Feb-96"))
+
+			Convey("Then a single complete avro object container file is written", func() {
+				files, err := filepath.Glob(filepath.Join(dir, "observations-*.avro"))
+				So(err, ShouldBeNil)
+				So(files, ShouldHaveLength, 1)
+				So(readContainer(files[0]), ShouldHaveLength, 2)
+			})
+		})
+	})
+
+	Convey("Given a rolling file sink that is closed without any messages", t, func() {
+		dir := t.TempDir()
+		rollingFile, err := sink.NewRollingFile(dir, sink.FormatNDJSON, 0, sink.ExtractedEvents)
+		So(err, ShouldBeNil)
+		So(rollingFile.Close(), ShouldBeNil)
+
+		Convey("Then no files are written", func() {
+			files, err := os.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an unsupported format", t, func() {
+		Convey("When a rolling file sink is created", func() {
+			rollingFile, err := sink.NewRollingFile(t.TempDir(), "csv", 0, sink.ExtractedEvents)
+
+			Convey("Then an unsupported format error is returned", func() {
+				So(rollingFile, ShouldBeNil)
+				So(err, ShouldResemble, &sink.UnsupportedFormatError{Format: "csv"})
+			})
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a sink that keeps the messages written to it in memory, which is useful for tests and for using the
+// extractor as a library.
+type Memory struct {
+	mutex    sync.Mutex
+	messages [][]byte
+	closed   bool
+}
+
+// NewMemory returns an empty in-memory sink.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Write appends the message to the messages held in memory.
+func (sink *Memory) Write(ctx context.Context, message []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.messages = append(sink.messages, message)
+	return nil
+}
+
+// Close marks the sink as closed. The messages are still available.
+func (sink *Memory) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.closed = true
+	return nil
+}
+
+// Messages returns the messages written so far, in the order they were written.
+func (sink *Memory) Messages() [][]byte {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return append([][]byte(nil), sink.messages...)
+}
+
+// IsClosed returns true if the sink has been closed.
+func (sink *Memory) IsClosed() bool {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return sink.closed
+}
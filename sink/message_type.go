@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"encoding/base64"
+
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/schema"
+	goavro "github.com/ONSdigital/go-ns/avro"
+)
+
+// MessageType describes the messages written to a sink, so that they can be decoded for the NDJSON format and
+// described by the schema of an Avro object container file.
+type MessageType struct {
+	schema *goavro.Schema
+	toJSON func(message []byte) (interface{}, error)
+}
+
+// The types of message that can be written to a sink
+var (
+	// ExtractedEvents are observation extracted events, with a single row each.
+	ExtractedEvents = &MessageType{schema: schema.ObservationExtractedEvent, toJSON: extractedEventJSON}
+	// ExtractedBatchEvents are observation extracted batch events, with consecutive rows.
+	ExtractedBatchEvents = &MessageType{schema: schema.ObservationExtractedBatchEvent, toJSON: extractedBatchEventJSON}
+)
+
+// Schema returns the Avro schema of the messages.
+func (messageType *MessageType) Schema() *goavro.Schema {
+	return messageType.schema
+}
+
+// ndjsonEvent is an observation extracted event as written to an NDJSON file, along with the base64 encoded
+// Avro message that would have been sent to kafka.
+type ndjsonEvent struct {
+	InstanceID string `json:"instance_id"`
+	RowIndex   int64  `json:"row_index"`
+	Row        string `json:"row"`
+	Message    string `json:"message"`
+}
+
+func extractedEventJSON(message []byte) (interface{}, error) {
+	var event observation.ExtractedEvent
+	if err := schema.ObservationExtractedEvent.Unmarshal(message, &event); err != nil {
+		return nil, err
+	}
+
+	return ndjsonEvent{
+		InstanceID: event.InstanceID,
+		RowIndex:   event.RowIndex,
+		Row:        event.Row,
+		Message:    base64.StdEncoding.EncodeToString(message),
+	}, nil
+}
+
+// ndjsonBatchEvent is an observation extracted batch event as written to an NDJSON file, along with the base64
+// encoded Avro message that would have been sent to kafka.
+type ndjsonBatchEvent struct {
+	InstanceID string   `json:"instance_id"`
+	RowIndex   int64    `json:"row_index"`
+	Rows       []string `json:"rows"`
+	Message    string   `json:"message"`
+}
+
+func extractedBatchEventJSON(message []byte) (interface{}, error) {
+	event, err := observation.UnmarshalBatch(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return ndjsonBatchEvent{
+		InstanceID: event.InstanceID,
+		RowIndex:   event.RowIndex,
+		Rows:       event.Rows,
+		Message:    base64.StdEncoding.EncodeToString(message),
+	}, nil
+}
@@ -0,0 +1,65 @@
+// Package sink provides the outputs that observation extracted event messages can be written to.
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	kafka "github.com/ONSdigital/dp-kafka/v2"
+)
+
+// Possible formats for the sinks that write to files
+const (
+	// FormatNDJSON writes a JSON object for each observation, including the base64 encoded message.
+	FormatNDJSON = "ndjson"
+	// FormatAvro writes an Avro object container file, with the observation extracted event schema.
+	FormatAvro = "avro"
+	// FormatRaw writes the messages one after another, exactly as they would be sent to kafka.
+	FormatRaw = "raw"
+)
+
+// Sink is an output that observation extracted event messages are written to.
+type Sink interface {
+	Write(ctx context.Context, message []byte) error
+	Close() error
+}
+
+// UnsupportedFormatError is returned when a sink is created with a format that it does not support.
+type UnsupportedFormatError struct {
+	Format string
+}
+
+// Error returns a description of the unsupported format.
+func (err *UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("unsupported sink format: %q", err.Format)
+}
+
+// MessageProducer dependency that writes messages
+type MessageProducer interface {
+	Channels() *kafka.ProducerChannels
+}
+
+// Kafka is a sink that sends messages to a kafka producer.
+type Kafka struct {
+	producer MessageProducer
+}
+
+// NewKafka returns a sink that sends messages to the given kafka producer.
+func NewKafka(producer MessageProducer) *Kafka {
+	return &Kafka{producer: producer}
+}
+
+// Write sends the message to the producer's output channel, or returns the context's error if it is done first.
+func (sink *Kafka) Write(ctx context.Context, message []byte) error {
+	select {
+	case sink.producer.Channels().Output <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close does nothing, as the producer is closed separately.
+func (sink *Kafka) Close() error {
+	return nil
+}
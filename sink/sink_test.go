@@ -0,0 +1,55 @@
+package sink_test
+
+import (
+	"context"
+	"testing"
+
+	kafka "github.com/ONSdigital/dp-kafka/v2"
+	"github.com/ONSdigital/dp-kafka/v2/kafkatest"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKafka(t *testing.T) {
+	Convey("Given a kafka sink", t, func() {
+		pChannels := kafka.CreateProducerChannels()
+		pChannels.Output = make(chan []byte, 1)
+		producer := kafkatest.NewMessageProducerWithChannels(pChannels, true)
+		kafkaSink := sink.NewKafka(producer)
+
+		Convey("When a message is written", func() {
+			err := kafkaSink.Write(ctx, []byte("message"))
+
+			Convey("Then it is sent to the producer's output channel", func() {
+				So(err, ShouldBeNil)
+				So(<-producer.Channels().Output, ShouldResemble, []byte("message"))
+			})
+		})
+
+		Convey("When a message is written with a cancelled context and the output channel is full", func() {
+			producer.Channels().Output <- []byte("previous")
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			err := kafkaSink.Write(cancelled, []byte("message"))
+
+			Convey("Then the context's error is returned", func() {
+				So(err, ShouldEqual, context.Canceled)
+			})
+		})
+	})
+}
+
+func TestMemory(t *testing.T) {
+	Convey("Given an in-memory sink", t, func() {
+		memory := sink.NewMemory()
+
+		Convey("When messages are written and the sink is closed", func() {
+			writeAll(memory, [][]byte{[]byte("one"), []byte("two")})
+
+			Convey("Then the messages are kept in order", func() {
+				So(memory.Messages(), ShouldResemble, [][]byte{[]byte("one"), []byte("two")})
+				So(memory.IsClosed(), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// Writer is a sink that writes messages to an io.Writer in a given format.
+type Writer struct {
+	mutex   sync.Mutex
+	encoder encoder
+	closer  io.Closer
+}
+
+// NewWriter returns a sink that writes messages of the given type to the given output in the given format. The
+// output is not closed when the sink is closed.
+func NewWriter(output io.Writer, format string, messageType *MessageType) (*Writer, error) {
+	encoder, err := newEncoder(output, format, messageType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{encoder: encoder}, nil
+}
+
+// NewStdout returns a sink that writes messages of the given type to standard output in the given format.
+func NewStdout(format string, messageType *MessageType) (*Writer, error) {
+	return NewWriter(os.Stdout, format, messageType)
+}
+
+// Write writes the message to the output. Output may be buffered until the sink is closed.
+func (sink *Writer) Write(ctx context.Context, message []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return sink.encoder.encode(message)
+}
+
+// Close writes any buffered output, completing the output for formats that need it.
+func (sink *Writer) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	err := sink.encoder.close()
+	if sink.closer != nil {
+		if closeErr := sink.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package sink_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/observation"
+	"github.com/ONSdigital/dp-observation-extractor/schema"
+	"github.com/ONSdigital/dp-observation-extractor/sink"
+	"github.com/go-avro/avro"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestWriter(t *testing.T) {
+	Convey("Given some observation extracted event messages", t, func() {
+		messages := marshalEvents("1,Jan-96,Jan-96", "2,Feb-96,Feb-96")
+		var output bytes.Buffer
+
+		Convey("When they are written to an ndjson writer", func() {
+			writer, err := sink.NewWriter(&output, sink.FormatNDJSON, sink.ExtractedEvents)
+			So(err, ShouldBeNil)
+			writeAll(writer, messages)
+
+			Convey("Then a line is written for each message", func() {
+				lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+				So(lines, ShouldHaveLength, 2)
+
+				var line map[string]interface{}
+				So(json.Unmarshal([]byte(lines[1]), &line), ShouldBeNil)
+				So(line["instance_id"], ShouldEqual, "123")
+				So(line["row_index"], ShouldEqual, 2)
+				So(line["row"], ShouldEqual, "2,Feb-96,Feb-96")
+				So(line["message"], ShouldEqual, base64.StdEncoding.EncodeToString(messages[1]))
+			})
+		})
+
+		Convey("When they are written to a raw writer", func() {
+			writer, err := sink.NewWriter(&output, sink.FormatRaw, sink.ExtractedEvents)
+			So(err, ShouldBeNil)
+			writeAll(writer, messages)
+
+			Convey("Then the messages are written as they are", func() {
+				So(output.Bytes(), ShouldResemble, bytes.Join(messages, nil))
+			})
+		})
+
+		Convey("When they are written to an avro writer", func() {
+			file := filepath.Join(t.TempDir(), "observations.avro")
+			out, err := os.Create(file)
+			So(err, ShouldBeNil)
+			writer, err := sink.NewWriter(out, sink.FormatAvro, sink.ExtractedEvents)
+			So(err, ShouldBeNil)
+			writeAll(writer, messages)
+			So(out.Close(), ShouldBeNil)
+
+			Convey("Then an avro object container file with the events is written", func() {
+				So(readContainer(file), ShouldResemble, []observation.ExtractedEvent{
+					{InstanceID: "123", RowIndex: 1, Row: "1,Jan-96,Jan-96"},
+					{InstanceID: "123", RowIndex: 2, Row: "2,Feb-96,Feb-96"},
+				})
+			})
+		})
+	})
+
+	Convey("Given an observation extracted batch event message", t, func() {
+		message, err := schema.ObservationExtractedBatchEvent.Marshal(observation.ExtractedBatchEvent{
+			InstanceID: "123",
+			RowIndex:   3,
+			Rows:       []string{"3,Mar-96,Mar-96", "4,Apr-96,Apr-96"},
+		})
+		So(err, ShouldBeNil)
+		var output bytes.Buffer
+
+		Convey("When it is written to an ndjson writer for batch events", func() {
+			writer, err := sink.NewWriter(&output, sink.FormatNDJSON, sink.ExtractedBatchEvents)
+			So(err, ShouldBeNil)
+			writeAll(writer, [][]byte{message})
+
+			Convey("Then a line is written with the rows in the batch", func() {
+				var line map[string]interface{}
+				So(json.Unmarshal(output.Bytes(), &line), ShouldBeNil)
+				So(line["row_index"], ShouldEqual, 3)
+				So(line["rows"], ShouldResemble, []interface{}{"3,Mar-96,Mar-96", "4,Apr-96,Apr-96"})
+				So(line["message"], ShouldEqual, base64.StdEncoding.EncodeToString(message))
+			})
+		})
+	})
+
+	Convey("Given an unsupported format", t, func() {
+		Convey("When a writer is created", func() {
+			writer, err := sink.NewWriter(&bytes.Buffer{}, "csv", sink.ExtractedEvents)
+
+			Convey("Then an unsupported format error is returned", func() {
+				So(writer, ShouldBeNil)
+				So(err, ShouldResemble, &sink.UnsupportedFormatError{Format: "csv"})
+			})
+		})
+	})
+}
+
+// marshalEvents returns the observation extracted event messages for the given rows, with row indexes from 1.
+func marshalEvents(rows ...string) [][]byte {
+	messages := make([][]byte, 0, len(rows))
+	for i, row := range rows {
+		message, err := observation.Marshal(observation.ExtractedEvent{InstanceID: "123", RowIndex: int64(i + 1), Row: row})
+		So(err, ShouldBeNil)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// writeAll writes the messages to the sink and then closes it.
+func writeAll(s sink.Sink, messages [][]byte) {
+	for _, message := range messages {
+		So(s.Write(ctx, message), ShouldBeNil)
+	}
+	So(s.Close(), ShouldBeNil)
+}
+
+// readContainer returns the observation extracted events in the given avro object container file.
+func readContainer(file string) []observation.ExtractedEvent {
+	reader, err := avro.NewDataFileReader(file)
+	So(err, ShouldBeNil)
+	defer reader.Close()
+
+	var events []observation.ExtractedEvent
+	for reader.HasNext() {
+		var event observation.ExtractedEvent
+		So(reader.Next(&event), ShouldBeNil)
+		events = append(events, event)
+	}
+	So(reader.Err(), ShouldBeNil)
+	return events
+}
@@ -0,0 +1,213 @@
+package urlpolicy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rule matches the S3 objects whose bucket and key match the rule's globs. In a glob, `*` matches any characters
+// except `/`, `**` matches any characters including `/`, and `?` matches any single character except `/`.
+type Rule struct {
+	Bucket string
+	Key    string
+	bucket *regexp.Regexp
+	key    *regexp.Regexp
+}
+
+// ParseRule parses a rule of the form bucket/key-glob, such as `uploads/datasets/**.csv`.
+func ParseRule(spec string) (Rule, error) {
+	bucket, key, ok := strings.Cut(spec, "/")
+	if !ok || bucket == "" || key == "" {
+		return Rule{}, fmt.Errorf("invalid url policy rule %q: must be of the form bucket/key-glob", spec)
+	}
+
+	return Rule{
+		Bucket: bucket,
+		Key:    key,
+		bucket: compileGlob(bucket),
+		key:    compileGlob(key),
+	}, nil
+}
+
+// ParseRules parses each of the given rules, as described by ParseRule.
+func ParseRules(specs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Matches returns true if the given bucket and key match the rule.
+func (rule Rule) Matches(bucket, key string) bool {
+	return rule.bucket.MatchString(bucket) && rule.key.MatchString(key)
+}
+
+// String returns the rule in the form it was parsed from.
+func (rule Rule) String() string {
+	return rule.Bucket + "/" + rule.Key
+}
+
+// compileGlob converts a glob into an anchored regular expression.
+func compileGlob(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			pattern.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			pattern.WriteString("[^/]*")
+		case glob[i] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// Policy decides which S3 objects files may be read from. Files from other sources are matched by their URL, as
+// described by CheckURL. An object is allowed if it does not match any deny rule,
+// and either there are no allow rules or it matches at least one of them. Objects larger than MaxObjectSize bytes
+// are not allowed, unless MaxObjectSize is zero.
+type Policy struct {
+	Allow         []Rule
+	Deny          []Rule
+	MaxObjectSize int64
+}
+
+// Check returns a *Violation if the policy does not allow the object with the given bucket and key.
+func (policy Policy) Check(bucket, key string) error {
+	for _, rule := range policy.Deny {
+		if rule.Matches(bucket, key) {
+			return &Violation{Bucket: bucket, Key: key, Reason: fmt.Sprintf("matches deny rule %s", rule)}
+		}
+	}
+
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+
+	for _, rule := range policy.Allow {
+		if rule.Matches(bucket, key) {
+			return nil
+		}
+	}
+
+	return &Violation{Bucket: bucket, Key: key, Reason: "does not match any allow rule"}
+}
+
+// CheckSize returns a *Violation if the given object size is larger than the policy allows.
+func (policy Policy) CheckSize(bucket, key string, size int64) error {
+	if policy.MaxObjectSize > 0 && size > policy.MaxObjectSize {
+		return &Violation{Bucket: bucket, Key: key, Reason: fmt.Sprintf("size %d bytes exceeds maximum of %d bytes", size, policy.MaxObjectSize)}
+	}
+	return nil
+}
+
+// CheckURL returns a *Violation if the policy does not allow the file at the given URL, whatever its scheme. The host
+// of the URL is matched as the bucket and its path, without the leading slash, as the key. A file URL without a host
+// is matched with the bucket localhost.
+func (policy Policy) CheckURL(fileURL *url.URL) error {
+	bucket, key := object(fileURL)
+	return withURL(policy.Check(bucket, key), fileURL)
+}
+
+// CheckURLSize returns a *Violation if the given size of the file at the given URL is larger than the policy allows.
+func (policy Policy) CheckURLSize(fileURL *url.URL, size int64) error {
+	bucket, key := object(fileURL)
+	return withURL(policy.CheckSize(bucket, key, size), fileURL)
+}
+
+// LimitReader returns a reader that returns a *Violation once more than MaxObjectSize bytes have been read from the
+// file at the given URL, for files whose size is not known before they are read. The reader is returned unchanged if
+// MaxObjectSize is zero.
+func (policy Policy) LimitReader(fileURL *url.URL, reader io.ReadCloser) io.ReadCloser {
+	if policy.MaxObjectSize <= 0 {
+		return reader
+	}
+	return &limitedReader{ReadCloser: reader, policy: policy, fileURL: fileURL}
+}
+
+// limitedReader returns a *Violation once more than the maximum object size has been read
+type limitedReader struct {
+	io.ReadCloser
+	policy  Policy
+	fileURL *url.URL
+	read    int64
+}
+
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	remaining := reader.policy.MaxObjectSize - reader.read
+	if remaining < 0 {
+		return 0, reader.policy.CheckURLSize(reader.fileURL, reader.read)
+	}
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+
+	n, err := reader.ReadCloser.Read(p)
+	reader.read += int64(n)
+	if reader.read > reader.policy.MaxObjectSize {
+		excess := int(reader.read - reader.policy.MaxObjectSize)
+		return n - excess, reader.policy.CheckURLSize(reader.fileURL, reader.read)
+	}
+	return n, err
+}
+
+// object returns the bucket and key that the file at the given URL is matched as
+func object(fileURL *url.URL) (bucket, key string) {
+	bucket = fileURL.Host
+	if bucket == "" && fileURL.Scheme == "file" {
+		bucket = "localhost"
+	}
+	return bucket, strings.TrimPrefix(fileURL.Path, "/")
+}
+
+// withURL sets the URL of the given error if it is a *Violation
+func withURL(err error, fileURL *url.URL) error {
+	var violation *Violation
+	if errors.As(err, &violation) {
+		violation.URL = fileURL.String()
+	}
+	return err
+}
+
+// Violation is returned when an event refers to an object that the policy does not allow. Violations are permanent,
+// as the same event will be rejected however many times it is handled.
+type Violation struct {
+	Bucket string
+	Key    string
+	URL    string
+	Reason string
+	Err    error
+}
+
+// Error returns a description of the violation.
+func (err *Violation) Error() string {
+	if err.URL != "" {
+		return fmt.Sprintf("url policy violation for %s: %s", err.URL, err.Reason)
+	}
+	return fmt.Sprintf("url policy violation for s3://%s/%s: %s", err.Bucket, err.Key, err.Reason)
+}
+
+// Unwrap returns the underlying error, if any.
+func (err *Violation) Unwrap() error {
+	return err.Err
+}
+
+// Permanent returns true, as handling the event again will not succeed.
+func (err *Violation) Permanent() bool {
+	return true
+}
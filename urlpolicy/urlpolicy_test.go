@@ -0,0 +1,168 @@
+package urlpolicy_test
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-observation-extractor/urlpolicy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRule(t *testing.T) {
+	Convey("Given a rule of the form bucket/key-glob", t, func() {
+		rule, err := urlpolicy.ParseRule("uploads/datasets/*.csv")
+
+		Convey("Then the rule is parsed and matches keys using glob syntax", func() {
+			So(err, ShouldBeNil)
+			So(rule.String(), ShouldEqual, "uploads/datasets/*.csv")
+			So(rule.Matches("uploads", "datasets/cpih.csv"), ShouldBeTrue)
+			So(rule.Matches("uploads", "datasets/2024/cpih.csv"), ShouldBeFalse)
+			So(rule.Matches("uploads", "datasets/cpih.csv.gz"), ShouldBeFalse)
+			So(rule.Matches("other", "datasets/cpih.csv"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a rule using ** and ?", t, func() {
+		rule, err := urlpolicy.ParseRule("uploads-?/datasets/**")
+
+		Convey("Then ** matches across path separators and ? matches a single character", func() {
+			So(err, ShouldBeNil)
+			So(rule.Matches("uploads-1", "datasets/2024/01/cpih.csv"), ShouldBeTrue)
+			So(rule.Matches("uploads-10", "datasets/cpih.csv"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given rules without a bucket or key", t, func() {
+		Convey("Then an error is returned", func() {
+			for _, spec := range []string{"uploads", "uploads/", "/datasets/*"} {
+				_, err := urlpolicy.ParseRule(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestPolicy_Check(t *testing.T) {
+	Convey("Given a policy with allow and deny rules", t, func() {
+		allow, err := urlpolicy.ParseRules([]string{"uploads/datasets/**"})
+		So(err, ShouldBeNil)
+		deny, err := urlpolicy.ParseRules([]string{"*/datasets/private/**"})
+		So(err, ShouldBeNil)
+		policy := urlpolicy.Policy{Allow: allow, Deny: deny}
+
+		Convey("Then objects matching an allow rule are allowed", func() {
+			So(policy.Check("uploads", "datasets/cpih.csv"), ShouldBeNil)
+		})
+
+		Convey("Then objects matching a deny rule are not allowed, even if they match an allow rule", func() {
+			err := policy.Check("uploads", "datasets/private/cpih.csv")
+			So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+			So(err.Error(), ShouldEqual, "url policy violation for s3://uploads/datasets/private/cpih.csv: matches deny rule */datasets/private/**")
+		})
+
+		Convey("Then objects not matching any allow rule are not allowed", func() {
+			err := policy.Check("other", "datasets/cpih.csv")
+			So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+			So(err.Error(), ShouldEqual, "url policy violation for s3://other/datasets/cpih.csv: does not match any allow rule")
+		})
+	})
+
+	Convey("Given a policy with no rules", t, func() {
+		policy := urlpolicy.Policy{}
+
+		Convey("Then all objects are allowed", func() {
+			So(policy.Check("any", "key"), ShouldBeNil)
+		})
+	})
+}
+
+func TestPolicy_CheckSize(t *testing.T) {
+	Convey("Given a policy with a maximum object size", t, func() {
+		policy := urlpolicy.Policy{MaxObjectSize: 100}
+
+		Convey("Then objects up to the maximum size are allowed", func() {
+			So(policy.CheckSize("uploads", "key", 100), ShouldBeNil)
+		})
+
+		Convey("Then larger objects are not allowed", func() {
+			err := policy.CheckSize("uploads", "key", 101)
+			So(err, ShouldNotBeNil)
+			So(err.(*urlpolicy.Violation).Permanent(), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a policy without a maximum object size", t, func() {
+		policy := urlpolicy.Policy{}
+
+		Convey("Then objects of any size are allowed", func() {
+			So(policy.CheckSize("uploads", "key", 1<<40), ShouldBeNil)
+		})
+	})
+}
+
+func TestPolicy_CheckURL(t *testing.T) {
+	Convey("Given a policy with allow rules for a host and the local filesystem", t, func() {
+		allow, err := urlpolicy.ParseRules([]string{"files.example.com/datasets/**", "localhost/data/*.csv"})
+		So(err, ShouldBeNil)
+		policy := urlpolicy.Policy{Allow: allow}
+
+		Convey("Then urls of any scheme are matched by their host and path", func() {
+			So(policy.CheckURL(mustParse("https://files.example.com/datasets/cpih.csv")), ShouldBeNil)
+			So(policy.CheckURL(mustParse("s3://files.example.com/datasets/cpih.csv")), ShouldBeNil)
+		})
+
+		Convey("Then file urls without a host are matched as localhost", func() {
+			So(policy.CheckURL(mustParse("file:///data/cpih.csv")), ShouldBeNil)
+		})
+
+		Convey("Then urls not matching any allow rule are not allowed, and the violation describes the url", func() {
+			err := policy.CheckURL(mustParse("http://other.example.com/datasets/cpih.csv"))
+			So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+			So(err.Error(), ShouldEqual, "url policy violation for http://other.example.com/datasets/cpih.csv: does not match any allow rule")
+		})
+	})
+}
+
+func TestPolicy_LimitReader(t *testing.T) {
+	fileURL := mustParse("file:///data/cpih.csv")
+
+	Convey("Given a policy with a maximum object size", t, func() {
+		policy := urlpolicy.Policy{MaxObjectSize: 5}
+
+		Convey("When a file of the maximum size is read", func() {
+			b, err := io.ReadAll(policy.LimitReader(fileURL, io.NopCloser(strings.NewReader("12345"))))
+
+			Convey("Then the whole file is read", func() {
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "12345")
+			})
+		})
+
+		Convey("When a larger file is read", func() {
+			b, err := io.ReadAll(policy.LimitReader(fileURL, io.NopCloser(strings.NewReader("123456"))))
+
+			Convey("Then a violation is returned after the maximum size has been read", func() {
+				So(err, ShouldHaveSameTypeAs, &urlpolicy.Violation{})
+				So(string(b), ShouldEqual, "12345")
+			})
+		})
+	})
+
+	Convey("Given a policy without a maximum object size", t, func() {
+		reader := io.NopCloser(strings.NewReader("123456"))
+
+		Convey("Then the reader is returned unchanged", func() {
+			So(urlpolicy.Policy{}.LimitReader(fileURL, reader), ShouldEqual, reader)
+		})
+	})
+}
+
+func mustParse(rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}